@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminPathPrefix 下的路径保留给管理接口，S3 存储桶名称不能以 "-" 开头，不会与路径类型请求冲突。
+const adminPathPrefix = "/-/"
+
+// adminMiddleware 处理管理接口，调用方必须使用代理访问密钥进行签名。/-/sts 允许任何长期密钥为自己签发临时凭证，
+// 其余接口需要 admin 权限。publicEndpoint 为空时，预签名 URL 使用请求本身的 Host。
+func adminMiddleware(s3Auth *s3SignatureAuthenticator, publicEndpoint *url.URL) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.Request.URL.Path, adminPathPrefix) {
+			c.Next()
+			return
+		}
+		c.Abort()
+
+		credential, err := s3Auth.Authenticate(c.Request)
+		if err != nil {
+			log.Printf("Forbidden: admin request %s %s from IP %s has an invalid S3 signature: %v.", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: admin access denied"})
+			return
+		}
+		if c.Request.URL.Path == adminPathPrefix+"sts" || c.Request.URL.Path == adminPathPrefix+"sts/" {
+			if credential.parent != "" {
+				log.Printf("Forbidden: temporary credentials %s cannot issue new sessions.", credential.AccessKey)
+				c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: temporary credentials cannot issue new sessions"})
+				return
+			}
+			if c.Request.Method != http.MethodPost && c.Request.Method != http.MethodGet {
+				c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed"})
+				return
+			}
+			handleAssumeRole(c, s3Auth, credential)
+			return
+		}
+		if !credential.hasAction(actionAdmin) {
+			log.Printf("Forbidden: access key %s is not an admin key.", credential.AccessKey)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: admin access denied"})
+			return
+		}
+
+		switch c.Request.URL.Path {
+		case adminPathPrefix + "presign":
+			if c.Request.Method != http.MethodPost {
+				c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed"})
+				return
+			}
+			handlePresign(c, s3Auth, credential, publicEndpoint)
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown admin endpoint"})
+		}
+	}
+}
+
+// handlePresign 为请求体中描述的对象生成预签名 URL，默认使用调用方自己的密钥签名，
+// 也可以通过 access_key 指定其他已配置的密钥。
+func handlePresign(c *gin.Context, s3Auth *s3SignatureAuthenticator, caller *proxyCredential, publicEndpoint *url.URL) {
+	var opts presignOptions
+	if err := c.ShouldBindJSON(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid presign request: " + err.Error()})
+		return
+	}
+
+	signer := caller
+	if opts.AccessKey != "" && opts.AccessKey != caller.AccessKey {
+		credential, err := s3Auth.lookup(opts.AccessKey)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or disabled access_key"})
+			return
+		}
+		signer = credential
+	}
+
+	endpoint := publicEndpoint
+	if endpoint == nil {
+		endpoint = &url.URL{Scheme: "http", Host: c.Request.Host}
+		if c.Request.TLS != nil {
+			endpoint.Scheme = "https"
+		}
+	}
+
+	result, err := signer.presign(endpoint, opts, s3Auth.now())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errInvalidPresignRequest) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Admin key %s issued a presigned %s URL for %s/%s signed by %s, expiring at %s.", caller.AccessKey, result.Method, opts.Bucket, opts.Key, signer.AccessKey, result.ExpiresAt.Format("2006-01-02T15:04:05Z"))
+	c.JSON(http.StatusOK, result)
+}
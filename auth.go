@@ -28,10 +28,11 @@ var (
 )
 
 type s3SignatureAuthenticator struct {
-	accessKey string
-	secretKey string
-	now       func() time.Time
-	maxSkew   time.Duration
+	credentials map[string]*proxyCredential
+	now         func() time.Time
+	maxSkew     time.Duration
+	baseDomain  string
+	sessions    *sessionSealer
 }
 
 func newS3SignatureAuthenticator(accessKey, secretKey string) *s3SignatureAuthenticator {
@@ -39,132 +40,169 @@ func newS3SignatureAuthenticator(accessKey, secretKey string) *s3SignatureAuthen
 		return nil
 	}
 
+	return newCredentialAuthenticator([]*proxyCredential{{
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Actions:   []string{string(actionAll), string(actionAdmin)},
+	}})
+}
+
+func newCredentialAuthenticator(credentials []*proxyCredential) *s3SignatureAuthenticator {
+	if len(credentials) == 0 {
+		return nil
+	}
+
+	store := make(map[string]*proxyCredential, len(credentials))
+	for _, credential := range credentials {
+		store[credential.AccessKey] = credential
+	}
 	return &s3SignatureAuthenticator{
-		accessKey: accessKey,
-		secretKey: secretKey,
-		now:       time.Now,
-		maxSkew:   defaultAuthSkew,
+		credentials: store,
+		now:         time.Now,
+		maxSkew:     defaultAuthSkew,
 	}
 }
 
 func (a *s3SignatureAuthenticator) Verify(r *http.Request) error {
+	_, err := a.Authenticate(r)
+	return err
+}
+
+func (a *s3SignatureAuthenticator) Authenticate(r *http.Request) (*proxyCredential, error) {
 	if a == nil {
-		return errMissingSignature
+		return nil, errMissingSignature
 	}
-	if r.URL.Query().Get("X-Amz-Signature") != "" {
+	query := r.URL.Query()
+	switch {
+	case query.Get("X-Amz-Signature") != "":
 		return a.verifyPresignedURL(r)
+	case query.Get("Signature") != "" && query.Get("AWSAccessKeyId") != "":
+		return a.verifyPresignedURLV2(r)
+	case strings.HasPrefix(r.Header.Get("Authorization"), awsSigV2Prefix):
+		return a.verifyAuthorizationHeaderV2(r)
 	}
 	return a.verifyAuthorizationHeader(r)
 }
 
-func (a *s3SignatureAuthenticator) verifyAuthorizationHeader(r *http.Request) error {
+func (a *s3SignatureAuthenticator) lookup(accessKey string) (*proxyCredential, error) {
+	credential, ok := a.credentials[accessKey]
+	if !ok || !credential.isEnabled() {
+		return nil, errInvalidSignature
+	}
+	return credential, nil
+}
+
+func (a *s3SignatureAuthenticator) verifyAuthorizationHeader(r *http.Request) (*proxyCredential, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return errMissingSignature
+		return nil, errMissingSignature
 	}
 
 	auth, err := parseAuthorizationHeader(authHeader)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if auth.accessKey != a.accessKey {
-		return errInvalidSignature
+	credential, err := a.resolve(auth.accessKey, r.Header.Get("X-Amz-Security-Token"))
+	if err != nil {
+		return nil, err
 	}
 	amzDate := r.Header.Get("X-Amz-Date")
 	if amzDate == "" {
 		amzDate = r.Header.Get("Date")
 	}
 	if err := validateSignedTime(amzDate, a.now(), a.maxSkew); err != nil {
-		return err
+		return nil, err
 	}
 
 	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
 	if payloadHash == "" {
-		payloadHash = "UNSIGNED-PAYLOAD"
+		payloadHash = unsignedPayload
+		if !strings.Contains(auth.scope, "/s3/") {
+			if payloadHash, err = bufferedPayloadHash(r); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	canonicalRequest, err := buildCanonicalRequest(r, auth.signedHeaders, "", payloadHash)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	expected := a.signature(amzDate, auth.scope, canonicalRequest)
+	expected := credential.signature(amzDate, auth.scope, canonicalRequest)
 	if subtle.ConstantTimeCompare([]byte(expected), []byte(auth.signature)) != 1 {
-		return errInvalidSignature
+		return nil, errInvalidSignature
 	}
-	return nil
+	if isStreamingPayload(payloadHash) {
+		err = installAWSChunkedReader(r, &chunkSigner{
+			signingKey:    credential.signingKey(auth.scope),
+			amzDate:       amzDate,
+			scope:         auth.scope,
+			prevSignature: expected,
+		})
+	} else {
+		err = installPayloadHashReader(r, payloadHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return credential, nil
 }
 
-func (a *s3SignatureAuthenticator) verifyPresignedURL(r *http.Request) error {
+func (a *s3SignatureAuthenticator) verifyPresignedURL(r *http.Request) (*proxyCredential, error) {
 	q := r.URL.Query()
 	if q.Get("X-Amz-Algorithm") != awsSigV4Algorithm {
-		return errInvalidSignature
+		return nil, errInvalidSignature
 	}
 
-	credential, err := parseCredential(q.Get("X-Amz-Credential"))
+	credentialValue, err := parseCredential(q.Get("X-Amz-Credential"))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if credential.accessKey != a.accessKey {
-		return errInvalidSignature
+	credential, err := a.resolve(credentialValue.accessKey, q.Get("X-Amz-Security-Token"))
+	if err != nil {
+		return nil, err
 	}
 
 	amzDate := q.Get("X-Amz-Date")
 	signedAt, err := parseAmzDate(amzDate)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	expiresSeconds, err := strconv.Atoi(q.Get("X-Amz-Expires"))
 	if err != nil || expiresSeconds < 0 {
-		return errInvalidSignature
+		return nil, errInvalidSignature
 	}
 	expires := time.Duration(expiresSeconds) * time.Second
 	if expires > maxPresignExpiry {
-		return errInvalidSignature
+		return nil, errInvalidSignature
 	}
 	now := a.now()
 	if now.Before(signedAt.Add(-a.maxSkew)) || now.After(signedAt.Add(expires)) {
-		return errInvalidSignature
+		return nil, errInvalidSignature
 	}
 
 	signedHeaders := strings.Split(q.Get("X-Amz-SignedHeaders"), ";")
 	if len(signedHeaders) == 0 || signedHeaders[0] == "" {
-		return errInvalidSignature
+		return nil, errInvalidSignature
 	}
 
 	payloadHash := q.Get("X-Amz-Content-Sha256")
 	if payloadHash == "" {
-		payloadHash = "UNSIGNED-PAYLOAD"
+		payloadHash = unsignedPayload
 	}
 
 	canonicalRequest, err := buildCanonicalRequest(r, signedHeaders, "X-Amz-Signature", payloadHash)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	expected := a.signature(amzDate, credential.scope, canonicalRequest)
+	expected := credential.signature(amzDate, credentialValue.scope, canonicalRequest)
 	if subtle.ConstantTimeCompare([]byte(expected), []byte(q.Get("X-Amz-Signature"))) != 1 {
-		return errInvalidSignature
+		return nil, errInvalidSignature
 	}
-	return nil
-}
-
-func (a *s3SignatureAuthenticator) signature(amzDate, scope, canonicalRequest string) string {
-	stringToSign := strings.Join([]string{
-		awsSigV4Algorithm,
-		amzDate,
-		scope,
-		hexSHA256(canonicalRequest),
-	}, "\n")
-
-	parts := strings.Split(scope, "/")
-	if len(parts) != 4 {
-		return ""
-	}
-	date, region, service := parts[0], parts[1], parts[2]
-	signingKey := hmacSHA256([]byte("AWS4"+a.secretKey), date)
-	signingKey = hmacSHA256(signingKey, region)
-	signingKey = hmacSHA256(signingKey, service)
-	signingKey = hmacSHA256(signingKey, awsSigV4Request)
-	return hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	if err := installPayloadHashReader(r, payloadHash); err != nil {
+		return nil, err
+	}
+	return credential, nil
 }
 
 type authorizationData struct {
@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
 	"time"
 
+	controllers "cos-proxy/controller"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -42,13 +46,46 @@ func TestS3SignatureAuthenticatorVerifyPresignedURL(t *testing.T) {
 	}
 }
 
+func TestS3SignatureAuthenticatorVerifiesSignedPayloadHash(t *testing.T) {
+	auth := testAuthenticator()
+	req := newSignedRequest(t, auth, "PUT", "http://s3.example.com/bucket/path/file.txt", "hello")
+
+	if err := auth.Verify(req); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil || string(body) != "hello" {
+		t.Fatalf("expected body to pass hash verification, got %q, %v", body, err)
+	}
+	if err := req.Body.(*payloadHashReader).VerifyBody(); err != nil {
+		t.Fatalf("expected verified body, got %v", err)
+	}
+}
+
+func TestS3SignatureAuthenticatorRejectsMismatchedPayload(t *testing.T) {
+	auth := testAuthenticator()
+	req := newSignedRequest(t, auth, "PUT", "http://s3.example.com/bucket/path/file.txt", "hello")
+	req.Body = io.NopCloser(bytes.NewBufferString("HELLO"))
+
+	if err := auth.Verify(req); err != nil {
+		t.Fatalf("expected header signature to verify, got %v", err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if !errors.Is(err, errPayloadHashMismatch) {
+		t.Fatalf("expected payload hash mismatch, got %v", err)
+	}
+	if len(body) == len("HELLO") {
+		t.Fatal("expected the final bytes to be withheld on mismatch")
+	}
+}
+
 func TestWriteAccessMiddlewareAllowsSignedRequestOutsideWhitelist(t *testing.T) {
 	auth := testAuthenticator()
 	req := newSignedRequest(t, auth, "PUT", "http://s3.example.com/bucket/path/file.txt?x-id=PutObject", "hello")
 	req.Header.Set("X-Real-IP", "203.0.113.10")
 	recorder := httptest.NewRecorder()
 
-	writeAccessMiddleware(map[string]bool{}, auth)(newTestContext(recorder, req))
+	writeAccessMiddleware(defaultBucketPolicy(nil, []string{"proxy-access"}), auth, nil, "", nil)(newTestContext(recorder, req))
 
 	if recorder.Code != http.StatusOK {
 		t.Fatalf("expected middleware to allow signed request, got status %d", recorder.Code)
@@ -60,13 +97,36 @@ func TestWriteAccessMiddlewareRejectsUnsignedRequestOutsideWhitelist(t *testing.
 	req.Header.Set("X-Real-IP", "203.0.113.10")
 	recorder := httptest.NewRecorder()
 
-	writeAccessMiddleware(map[string]bool{}, testAuthenticator())(newTestContext(recorder, req))
+	writeAccessMiddleware(defaultBucketPolicy(nil, []string{"proxy-access"}), testAuthenticator(), nil, "", nil)(newTestContext(recorder, req))
 
 	if recorder.Code != http.StatusForbidden {
 		t.Fatalf("expected middleware to reject unsigned request, got status %d", recorder.Code)
 	}
 }
 
+func TestWriteAccessMiddlewareMarksAuthenticatedRequests(t *testing.T) {
+	auth := testAuthenticator()
+	for _, tc := range []struct {
+		name          string
+		req           *http.Request
+		authenticated bool
+	}{
+		{name: "anonymous", req: httptest.NewRequest(http.MethodGet, "http://s3.example.com/bucket/a.txt", nil)},
+		{name: "presigned", req: newPresignedRequest(t, auth, "GET", "http://s3.example.com/bucket/a.txt", time.Hour), authenticated: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			context := newTestContext(recorder, tc.req)
+
+			writeAccessMiddleware(defaultBucketPolicy(nil, []string{"proxy-access"}), auth, nil, "", nil)(context)
+
+			if recorder.Code != http.StatusOK || context.GetBool(controllers.AuthenticatedContextKey) != tc.authenticated {
+				t.Fatalf("expected status 200 and authenticated=%t, got %d and %t", tc.authenticated, recorder.Code, context.GetBool(controllers.AuthenticatedContextKey))
+			}
+		})
+	}
+}
+
 func TestStripClientS3AuthPreservesS3OperationQuery(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/bucket/path/file.txt?x-id=PutObject&uploadId=abc&X-Amz-Signature=sig&X-Amz-Date=20260517T163000Z", nil)
 	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 test")
@@ -107,7 +167,7 @@ func newSignedRequest(t *testing.T, auth *s3SignatureAuthenticator, method, targ
 	if err != nil {
 		t.Fatal(err)
 	}
-	signature := auth.signature("20260517T163000Z", scope, canonicalRequest)
+	signature := auth.credentials["proxy-access"].signature("20260517T163000Z", scope, canonicalRequest)
 	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=proxy-access/"+scope+", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="+signature)
 	return req
 }
@@ -129,7 +189,7 @@ func newPresignedRequest(t *testing.T, auth *s3SignatureAuthenticator, method, t
 	if err != nil {
 		t.Fatal(err)
 	}
-	signature := auth.signature("20260517T163000Z", "20260517/us-east-1/s3/aws4_request", canonicalRequest)
+	signature := auth.credentials["proxy-access"].signature("20260517T163000Z", "20260517/us-east-1/s3/aws4_request", canonicalRequest)
 	q = req.URL.Query()
 	q.Set("X-Amz-Signature", signature)
 	req.URL.RawQuery = q.Encode()
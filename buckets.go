@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	controllers "cos-proxy/controller"
+
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// s3BucketNamePattern 是 S3 存储桶命名规则的简化版本：3-63 个小写字母、数字、"." 或 "-"，且以字母或数字开头和结尾。
+var s3BucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// bucketConfig 描述一个对外暴露的 S3 存储桶及其对应的 COS 存储桶，
+// SecretID/SecretKey 为空时使用 TENCENTCLOUD_SECRET_ID/TENCENTCLOUD_SECRET_KEY，
+// Region 为空时从 COS 域名中解析，使用自定义域名时需要显式填写，
+// RequireEncryption 为 true 时拒绝没有指定服务端加密的写入请求，
+// ObjectLock 不为空时在对应前缀下启用由代理执行的对象锁定。
+type bucketConfig struct {
+	Name              string            `json:"name"`
+	URL               string            `json:"url"`
+	SecretID          string            `json:"secret_id,omitempty"`
+	SecretKey         string            `json:"secret_key,omitempty"`
+	Region            string            `json:"region,omitempty"`
+	RequireEncryption bool              `json:"require_encryption,omitempty"`
+	ObjectLock        *objectLockConfig `json:"object_lock,omitempty"`
+}
+
+// objectLockConfig 是存储桶的对象锁定配置，Prefixes 为空时对整个存储桶生效。
+type objectLockConfig struct {
+	Prefixes         []string `json:"prefixes,omitempty"`
+	DefaultRetention *struct {
+		Mode string `json:"mode"`
+		Days int    `json:"days"`
+	} `json:"default_retention,omitempty"`
+}
+
+type bucketsFile struct {
+	Buckets []*bucketConfig `json:"buckets"`
+}
+
+// loadBucketConfigs 从 JSON 配置文件中读取存储桶列表。
+func loadBucketConfigs(path string) ([]*bucketConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read buckets file: %w", err)
+	}
+
+	var file bucketsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse buckets file: %w", err)
+	}
+	for i, bucket := range file.Buckets {
+		if bucket == nil || bucket.Name == "" || bucket.URL == "" {
+			return nil, fmt.Errorf("bucket #%d: name and url are required", i+1)
+		}
+		if (bucket.SecretID == "") != (bucket.SecretKey == "") {
+			return nil, fmt.Errorf("bucket %s: secret_id and secret_key must be set together", bucket.Name)
+		}
+	}
+	return file.Buckets, nil
+}
+
+// defaultBucketName 从 COS 存储桶域名中取出存储桶名称，例如
+// examplebucket-1250000000.cos-internal.ap-guangzhou.myqcloud.com 对应 examplebucket-1250000000。
+func defaultBucketName(bucketURL string) string {
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return ""
+	}
+	name, _, _ := strings.Cut(u.Hostname(), ".")
+	return name
+}
+
+// cosRegionFromURL 从 COS 默认域名中解析地域，例如
+// examplebucket-1250000000.cos-internal.ap-guangzhou.myqcloud.com 对应 ap-guangzhou，无法识别时返回空字符串。
+func cosRegionFromURL(u *url.URL) string {
+	labels := strings.Split(u.Hostname(), ".")
+	for i := 1; i+1 < len(labels); i++ {
+		if labels[i] == "cos" || labels[i] == "cos-internal" {
+			return labels[i+1]
+		}
+	}
+	return ""
+}
+
+// newBucketRegistry 为每个存储桶创建独立的 COS 客户端并注册到同一个注册表中。
+func newBucketRegistry(configs []*bucketConfig, secretID, secretKey string) (*controllers.BucketRegistry, error) {
+	registry := controllers.NewBucketRegistry()
+	for _, bucket := range configs {
+		if !s3BucketNamePattern.MatchString(bucket.Name) || strings.Contains(bucket.Name, "..") {
+			return nil, fmt.Errorf("bucket %q: invalid S3 bucket name", bucket.Name)
+		}
+		u, err := url.Parse(bucket.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("bucket %s: invalid url %q", bucket.Name, bucket.URL)
+		}
+		id, key := bucket.SecretID, bucket.SecretKey
+		if id == "" {
+			id, key = secretID, secretKey
+		}
+		if id == "" || key == "" {
+			return nil, fmt.Errorf("bucket %s: no COS credentials (set secret_id/secret_key or TENCENTCLOUD_SECRET_ID/TENCENTCLOUD_SECRET_KEY)", bucket.Name)
+		}
+
+		client := cos.NewClient(&cos.BaseURL{BucketURL: u}, &http.Client{
+			Transport: &cos.AuthorizationTransport{
+				SecretID:  id,
+				SecretKey: key,
+			},
+		})
+		region := bucket.Region
+		if region == "" {
+			region = cosRegionFromURL(u)
+		}
+		if err := registry.Register(bucket.Name, region, client); err != nil {
+			return nil, err
+		}
+		if bucket.RequireEncryption {
+			if err := registry.RequireEncryption(bucket.Name); err != nil {
+				return nil, err
+			}
+		}
+		if lock := bucket.ObjectLock; lock != nil {
+			config := controllers.ObjectLockConfiguration{Prefixes: lock.Prefixes}
+			if lock.DefaultRetention != nil {
+				config.DefaultMode, config.DefaultDays = lock.DefaultRetention.Mode, lock.DefaultRetention.Days
+			}
+			if err := registry.EnableObjectLock(bucket.Name, config); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return registry, nil
+}
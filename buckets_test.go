@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	controllers "cos-proxy/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoadBucketConfigs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buckets.json")
+	content := `{"buckets": [
+		{"name": "photos", "url": "https://photos-1250000000.cos-internal.ap-guangzhou.myqcloud.com",
+			"object_lock": {"prefixes": ["records/"], "default_retention": {"mode": "COMPLIANCE", "days": 30}}},
+		{"name": "logs", "url": "https://logs-1250000001.cos-internal.ap-shanghai.myqcloud.com", "secret_id": "id", "secret_key": "key"}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := loadBucketConfigs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := newBucketRegistry(configs, "default-id", "default-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := registry.Names(); len(got) != 2 || got[0] != "logs" || got[1] != "photos" {
+		t.Fatalf("unexpected bucket names %v", got)
+	}
+	if client := registry.Lookup("logs"); client == nil || client.BaseURL.BucketURL.Host != "logs-1250000001.cos-internal.ap-shanghai.myqcloud.com" {
+		t.Fatalf("expected logs bucket to use its own COS URL, got %v", client)
+	}
+	if registry.Lookup("unknown") != nil {
+		t.Fatal("expected unknown bucket to be absent")
+	}
+	if lock := registry.ObjectLock("photos"); lock == nil || lock.DefaultMode != "COMPLIANCE" || lock.DefaultDays != 30 || len(lock.Prefixes) != 1 {
+		t.Fatalf("expected photos to enable object lock, got %+v", lock)
+	}
+	if registry.ObjectLock("logs") != nil {
+		t.Fatal("expected logs not to enable object lock")
+	}
+}
+
+func TestNewBucketRegistryRejectsInvalidBuckets(t *testing.T) {
+	for name, configs := range map[string][]*bucketConfig{
+		"invalid name":   {{Name: "Bad_Name", URL: "https://a-1250000000.cos.ap-guangzhou.myqcloud.com"}},
+		"admin prefix":   {{Name: "-", URL: "https://a-1250000000.cos.ap-guangzhou.myqcloud.com"}},
+		"invalid url":    {{Name: "photos", URL: "not a url"}},
+		"duplicate name": {{Name: "photos", URL: "https://a-1250000000.cos.ap-guangzhou.myqcloud.com"}, {Name: "photos", URL: "https://b-1250000000.cos.ap-guangzhou.myqcloud.com"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newBucketRegistry(configs, "id", "key"); err == nil {
+				t.Fatal("expected invalid bucket configuration to be rejected")
+			}
+		})
+	}
+
+	if _, err := newBucketRegistry([]*bucketConfig{{Name: "photos", URL: "https://a-1250000000.cos.ap-guangzhou.myqcloud.com"}}, "", ""); err == nil {
+		t.Fatal("expected bucket without any COS credentials to be rejected")
+	}
+}
+
+func TestDefaultBucketName(t *testing.T) {
+	if got := defaultBucketName("https://examplebucket-1250000000.cos-internal.ap-guangzhou.myqcloud.com"); got != "examplebucket-1250000000" {
+		t.Fatalf("unexpected default bucket name %q", got)
+	}
+}
+
+func TestControllerReturnsNoSuchBucket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry, err := newBucketRegistry([]*bucketConfig{{Name: "photos", URL: "https://photos-1250000000.cos.ap-guangzhou.myqcloud.com"}}, "id", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	controllers.NewS3Controller("", registry).RegisterRoutes(router)
+
+	req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/unknown/a.txt", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusNotFound || !strings.Contains(recorder.Body.String(), "<Code>NoSuchBucket</Code>") {
+		t.Fatalf("expected NoSuchBucket, got status %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestCOSRegionFromURL(t *testing.T) {
+	for rawURL, want := range map[string]string{
+		"https://examplebucket-1250000000.cos-internal.ap-guangzhou.myqcloud.com": "ap-guangzhou",
+		"https://examplebucket-1250000000.cos.ap-shanghai.myqcloud.com":           "ap-shanghai",
+		"https://static.example.com":                                              "",
+	} {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cosRegionFromURL(u); got != want {
+			t.Errorf("%s: expected region %q, got %q", rawURL, want, got)
+		}
+	}
+}
+
+func TestControllerListsBucketsAndLocation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry, err := newBucketRegistry([]*bucketConfig{
+		{Name: "photos", URL: "https://photos-1250000000.cos.ap-guangzhou.myqcloud.com"},
+		{Name: "archive", URL: "https://static.example.com", Region: "ap-beijing"},
+	}, "id", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	controllers.NewS3Controller("", registry).RegisterRoutes(router)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/", nil))
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusOK || !strings.Contains(body, "<ListAllMyBucketsResult") || strings.Index(body, "<Name>archive</Name>") > strings.Index(body, "<Name>photos</Name>") {
+		t.Fatalf("unexpected ListBuckets response, status %d: %s", recorder.Code, body)
+	}
+	if created := registry.CreationDate("photos"); created.IsZero() || !strings.Contains(body, "<CreationDate>"+created.Format("2006-01-02T15:04:05.000Z")+"</CreationDate>") {
+		t.Fatalf("expected the registration time as CreationDate, got %s", body)
+	}
+	if !registry.CreationDate("missing").IsZero() {
+		t.Fatal("expected unknown buckets to have no creation date")
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/archive?location", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), ">ap-beijing</LocationConstraint>") {
+		t.Fatalf("unexpected GetBucketLocation response, status %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestRequestOperationsForBucketRequests(t *testing.T) {
+	for target, want := range map[string]string{
+		"http://s3.example.com/":                 "s3:ListAllMyBuckets",
+		"http://s3.example.com/photos?location":  "s3:GetBucketLocation",
+		"http://s3.example.com/photos?prefix=a/": "s3:ListBucket",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		bucket, key := controllers.ParseBucketAndKey(req.Host, req.URL.Path, "")
+		operations, err := requestOperations(req, bucket, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(operations) != 1 || operations[0].action != want || operations[0].grant != actionList {
+			t.Errorf("%s: expected %s, got %+v", target, want, operations)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	streamingSignedPayload          = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingSignedPayloadTrailer   = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsignedPayloadTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	awsChunkPayloadAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	awsTrailerAlgorithm      = "AWS4-HMAC-SHA256-TRAILER"
+	emptySHA256              = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	maxAWSChunkSize       = 16 << 20
+	maxAWSChunkHeaderSize = 4 << 10
+)
+
+var (
+	errMalformedChunkedBody = &s3RequestError{status: http.StatusBadRequest, code: "IncompleteBody", message: "malformed aws-chunked request body"}
+	errChunkSignature       = &s3RequestError{status: http.StatusForbidden, code: "SignatureDoesNotMatch", message: "aws-chunked chunk signature does not match"}
+	errTrailerChecksum      = &s3RequestError{status: http.StatusBadRequest, code: "BadDigest", message: "trailing checksum does not match the request body"}
+)
+
+// s3RequestError 是可以直接映射为 S3 错误响应的请求错误，控制器会通过 S3Error 识别它。
+type s3RequestError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *s3RequestError) Error() string {
+	return e.message
+}
+
+func (e *s3RequestError) S3Error() (int, string) {
+	return e.status, e.code
+}
+
+var trailerChecksums = map[string]func() hash.Hash{
+	"x-amz-checksum-crc32":     func() hash.Hash { return crc32.NewIEEE() },
+	"x-amz-checksum-crc32c":    func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+	"x-amz-checksum-crc64nvme": func() hash.Hash { return crc64.New(crc64.MakeTable(0x9a6c9329ac4bc9b5)) },
+	"x-amz-checksum-sha1":      sha1.New,
+	"x-amz-checksum-sha256":    sha256.New,
+}
+
+type chunkSigner struct {
+	signingKey    []byte
+	amzDate       string
+	scope         string
+	prevSignature string
+}
+
+func (s *chunkSigner) next(algorithm, contentHash string) string {
+	stringToSign := strings.Join([]string{
+		algorithm,
+		s.amzDate,
+		s.scope,
+		s.prevSignature,
+	}, "\n")
+	if algorithm == awsChunkPayloadAlgorithm {
+		stringToSign += "\n" + emptySHA256
+	}
+	stringToSign += "\n" + contentHash
+	return hex.EncodeToString(hmacSHA256(s.signingKey, stringToSign))
+}
+
+func (s *chunkSigner) verify(algorithm, contentHash, signature string) bool {
+	expected := s.next(algorithm, contentHash)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		return false
+	}
+	s.prevSignature = expected
+	return true
+}
+
+func isStreamingPayload(payloadHash string) bool {
+	switch payloadHash {
+	case streamingSignedPayload, streamingSignedPayloadTrailer, streamingUnsignedPayloadTrailer:
+		return true
+	}
+	return false
+}
+
+// installAWSChunkedReader 在请求体使用 aws-chunked 编码时将其替换为解码后的数据流，
+// 并把 Content-Length 修正为 x-amz-decoded-content-length。signer 为 nil 时只去除分块格式，不校验分块签名。
+func installAWSChunkedReader(r *http.Request, signer *chunkSigner) error {
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if !isStreamingPayload(payloadHash) {
+		return nil
+	}
+	if payloadHash == streamingUnsignedPayloadTrailer {
+		signer = nil
+	}
+
+	decodedLength, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+	if err != nil || decodedLength < 0 {
+		return &s3RequestError{status: http.StatusLengthRequired, code: "MissingContentLength", message: "missing x-amz-decoded-content-length"}
+	}
+
+	reader := &awsChunkedReader{
+		br:            bufio.NewReaderSize(r.Body, maxAWSChunkHeaderSize),
+		body:          r.Body,
+		signer:        signer,
+		signedChunks:  payloadHash != streamingUnsignedPayloadTrailer,
+		decodedLength: decodedLength,
+	}
+	if payloadHash != streamingSignedPayload {
+		trailer := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Amz-Trailer")))
+		newHash, ok := trailerChecksums[trailer]
+		if !ok {
+			return &s3RequestError{status: http.StatusBadRequest, code: "InvalidRequest", message: "unsupported x-amz-trailer"}
+		}
+		reader.trailer = trailer
+		reader.checksum = newHash()
+	}
+
+	r.Body = reader
+	r.ContentLength = decodedLength
+	r.Header.Set("Content-Length", strconv.FormatInt(decodedLength, 10))
+	r.Header.Del("X-Amz-Decoded-Content-Length")
+	r.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	removeAWSChunkedEncoding(r.Header)
+	return nil
+}
+
+func removeAWSChunkedEncoding(header http.Header) {
+	var encodings []string
+	for _, value := range header.Values("Content-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.TrimSpace(encoding)
+			if encoding != "" && !strings.EqualFold(encoding, "aws-chunked") {
+				encodings = append(encodings, encoding)
+			}
+		}
+	}
+	if len(encodings) == 0 {
+		header.Del("Content-Encoding")
+		return
+	}
+	header.Set("Content-Encoding", strings.Join(encodings, ","))
+}
+
+// awsChunkedReader 解码 aws-chunked 请求体。每个分块在校验通过后才会交给下游，
+// 最后一个数据分块会一直保留到尾部签名和校验和验证完毕，确保校验失败时 COS 收不到完整的请求体。
+type awsChunkedReader struct {
+	br            *bufio.Reader
+	body          io.Closer
+	signer        *chunkSigner
+	signedChunks  bool
+	trailer       string
+	checksum      hash.Hash
+	decodedLength int64
+
+	decoded    int64
+	pending    []byte
+	nextHeader *awsChunkHeader
+	err        error
+}
+
+type awsChunkHeader struct {
+	size      int
+	signature string
+}
+
+func (r *awsChunkedReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.readChunk()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *awsChunkedReader) Close() error {
+	return r.body.Close()
+}
+
+func (r *awsChunkedReader) readChunk() error {
+	header := r.nextHeader
+	r.nextHeader = nil
+	if header == nil {
+		var err error
+		if header, err = r.readChunkHeader(); err != nil {
+			return err
+		}
+	}
+	if header.size == 0 {
+		return r.finish(header)
+	}
+
+	data := make([]byte, header.size)
+	if _, err := io.ReadFull(r.br, data); err != nil {
+		return errMalformedChunkedBody
+	}
+	if err := r.expectCRLF(); err != nil {
+		return err
+	}
+	if r.signer != nil && !r.signer.verify(awsChunkPayloadAlgorithm, hexSHA256Bytes(data), header.signature) {
+		return errChunkSignature
+	}
+	r.decoded += int64(len(data))
+	if r.decoded > r.decodedLength {
+		return errMalformedChunkedBody
+	}
+	if r.checksum != nil {
+		r.checksum.Write(data)
+	}
+
+	next, err := r.readChunkHeader()
+	if err != nil {
+		return err
+	}
+	if next.size == 0 {
+		if err := r.finish(next); err != io.EOF {
+			return err
+		}
+		r.pending = data
+		return io.EOF
+	}
+	r.nextHeader = next
+	r.pending = data
+	return nil
+}
+
+func (r *awsChunkedReader) readChunkHeader() (*awsChunkHeader, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	sizeValue, extension, hasExtension := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeValue, 16, 64)
+	if err != nil || size < 0 || size > maxAWSChunkSize {
+		return nil, errMalformedChunkedBody
+	}
+
+	header := &awsChunkHeader{size: int(size)}
+	if r.signedChunks {
+		name, value, ok := strings.Cut(extension, "=")
+		if !hasExtension || !ok || name != "chunk-signature" || value == "" {
+			return nil, errMalformedChunkedBody
+		}
+		header.signature = value
+	}
+	return header, nil
+}
+
+func (r *awsChunkedReader) finish(last *awsChunkHeader) error {
+	if r.signer != nil && !r.signer.verify(awsChunkPayloadAlgorithm, emptySHA256, last.signature) {
+		return errChunkSignature
+	}
+
+	trailers := map[string]string{}
+	var canonicalTrailers bytes.Buffer
+	trailerSignature := ""
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return errMalformedChunkedBody
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "x-amz-trailer-signature" {
+			trailerSignature = value
+			continue
+		}
+		trailers[name] = value
+		canonicalTrailers.WriteString(name + ":" + value + "\n")
+	}
+
+	if r.decoded != r.decodedLength {
+		return errMalformedChunkedBody
+	}
+	if r.trailer == "" {
+		return io.EOF
+	}
+
+	if r.signer != nil && !r.signer.verify(awsTrailerAlgorithm, hexSHA256Bytes(canonicalTrailers.Bytes()), trailerSignature) {
+		return errChunkSignature
+	}
+
+	expected, ok := trailers[r.trailer]
+	if !ok {
+		return errMalformedChunkedBody
+	}
+	if base64.StdEncoding.EncodeToString(r.checksum.Sum(nil)) != expected {
+		return errTrailerChecksum
+	}
+	return io.EOF
+}
+
+func (r *awsChunkedReader) readLine() (string, error) {
+	line, err := r.br.ReadSlice('\n')
+	if err != nil {
+		return "", errMalformedChunkedBody
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errMalformedChunkedBody
+	}
+	return string(line[:len(line)-2]), nil
+}
+
+func (r *awsChunkedReader) expectCRLF() error {
+	line, err := r.readLine()
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return errMalformedChunkedBody
+	}
+	return nil
+}
+
+func hexSHA256Bytes(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDecodesSignedStreamingPayload(t *testing.T) {
+	auth := testAuthenticator()
+	req := newStreamingRequest(t, auth, []string{"hello ", "world"}, false)
+
+	if err := auth.Verify(req); err != nil {
+		t.Fatalf("expected valid streaming signature, got %v", err)
+	}
+	if req.ContentLength != int64(len("hello world")) {
+		t.Fatalf("expected decoded content length, got %d", req.ContentLength)
+	}
+	if req.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("expected aws-chunked content encoding to be removed, got %q", req.Header.Get("Content-Encoding"))
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("expected chunks to verify, got %v", err)
+	}
+	if string(body) != "hello world" {
+		t.Fatalf("expected decoded body, got %q", body)
+	}
+}
+
+func TestVerifyRejectsTamperedStreamingChunk(t *testing.T) {
+	auth := testAuthenticator()
+	req := newStreamingRequest(t, auth, []string{"hello ", "world"}, true)
+
+	if err := auth.Verify(req); err != nil {
+		t.Fatalf("expected seed signature to verify, got %v", err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if !errors.Is(err, errChunkSignature) {
+		t.Fatalf("expected chunk signature error, got %v", err)
+	}
+	if strings.Contains(string(body), "w0rld") {
+		t.Fatal("expected tampered chunk to be withheld")
+	}
+}
+
+func TestInstallAWSChunkedReaderVerifiesUnsignedTrailer(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		checksum string
+		wantErr  error
+	}{
+		{name: "valid", checksum: crc32Base64("hello world")},
+		{name: "mismatch", checksum: crc32Base64("hello there"), wantErr: errTrailerChecksum},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body := "6\r\nhello \r\n5\r\nworld\r\n0\r\nx-amz-checksum-crc32:" + tc.checksum + "\r\n\r\n"
+			req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/bucket/file.txt", strings.NewReader(body))
+			req.Header.Set("X-Amz-Content-Sha256", streamingUnsignedPayloadTrailer)
+			req.Header.Set("X-Amz-Decoded-Content-Length", "11")
+			req.Header.Set("X-Amz-Trailer", "x-amz-checksum-crc32")
+			req.Header.Set("Content-Encoding", "aws-chunked,gzip")
+
+			if err := installAWSChunkedReader(req, nil); err != nil {
+				t.Fatal(err)
+			}
+			if req.Header.Get("Content-Encoding") != "gzip" {
+				t.Fatalf("expected remaining content encoding to be preserved, got %q", req.Header.Get("Content-Encoding"))
+			}
+			decoded, err := io.ReadAll(req.Body)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr == nil && string(decoded) != "hello world" {
+				t.Fatalf("expected decoded body, got %q", decoded)
+			}
+			if tc.wantErr != nil && len(decoded) == 11 {
+				t.Fatal("expected final chunk to be withheld when trailer verification fails")
+			}
+		})
+	}
+}
+
+func newStreamingRequest(t *testing.T, auth *s3SignatureAuthenticator, chunks []string, tamper bool) *http.Request {
+	t.Helper()
+
+	decodedLength := 0
+	for _, chunk := range chunks {
+		decodedLength += len(chunk)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/bucket/path/file.txt", nil)
+	req.Host = req.URL.Host
+	req.Header.Set("X-Amz-Date", "20260517T163000Z")
+	req.Header.Set("X-Amz-Content-Sha256", streamingSignedPayload)
+	req.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(decodedLength))
+	req.Header.Set("Content-Encoding", "aws-chunked")
+
+	scope := "20260517/us-east-1/s3/aws4_request"
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date", "x-amz-decoded-content-length"}
+	canonicalRequest, err := buildCanonicalRequest(req, signedHeaders, "", streamingSignedPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedSignature := auth.credentials["proxy-access"].signature("20260517T163000Z", scope, canonicalRequest)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=proxy-access/"+scope+", SignedHeaders="+strings.Join(signedHeaders, ";")+", Signature="+seedSignature)
+
+	signer := &chunkSigner{
+		signingKey:    auth.credentials["proxy-access"].signingKey(scope),
+		amzDate:       "20260517T163000Z",
+		scope:         scope,
+		prevSignature: seedSignature,
+	}
+	var body bytes.Buffer
+	for i, chunk := range append(chunks, "") {
+		signature := signer.next(awsChunkPayloadAlgorithm, hexSHA256(chunk))
+		signer.prevSignature = signature
+		if tamper && i == len(chunks)-1 {
+			chunk = strings.Replace(chunk, "o", "0", 1)
+		}
+		fmt.Fprintf(&body, "%x;chunk-signature=%s\r\n%s\r\n", len(chunk), signature, chunk)
+	}
+	req.Body = io.NopCloser(&body)
+	req.ContentLength = int64(body.Len())
+	return req
+}
+
+func crc32Base64(value string) string {
+	sum := crc32.ChecksumIEEE([]byte(value))
+	return base64.StdEncoding.EncodeToString([]byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ipAllowList 是由单个 IP 和 CIDR 网段组成的地址列表，同时支持 IPv4 和 IPv6。
+type ipAllowList []*net.IPNet
+
+func parseIPAllowList(entries []string) (ipAllowList, error) {
+	list := make(ipAllowList, 0, len(entries))
+	for _, entry := range entries {
+		network := parsePolicyNetwork(entry)
+		if network == nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR %q", entry)
+		}
+		list = append(list, network)
+	}
+	return list, nil
+}
+
+func (l ipAllowList) contains(value string) bool {
+	ip := net.ParseIP(value)
+	return ip != nil && l.containsIP(ip)
+}
+
+func (l ipAllowList) containsIP(ip net.IP) bool {
+	for _, network := range l {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l ipAllowList) strings() []string {
+	values := make([]string, len(l))
+	for i, network := range l {
+		values[i] = network.String()
+	}
+	return values
+}
+
+// secureTransport 判断客户端是否通过 HTTPS 访问。TLS 在反向代理终止时以 X-Forwarded-Proto 为准，
+// 但只有 TCP 对端属于可信代理时才采信该头部，否则任何客户端都可以伪造 aws:SecureTransport。
+func secureTransport(r *http.Request, trustedProxies ipAllowList) bool {
+	if r.TLS != nil {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || !trustedProxies.contains(host) {
+		return false
+	}
+	return strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+const (
+	proxyProtocolHeaderTimeout = 5 * time.Second
+	maxProxyProtocolV1Line     = 107
+)
+
+var (
+	proxyProtocolV1Prefix = []byte("PROXY ")
+	proxyProtocolV2Sig    = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+)
+
+// proxyProtocolListener 只对来自可信代理的连接解析 PROXY protocol (v1/v2) 头部，
+// 其他来源的连接原样交给 HTTP 服务器处理，防止客户端伪造来源地址。
+type proxyProtocolListener struct {
+	net.Listener
+	trusted ipAllowList
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !l.trusted.containsIP(addr.IP) {
+		return conn, nil
+	}
+	return &proxyProtocolConn{Conn: conn, br: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtocolConn 在首次读取或获取远端地址时解析 PROXY 头部，解析在连接自己的 goroutine 中进行，不会阻塞 Accept。
+type proxyProtocolConn struct {
+	net.Conn
+	br *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolHeaderTimeout))
+		c.remote, c.err = readProxyProtocolHeader(c.br)
+		c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+func (c *proxyProtocolConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(p)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyProtocolHeader 读取连接开头的 PROXY 头部并返回其中的客户端地址。
+// 连接没有携带头部、或头部声明为 LOCAL/UNKNOWN 时返回 nil 地址。
+func readProxyProtocolHeader(br *bufio.Reader) (net.Addr, error) {
+	prefix, _ := br.Peek(len(proxyProtocolV2Sig))
+	switch {
+	case bytes.HasPrefix(prefix, proxyProtocolV1Prefix):
+		return readProxyProtocolV1(br)
+	case bytes.Equal(prefix, proxyProtocolV2Sig):
+		return readProxyProtocolV2(br)
+	}
+	return nil, nil
+}
+
+func readProxyProtocolV1(br *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < maxProxyProtocolV1Line {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, errInvalidProxyHeader
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errInvalidProxyHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errInvalidProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, errInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyProtocolV2(br *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, errInvalidProxyHeader
+	}
+	if header[12]>>4 != 2 {
+		return nil, errInvalidProxyHeader
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, errInvalidProxyHeader
+	}
+
+	command, family := header[12]&0x0f, header[13]
+	if command == 0x0 {
+		return nil, nil
+	}
+	if command != 0x1 {
+		return nil, errInvalidProxyHeader
+	}
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errInvalidProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errInvalidProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	return nil, nil
+}
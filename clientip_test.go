@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIPAllowListSupportsCIDRAndIPv6(t *testing.T) {
+	list, err := parseIPAllowList([]string{"10.0.0.0/8", "198.51.100.7", "2001:db8::/32", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{
+		"10.20.30.40":   true,
+		"198.51.100.7":  true,
+		"198.51.100.8":  false,
+		"2001:db8::1":   true,
+		"2001:db9::1":   false,
+		"::1":           true,
+		"not-an-ip":     false,
+		"::ffff:10.1.1": false,
+	} {
+		if got := list.contains(ip); got != want {
+			t.Errorf("contains(%q) = %t, want %t", ip, got, want)
+		}
+	}
+
+	if _, err := parseIPAllowList([]string{"10.0.0.0/40"}); err == nil {
+		t.Fatal("expected invalid CIDR to be rejected")
+	}
+}
+
+func TestReadProxyProtocolHeader(t *testing.T) {
+	v2 := bytes.NewBuffer(append([]byte(nil), proxyProtocolV2Sig...))
+	v2.Write([]byte{0x21, 0x11})
+	binary.Write(v2, binary.BigEndian, uint16(12))
+	v2.Write([]byte{203, 0, 113, 10, 10, 0, 0, 1})
+	binary.Write(v2, binary.BigEndian, uint16(51000))
+	binary.Write(v2, binary.BigEndian, uint16(8080))
+
+	for _, tc := range []struct {
+		name    string
+		input   string
+		remote  string
+		wantErr bool
+	}{
+		{name: "v1 tcp4", input: "PROXY TCP4 203.0.113.10 10.0.0.1 51000 8080\r\nGET / HTTP/1.1\r\n", remote: "203.0.113.10:51000"},
+		{name: "v1 tcp6", input: "PROXY TCP6 2001:db8::10 2001:db8::1 51000 8080\r\nGET / HTTP/1.1\r\n", remote: "[2001:db8::10]:51000"},
+		{name: "v1 unknown", input: "PROXY UNKNOWN\r\nGET / HTTP/1.1\r\n"},
+		{name: "v1 malformed", input: "PROXY TCP4 nope\r\nGET / HTTP/1.1\r\n", wantErr: true},
+		{name: "v2 tcp4", input: v2.String() + "GET / HTTP/1.1\r\n", remote: "203.0.113.10:51000"},
+		{name: "no header", input: "GET / HTTP/1.1\r\nHost: example.com\r\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tc.input))
+			addr, err := readProxyProtocolHeader(br)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected malformed header to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.remote == "" && addr != nil || tc.remote != "" && (addr == nil || addr.String() != tc.remote) {
+				t.Fatalf("expected remote %q, got %v", tc.remote, addr)
+			}
+			rest, _ := br.ReadString('\n')
+			if !strings.HasPrefix(rest, "GET / HTTP/1.1") {
+				t.Fatalf("expected HTTP request to follow the header, got %q", rest)
+			}
+		})
+	}
+}
+
+func TestProxyProtocolListenerOnlyTrustsConfiguredPeers(t *testing.T) {
+	trusted, err := parseIPAllowList([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := &proxyProtocolListener{Listener: inner, trusted: trusted}
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err == nil {
+			conn.Write([]byte("PROXY TCP4 203.0.113.10 127.0.0.1 51000 8080\r\nGET / HTTP/1.1\r\n\r\n"))
+			conn.Close()
+		}
+	}()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := conn.RemoteAddr().String(); got != "203.0.113.10:51000" {
+		t.Fatalf("expected PROXY header address from trusted peer, got %s", got)
+	}
+}
+
+func TestWriteAccessMiddlewareIgnoresSpoofedClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		name    string
+		trusted []string
+		status  int
+	}{
+		{name: "untrusted peer", status: http.StatusForbidden},
+		{name: "trusted peer", trusted: []string{"192.0.2.0/24"}, status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.RemoteIPHeaders = []string{"X-Real-IP", "X-Forwarded-For"}
+			if err := router.SetTrustedProxies(tc.trusted); err != nil {
+				t.Fatal(err)
+			}
+			router.Use(writeAccessMiddleware(defaultBucketPolicy([]string{"198.51.100.0/24"}, nil), nil, nil, "", nil))
+			router.PUT("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/bucket/a.txt", strings.NewReader("hello"))
+			req.RemoteAddr = "192.0.2.1:40000"
+			req.Header.Set("X-Real-IP", "198.51.100.7")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestWriteAccessMiddlewareIgnoresSpoofedSecureTransport(t *testing.T) {
+	var document policyDocument
+	if err := json.Unmarshal([]byte(`{
+		"Version": "2012-10-17",
+		"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*",
+			"Condition": {"Bool": {"aws:SecureTransport": "true"}}}]
+	}`), &document); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := newBucketPolicy(&document, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		trusted ipAllowList
+		status  int
+	}{
+		{name: "untrusted peer", status: http.StatusForbidden},
+		{name: "trusted peer", trusted: ipAllowList{parsePolicyNetwork("192.0.2.0/24")}, status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://s3.example.com/bucket/a.txt", nil)
+			req.RemoteAddr = "192.0.2.1:40000"
+			req.Header.Set("X-Forwarded-Proto", "https")
+			recorder := httptest.NewRecorder()
+
+			writeAccessMiddleware(policy, nil, nil, "", tc.trusted)(newTestContext(recorder, req))
+
+			if recorder.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, recorder.Code)
+			}
+		})
+	}
+}
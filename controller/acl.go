@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+const xmlSchemaInstanceNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// maxACLRequestBodySize 限制 PutObjectAcl 请求体的大小，S3 单个 ACL 最多 100 条授权。
+const maxACLRequestBodySize = 64 << 10
+
+// cosObjectCannedACLs 将 S3 的预设 ACL 映射为 COS 对象的预设 ACL。
+// COS 对象不支持 public-read-write、aws-exec-read 和 log-delivery-write，这些值没有对应项。
+var cosObjectCannedACLs = map[string]string{
+	"private":                   "private",
+	"public-read":               "public-read",
+	"authenticated-read":        "authenticated-read",
+	"bucket-owner-read":         "bucket-owner-read",
+	"bucket-owner-full-control": "bucket-owner-full-control",
+}
+
+// cosGroupURIs 将 S3 预定义用户组的 URI 映射为 COS 预定义用户组的 URI。
+var cosGroupURIs = map[string]string{
+	"http://acs.amazonaws.com/groups/global/AllUsers":           "http://cam.qcloud.com/groups/global/AllUsers",
+	"http://acs.amazonaws.com/groups/global/AuthenticatedUsers": "http://cam.qcloud.com/groups/global/AuthenticatedUsers",
+}
+
+// s3GrantHeaders 是 S3 通过请求头授权的头部及其对应的 COS 头部字段。
+var s3GrantHeaders = []struct {
+	header string
+	set    func(opt *cos.ACLHeaderOptions, value string)
+}{
+	{header: "x-amz-grant-read", set: func(opt *cos.ACLHeaderOptions, value string) { opt.XCosGrantRead = value }},
+	{header: "x-amz-grant-write", set: func(opt *cos.ACLHeaderOptions, value string) { opt.XCosGrantWrite = value }},
+	{header: "x-amz-grant-full-control", set: func(opt *cos.ACLHeaderOptions, value string) { opt.XCosGrantFullControl = value }},
+}
+
+var errACLHeaderConflict = errors.New("specifying both Canned ACLs and Header Grants is not allowed")
+
+type s3Grantee struct {
+	XMLNSXSI    string `xml:"xmlns:xsi,attr"`
+	Type        string `xml:"xsi:type,attr"`
+	ID          string `xml:"ID,omitempty"`
+	DisplayName string `xml:"DisplayName,omitempty"`
+	URI         string `xml:"URI,omitempty"`
+}
+
+type s3Grant struct {
+	Grantee    s3Grantee `xml:"Grantee"`
+	Permission string    `xml:"Permission"`
+}
+
+type s3AccessControlPolicy struct {
+	XMLName xml.Name  `xml:"AccessControlPolicy"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Owner   s3Owner   `xml:"Owner"`
+	Grants  []s3Grant `xml:"AccessControlList>Grant"`
+}
+
+// s3AccessControlPolicyInput 用于解析客户端提交的 ACL，xsi:type 属性在解析时只能按本地名 type 匹配。
+type s3AccessControlPolicyInput struct {
+	Owner  s3Owner `xml:"Owner"`
+	Grants []struct {
+		Grantee struct {
+			Type         string `xml:"type,attr"`
+			ID           string `xml:"ID"`
+			DisplayName  string `xml:"DisplayName"`
+			URI          string `xml:"URI"`
+			EmailAddress string `xml:"EmailAddress"`
+		} `xml:"Grantee"`
+		Permission string `xml:"Permission"`
+	} `xml:"AccessControlList>Grant"`
+}
+
+// cosACLHeaderFromS3 将 x-amz-acl 以及 x-amz-grant-* 头部转换为 COS 的 ACL 头部，没有携带 ACL 时返回 nil。
+func cosACLHeaderFromS3(header http.Header) (*cos.ACLHeaderOptions, error) {
+	var opt *cos.ACLHeaderOptions
+	if canned := header.Get("x-amz-acl"); canned != "" {
+		cosACL, ok := cosObjectCannedACLs[canned]
+		if !ok {
+			return nil, fmt.Errorf("the canned ACL %q is not supported", canned)
+		}
+		opt = &cos.ACLHeaderOptions{XCosACL: cosACL}
+	}
+
+	for _, grant := range s3GrantHeaders {
+		value := header.Get(grant.header)
+		if value == "" {
+			continue
+		}
+		if opt != nil && opt.XCosACL != "" {
+			return nil, errACLHeaderConflict
+		}
+		grantees, err := cosGranteesFromS3(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", grant.header, err)
+		}
+		if opt == nil {
+			opt = &cos.ACLHeaderOptions{}
+		}
+		grant.set(opt, grantees)
+	}
+	for _, name := range []string{"x-amz-grant-read-acp", "x-amz-grant-write-acp"} {
+		if header.Get(name) != "" {
+			return nil, fmt.Errorf("the %s header is not supported", name)
+		}
+	}
+	return opt, nil
+}
+
+// cosGranteesFromS3 转换 `id="...", uri="..."` 形式的被授权者列表，COS 不支持按邮箱授权。
+func cosGranteesFromS3(value string) (string, error) {
+	var grantees []string
+	for _, item := range strings.Split(value, ",") {
+		kind, grantee, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return "", fmt.Errorf("invalid grantee %q", item)
+		}
+		grantee = strings.Trim(grantee, `"`)
+		switch strings.ToLower(kind) {
+		case "id":
+			grantees = append(grantees, `id="`+grantee+`"`)
+		case "uri":
+			uri, ok := cosGroupURIs[grantee]
+			if !ok {
+				return "", fmt.Errorf("unsupported group %q", grantee)
+			}
+			grantees = append(grantees, `uri="`+uri+`"`)
+		default:
+			return "", fmt.Errorf("unsupported grantee type %q", kind)
+		}
+	}
+	return strings.Join(grantees, ","), nil
+}
+
+// s3AccessControlPolicyFromCOS 将 COS 返回的 AccessControlPolicy 转换为 S3 的格式，
+// COS 用户组的 URI 会替换为对应的 S3 用户组 URI。
+func s3AccessControlPolicyFromCOS(acl *cos.ACLXml) s3AccessControlPolicy {
+	policy := s3AccessControlPolicy{XMLNS: s3XMLNamespace}
+	if owner := toS3Owner(acl.Owner); owner != nil {
+		policy.Owner = *owner
+	}
+	for _, grant := range acl.AccessControlList {
+		if grant.Grantee == nil {
+			continue
+		}
+		grantee := s3Grantee{XMLNSXSI: xmlSchemaInstanceNamespace, Type: "CanonicalUser", ID: grant.Grantee.ID, DisplayName: grant.Grantee.DisplayName}
+		if grant.Grantee.URI != "" {
+			grantee = s3Grantee{XMLNSXSI: xmlSchemaInstanceNamespace, Type: "Group", URI: grant.Grantee.URI}
+			for s3URI, cosURI := range cosGroupURIs {
+				if cosURI == grant.Grantee.URI {
+					grantee.URI = s3URI
+				}
+			}
+		}
+		policy.Grants = append(policy.Grants, s3Grant{Grantee: grantee, Permission: grant.Permission})
+	}
+	return policy
+}
+
+// cosACLFromS3 将客户端提交的 S3 AccessControlPolicy 转换为 COS 的格式。
+func cosACLFromS3(body []byte) (*cos.ACLXml, error) {
+	var input s3AccessControlPolicyInput
+	if err := xml.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	if input.Owner.ID == "" {
+		return nil, errors.New("the ACL must specify an owner")
+	}
+
+	acl := &cos.ACLXml{Owner: &cos.Owner{ID: input.Owner.ID, DisplayName: input.Owner.DisplayName}}
+	for _, grant := range input.Grants {
+		switch grant.Permission {
+		case "FULL_CONTROL", "READ", "WRITE", "READ_ACP", "WRITE_ACP":
+		default:
+			return nil, fmt.Errorf("invalid permission %q", grant.Permission)
+		}
+		grantee := &cos.ACLGrantee{Type: grant.Grantee.Type}
+		switch grant.Grantee.Type {
+		case "CanonicalUser":
+			grantee.ID = grant.Grantee.ID
+			grantee.DisplayName = grant.Grantee.DisplayName
+		case "Group":
+			uri, ok := cosGroupURIs[grant.Grantee.URI]
+			if !ok {
+				return nil, fmt.Errorf("unsupported group %q", grant.Grantee.URI)
+			}
+			grantee.URI = uri
+		default:
+			return nil, fmt.Errorf("unsupported grantee type %q", grant.Grantee.Type)
+		}
+		acl.AccessControlList = append(acl.AccessControlList, cos.ACLGrant{Grantee: grantee, Permission: grant.Permission})
+	}
+	return acl, nil
+}
+
+// writeAccessControlPolicy 以 S3 的 XML 格式返回 COS 的 ACL。
+func writeAccessControlPolicy(c *gin.Context, operation string, acl *cos.ACLXml) {
+	encoded, err := xml.MarshalIndent(s3AccessControlPolicyFromCOS(acl), "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal " + operation + " response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// GetBucketAcl 处理 S3 的 GET Bucket acl 请求。
+// GET /{bucket}?acl
+func (ctrl *S3Controller) GetBucketAcl(c *gin.Context) {
+	result, resp, err := ctrl.cosClient(c).Bucket.GetACL(c.Request.Context())
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("GetBucketAcl", resp)
+
+	writeAccessControlPolicy(c, "GetBucketAcl", (*cos.ACLXml)(result))
+}
+
+// GetObjectAcl 处理 S3 的 GET Object acl 请求。
+// GET /{bucket}/{key}?acl
+func (ctrl *S3Controller) GetObjectAcl(c *gin.Context) {
+	_, key := ctrl.extractBucketAndKey(c)
+	if key == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	result, resp, err := ctrl.cosClient(c).Object.GetACL(c.Request.Context(), key)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("GetObjectAcl", resp)
+
+	writeAccessControlPolicy(c, "GetObjectAcl", (*cos.ACLXml)(result))
+}
+
+// PutObjectAcl 处理 S3 的 PUT Object acl 请求，ACL 可以通过预设 ACL/授权头部或请求体中的 XML 提交，二者只能选其一。
+// PUT /{bucket}/{key}?acl
+func (ctrl *S3Controller) PutObjectAcl(c *gin.Context) {
+	_, key := ctrl.extractBucketAndKey(c)
+	if key == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	header, err := cosACLHeaderFromS3(c.Request.Header)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxACLRequestBodySize+1))
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	if len(body) > maxACLRequestBodySize {
+		writeS3Error(c, http.StatusBadRequest, "MalformedACLError", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+	if err := verifyRequestBody(c); err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+
+	opt := &cos.ObjectPutACLOptions{Header: header}
+	switch {
+	case header != nil && len(body) > 0:
+		writeS3Error(c, http.StatusBadRequest, "UnexpectedContent", "This request does not support content when ACL headers are specified")
+		return
+	case header == nil && len(body) == 0:
+		writeS3Error(c, http.StatusBadRequest, "MissingSecurityHeader", "Your request was missing a required header: x-amz-acl")
+		return
+	case len(body) > 0:
+		opt.Body, err = cosACLFromS3(body)
+		if err != nil {
+			writeS3Error(c, http.StatusBadRequest, "MalformedACLError", err.Error())
+			return
+		}
+	}
+
+	resp, err := ctrl.cosClient(c).Object.PutACL(c.Request.Context(), key, opt)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("PutObjectAcl", resp)
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,619 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// maxBucketConfigurationBodySize 限制存储桶配置 (CORS、生命周期、策略、静态网站) 请求体的大小，与 COS 的 64 KB 上限一致。
+const maxBucketConfigurationBodySize = 64 << 10
+
+// maxCORSRules 是 S3 允许的 CORS 规则数量上限。
+const maxCORSRules = 100
+
+// dispatchBucketConfiguration 将存储桶配置子资源的 GET/PUT/DELETE 请求分发给对应的处理函数，这些子资源只存在于存储桶级别。
+func (ctrl *S3Controller) dispatchBucketConfiguration(c *gin.Context, key string, get, put, remove gin.HandlerFunc) {
+	if key != "" {
+		c.XML(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed."})
+		return
+	}
+	switch c.Request.Method {
+	case "GET":
+		get(c)
+	case "PUT":
+		put(c)
+	case "DELETE":
+		remove(c)
+	default:
+		c.XML(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed."})
+	}
+}
+
+// readBucketConfiguration 读取存储桶配置请求的请求体，客户端提供了 Content-MD5 或 x-amz-checksum-* 时同时校验，失败时写入错误响应。
+func (ctrl *S3Controller) readBucketConfiguration(c *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBucketConfigurationBodySize+1))
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return nil, false
+	}
+	if len(body) > maxBucketConfigurationBodySize {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return nil, false
+	}
+	if err := verifyRequestBody(c); err != nil {
+		ctrl.handleCOSError(c, err)
+		return nil, false
+	}
+	// 旧版 S3 API 要求这些请求携带 Content-MD5，新版 SDK 改用 x-amz-checksum-*，两者都没有时只依赖签名中的摘要
+	if code, message := verifyRequestBodyChecksum(c.Request.Header, body); code == "BadDigest" {
+		writeS3Error(c, http.StatusBadRequest, code, message)
+		return nil, false
+	}
+	return body, true
+}
+
+// readBucketConfigurationXML 读取存储桶配置请求体并解析到 v 中，失败时写入错误响应。
+func (ctrl *S3Controller) readBucketConfigurationXML(c *gin.Context, v interface{}) bool {
+	body, ok := ctrl.readBucketConfiguration(c)
+	if !ok {
+		return false
+	}
+	if err := xml.Unmarshal(body, v); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return false
+	}
+	return true
+}
+
+// writeBucketConfiguration 以 S3 命名空间返回存储桶配置的 XML 响应。
+func writeBucketConfiguration(c *gin.Context, operation string, payload interface{}) {
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal " + operation + " response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// finishBucketConfiguration 记录 COS 响应并返回 status，用于没有响应体的 PUT/DELETE 请求。
+func (ctrl *S3Controller) finishBucketConfiguration(c *gin.Context, operation string, resp *cos.Response, err error, status int) {
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	if resp != nil {
+		if resp.Body != nil {
+			defer resp.Body.Close()
+		}
+		logCOSResponse(operation, resp)
+	}
+	c.Status(status)
+}
+
+// s3CORSConfiguration 是 S3 的 CORS 配置，COS 的 CORS 规则与 S3 字段相同。
+type s3CORSConfiguration struct {
+	XMLName xml.Name     `xml:"CORSConfiguration"`
+	XMLNS   string       `xml:"xmlns,attr,omitempty"`
+	Rules   []s3CORSRule `xml:"CORSRule"`
+}
+
+type s3CORSRule struct {
+	ID             string   `xml:"ID,omitempty"`
+	AllowedHeaders []string `xml:"AllowedHeader,omitempty"`
+	AllowedMethods []string `xml:"AllowedMethod"`
+	AllowedOrigins []string `xml:"AllowedOrigin"`
+	ExposeHeaders  []string `xml:"ExposeHeader,omitempty"`
+	MaxAgeSeconds  int      `xml:"MaxAgeSeconds,omitempty"`
+}
+
+// validateCORSRules 按照 S3 的规则校验 CORS 配置：每条规则至少包含一个来源和一个方法，方法只能是 GET、PUT、POST、DELETE 或 HEAD。
+func validateCORSRules(rules []s3CORSRule) error {
+	if len(rules) == 0 || len(rules) > maxCORSRules {
+		return fmt.Errorf("a CORS configuration must contain between 1 and %d rules", maxCORSRules)
+	}
+	for _, rule := range rules {
+		if len(rule.AllowedOrigins) == 0 || len(rule.AllowedMethods) == 0 {
+			return errors.New("each CORS rule must specify at least one AllowedOrigin and one AllowedMethod")
+		}
+		for _, method := range rule.AllowedMethods {
+			switch method {
+			case "GET", "PUT", "POST", "DELETE", "HEAD":
+			default:
+				return fmt.Errorf("found unsupported HTTP method in CORS config. Unsupported method is %s", method)
+			}
+		}
+		if rule.MaxAgeSeconds < 0 {
+			return errors.New("MaxAgeSeconds must not be negative")
+		}
+	}
+	return nil
+}
+
+// GetBucketCors 处理 S3 的 GET Bucket cors 请求。
+// GET /{bucket}?cors
+func (ctrl *S3Controller) GetBucketCors(c *gin.Context) {
+	result, resp, err := ctrl.cosClient(c).Bucket.GetCORS(c.Request.Context())
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("GetBucketCors", resp)
+
+	payload := s3CORSConfiguration{XMLNS: s3XMLNamespace}
+	for _, rule := range result.Rules {
+		payload.Rules = append(payload.Rules, s3CORSRule{
+			ID:             rule.ID,
+			AllowedHeaders: rule.AllowedHeaders,
+			AllowedMethods: rule.AllowedMethods,
+			AllowedOrigins: rule.AllowedOrigins,
+			ExposeHeaders:  rule.ExposeHeaders,
+			MaxAgeSeconds:  rule.MaxAgeSeconds,
+		})
+	}
+	writeBucketConfiguration(c, "GetBucketCors", payload)
+}
+
+// PutBucketCors 处理 S3 的 PUT Bucket cors 请求，新的配置会整体替换原有的 CORS 规则。
+// PUT /{bucket}?cors
+func (ctrl *S3Controller) PutBucketCors(c *gin.Context) {
+	var configuration s3CORSConfiguration
+	if !ctrl.readBucketConfigurationXML(c, &configuration) {
+		return
+	}
+	if err := validateCORSRules(configuration.Rules); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	opt := &cos.BucketPutCORSOptions{}
+	for _, rule := range configuration.Rules {
+		opt.Rules = append(opt.Rules, cos.BucketCORSRule{
+			ID:             rule.ID,
+			AllowedHeaders: rule.AllowedHeaders,
+			AllowedMethods: rule.AllowedMethods,
+			AllowedOrigins: rule.AllowedOrigins,
+			ExposeHeaders:  rule.ExposeHeaders,
+			MaxAgeSeconds:  rule.MaxAgeSeconds,
+		})
+	}
+	resp, err := ctrl.cosClient(c).Bucket.PutCORS(c.Request.Context(), opt)
+	ctrl.finishBucketConfiguration(c, "PutBucketCors", resp, err, http.StatusOK)
+}
+
+// DeleteBucketCors 处理 S3 的 DELETE Bucket cors 请求。
+// DELETE /{bucket}?cors
+func (ctrl *S3Controller) DeleteBucketCors(c *gin.Context) {
+	resp, err := ctrl.cosClient(c).Bucket.DeleteCORS(c.Request.Context())
+	ctrl.finishBucketConfiguration(c, "DeleteBucketCors", resp, err, http.StatusNoContent)
+}
+
+// s3LifecycleConfiguration 是 S3 的生命周期配置。COS 的生命周期规则与 S3 结构相同，但对象大小条件只能写在 And 中，
+// 存储类型需要在两者的取值之间转换。
+type s3LifecycleConfiguration struct {
+	XMLName xml.Name          `xml:"LifecycleConfiguration"`
+	XMLNS   string            `xml:"xmlns,attr,omitempty"`
+	Rules   []s3LifecycleRule `xml:"Rule"`
+}
+
+type s3LifecycleRule struct {
+	ID     string `xml:"ID,omitempty"`
+	Status string `xml:"Status"`
+	// Prefix 是旧版 API 在规则上直接指定的前缀，新版 API 使用 Filter
+	Prefix                         *string                              `xml:"Prefix"`
+	Filter                         *s3LifecycleFilter                   `xml:"Filter"`
+	Transitions                    []s3LifecycleTransition              `xml:"Transition"`
+	Expiration                     *s3LifecycleExpiration               `xml:"Expiration"`
+	NoncurrentVersionTransitions   []s3NoncurrentVersionLifecycle       `xml:"NoncurrentVersionTransition"`
+	NoncurrentVersionExpiration    *s3NoncurrentVersionLifecycle        `xml:"NoncurrentVersionExpiration"`
+	AbortIncompleteMultipartUpload *s3LifecycleAbortIncompleteMultipart `xml:"AbortIncompleteMultipartUpload"`
+}
+
+// s3LifecycleFilter 中的 Prefix、Tag、对象大小和 And 只能出现一个，Filter 为空表示匹配所有对象。
+type s3LifecycleFilter struct {
+	Prefix                *string         `xml:"Prefix"`
+	Tag                   *s3LifecycleTag `xml:"Tag"`
+	ObjectSizeGreaterThan int64           `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64           `xml:"ObjectSizeLessThan,omitempty"`
+	And                   *s3LifecycleAnd `xml:"And"`
+}
+
+type s3LifecycleAnd struct {
+	Prefix                string           `xml:"Prefix,omitempty"`
+	Tags                  []s3LifecycleTag `xml:"Tag"`
+	ObjectSizeGreaterThan int64            `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64            `xml:"ObjectSizeLessThan,omitempty"`
+}
+
+type s3LifecycleTag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type s3LifecycleTransition struct {
+	Date         string `xml:"Date,omitempty"`
+	Days         int    `xml:"Days,omitempty"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3LifecycleExpiration struct {
+	Date                      string `xml:"Date,omitempty"`
+	Days                      int    `xml:"Days,omitempty"`
+	ExpiredObjectDeleteMarker bool   `xml:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+type s3NoncurrentVersionLifecycle struct {
+	NoncurrentDays          int    `xml:"NoncurrentDays"`
+	StorageClass            string `xml:"StorageClass,omitempty"`
+	NewerNoncurrentVersions int    `xml:"NewerNoncurrentVersions,omitempty"`
+}
+
+type s3LifecycleAbortIncompleteMultipart struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+var errLifecycleNotSupported = errors.New("COS lifecycle rules do not support NewerNoncurrentVersions")
+
+// cosLifecycleFilter 将 S3 的过滤条件转换为 COS 的过滤条件，COS 的对象大小条件只能写在 And 中。
+func cosLifecycleFilter(filter *s3LifecycleFilter) (*cos.BucketLifecycleFilter, error) {
+	conditions := 0
+	for _, set := range []bool{filter.Prefix != nil, filter.Tag != nil, filter.ObjectSizeGreaterThan != 0 || filter.ObjectSizeLessThan != 0, filter.And != nil} {
+		if set {
+			conditions++
+		}
+	}
+	if conditions > 1 {
+		return nil, errors.New("Filter must contain only one of Prefix, Tag, object size conditions or And")
+	}
+
+	result := &cos.BucketLifecycleFilter{}
+	switch {
+	case filter.Prefix != nil:
+		result.Prefix = *filter.Prefix
+	case filter.Tag != nil:
+		result.Tag = &cos.BucketTaggingTag{Key: filter.Tag.Key, Value: filter.Tag.Value}
+	case filter.ObjectSizeGreaterThan != 0 || filter.ObjectSizeLessThan != 0:
+		result.And = &cos.BucketLifecycleAndOperator{
+			ObjectSizeGreaterThan: filter.ObjectSizeGreaterThan,
+			ObjectSizeLessThan:    filter.ObjectSizeLessThan,
+		}
+	case filter.And != nil:
+		result.And = &cos.BucketLifecycleAndOperator{
+			Prefix:                filter.And.Prefix,
+			ObjectSizeGreaterThan: filter.And.ObjectSizeGreaterThan,
+			ObjectSizeLessThan:    filter.And.ObjectSizeLessThan,
+		}
+		for _, tag := range filter.And.Tags {
+			result.And.Tag = append(result.And.Tag, cos.BucketTaggingTag{Key: tag.Key, Value: tag.Value})
+		}
+	}
+	return result, nil
+}
+
+// s3LifecycleFilterFromCOS 将 COS 的过滤条件转换为 S3 的过滤条件，只包含对象大小的 And 还原为单独的大小条件。
+func s3LifecycleFilterFromCOS(filter *cos.BucketLifecycleFilter) *s3LifecycleFilter {
+	result := &s3LifecycleFilter{}
+	switch {
+	case filter == nil:
+		result.Prefix = new(string)
+	case filter.Tag != nil:
+		result.Tag = &s3LifecycleTag{Key: filter.Tag.Key, Value: filter.Tag.Value}
+	case filter.And != nil && filter.And.Prefix == "" && len(filter.And.Tag) == 0:
+		result.ObjectSizeGreaterThan = filter.And.ObjectSizeGreaterThan
+		result.ObjectSizeLessThan = filter.And.ObjectSizeLessThan
+	case filter.And != nil:
+		result.And = &s3LifecycleAnd{
+			Prefix:                filter.And.Prefix,
+			ObjectSizeGreaterThan: filter.And.ObjectSizeGreaterThan,
+			ObjectSizeLessThan:    filter.And.ObjectSizeLessThan,
+		}
+		for _, tag := range filter.And.Tag {
+			result.And.Tags = append(result.And.Tags, s3LifecycleTag{Key: tag.Key, Value: tag.Value})
+		}
+	default:
+		result.Prefix = &filter.Prefix
+	}
+	return result
+}
+
+// cosLifecycleRule 将 S3 的生命周期规则转换为 COS 的规则，COS 不支持的条件返回 errLifecycleNotSupported。
+func cosLifecycleRule(rule s3LifecycleRule) (cos.BucketLifecycleRule, error) {
+	result := cos.BucketLifecycleRule{ID: rule.ID, Status: rule.Status}
+	if rule.Status != "Enabled" && rule.Status != "Disabled" {
+		return result, fmt.Errorf("lifecycle rule %q: Status must be Enabled or Disabled", rule.ID)
+	}
+
+	switch {
+	case rule.Prefix != nil && rule.Filter != nil:
+		return result, fmt.Errorf("lifecycle rule %q: Prefix and Filter cannot be used together", rule.ID)
+	case rule.Prefix != nil:
+		result.Filter = &cos.BucketLifecycleFilter{Prefix: *rule.Prefix}
+	case rule.Filter != nil:
+		filter, err := cosLifecycleFilter(rule.Filter)
+		if err != nil {
+			return result, fmt.Errorf("lifecycle rule %q: %w", rule.ID, err)
+		}
+		result.Filter = filter
+	default:
+		result.Filter = &cos.BucketLifecycleFilter{}
+	}
+
+	for _, transition := range rule.Transitions {
+		storageClass, err := cosStorageClassFromS3(transition.StorageClass)
+		if err != nil || storageClass == "" {
+			return result, fmt.Errorf("lifecycle rule %q: invalid transition storage class %q", rule.ID, transition.StorageClass)
+		}
+		result.Transition = append(result.Transition, cos.BucketLifecycleTransition{Date: transition.Date, Days: transition.Days, StorageClass: storageClass})
+	}
+	if expiration := rule.Expiration; expiration != nil {
+		result.Expiration = &cos.BucketLifecycleExpiration{
+			Date:                      expiration.Date,
+			Days:                      expiration.Days,
+			ExpiredObjectDeleteMarker: expiration.ExpiredObjectDeleteMarker,
+		}
+	}
+	for _, transition := range rule.NoncurrentVersionTransitions {
+		if transition.NewerNoncurrentVersions != 0 {
+			return result, errLifecycleNotSupported
+		}
+		storageClass, err := cosStorageClassFromS3(transition.StorageClass)
+		if err != nil || storageClass == "" {
+			return result, fmt.Errorf("lifecycle rule %q: invalid transition storage class %q", rule.ID, transition.StorageClass)
+		}
+		result.NoncurrentVersionTransition = append(result.NoncurrentVersionTransition, cos.BucketLifecycleNoncurrentVersion{NoncurrentDays: transition.NoncurrentDays, StorageClass: storageClass})
+	}
+	if expiration := rule.NoncurrentVersionExpiration; expiration != nil {
+		if expiration.NewerNoncurrentVersions != 0 {
+			return result, errLifecycleNotSupported
+		}
+		result.NoncurrentVersionExpiration = &cos.BucketLifecycleNoncurrentVersion{NoncurrentDays: expiration.NoncurrentDays}
+	}
+	if abort := rule.AbortIncompleteMultipartUpload; abort != nil {
+		result.AbortIncompleteMultipartUpload = &cos.BucketLifecycleAbortIncompleteMultipartUpload{DaysAfterInitiation: abort.DaysAfterInitiation}
+	}
+
+	if len(result.Transition) == 0 && result.Expiration == nil && len(result.NoncurrentVersionTransition) == 0 &&
+		result.NoncurrentVersionExpiration == nil && result.AbortIncompleteMultipartUpload == nil {
+		return result, fmt.Errorf("lifecycle rule %q must specify at least one action", rule.ID)
+	}
+	return result, nil
+}
+
+// s3LifecycleRuleFromCOS 将 COS 的生命周期规则转换为 S3 的规则。
+func s3LifecycleRuleFromCOS(rule cos.BucketLifecycleRule) s3LifecycleRule {
+	result := s3LifecycleRule{ID: rule.ID, Status: rule.Status, Filter: s3LifecycleFilterFromCOS(rule.Filter)}
+	for _, transition := range rule.Transition {
+		result.Transitions = append(result.Transitions, s3LifecycleTransition{
+			Date:         transition.Date,
+			Days:         transition.Days,
+			StorageClass: s3StorageClassFromCOS(transition.StorageClass),
+		})
+	}
+	if expiration := rule.Expiration; expiration != nil {
+		result.Expiration = &s3LifecycleExpiration{
+			Date:                      expiration.Date,
+			Days:                      expiration.Days,
+			ExpiredObjectDeleteMarker: expiration.ExpiredObjectDeleteMarker,
+		}
+	}
+	for _, transition := range rule.NoncurrentVersionTransition {
+		result.NoncurrentVersionTransitions = append(result.NoncurrentVersionTransitions, s3NoncurrentVersionLifecycle{
+			NoncurrentDays: transition.NoncurrentDays,
+			StorageClass:   s3StorageClassFromCOS(transition.StorageClass),
+		})
+	}
+	if expiration := rule.NoncurrentVersionExpiration; expiration != nil {
+		result.NoncurrentVersionExpiration = &s3NoncurrentVersionLifecycle{NoncurrentDays: expiration.NoncurrentDays}
+	}
+	if abort := rule.AbortIncompleteMultipartUpload; abort != nil {
+		result.AbortIncompleteMultipartUpload = &s3LifecycleAbortIncompleteMultipart{DaysAfterInitiation: abort.DaysAfterInitiation}
+	}
+	return result
+}
+
+// GetBucketLifecycleConfiguration 处理 S3 的 GET Bucket lifecycle 请求。
+// GET /{bucket}?lifecycle
+func (ctrl *S3Controller) GetBucketLifecycleConfiguration(c *gin.Context) {
+	result, resp, err := ctrl.cosClient(c).Bucket.GetLifecycle(c.Request.Context())
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("GetBucketLifecycleConfiguration", resp)
+
+	payload := s3LifecycleConfiguration{XMLNS: s3XMLNamespace}
+	for _, rule := range result.Rules {
+		payload.Rules = append(payload.Rules, s3LifecycleRuleFromCOS(rule))
+	}
+	writeBucketConfiguration(c, "GetBucketLifecycleConfiguration", payload)
+}
+
+// PutBucketLifecycleConfiguration 处理 S3 的 PUT Bucket lifecycle 请求，新的配置会整体替换原有的生命周期规则。
+// PUT /{bucket}?lifecycle
+func (ctrl *S3Controller) PutBucketLifecycleConfiguration(c *gin.Context) {
+	var configuration s3LifecycleConfiguration
+	if !ctrl.readBucketConfigurationXML(c, &configuration) {
+		return
+	}
+	if len(configuration.Rules) == 0 {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+
+	opt := &cos.BucketPutLifecycleOptions{}
+	for _, rule := range configuration.Rules {
+		cosRule, err := cosLifecycleRule(rule)
+		if errors.Is(err, errLifecycleNotSupported) {
+			writeS3Error(c, http.StatusNotImplemented, "NotImplemented", err.Error())
+			return
+		}
+		if err != nil {
+			writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+			return
+		}
+		opt.Rules = append(opt.Rules, cosRule)
+	}
+	resp, err := ctrl.cosClient(c).Bucket.PutLifecycle(c.Request.Context(), opt)
+	ctrl.finishBucketConfiguration(c, "PutBucketLifecycleConfiguration", resp, err, http.StatusOK)
+}
+
+// DeleteBucketLifecycle 处理 S3 的 DELETE Bucket lifecycle 请求。
+// DELETE /{bucket}?lifecycle
+func (ctrl *S3Controller) DeleteBucketLifecycle(c *gin.Context) {
+	resp, err := ctrl.cosClient(c).Bucket.DeleteLifecycle(c.Request.Context())
+	ctrl.finishBucketConfiguration(c, "DeleteBucketLifecycle", resp, err, http.StatusNoContent)
+}
+
+// s3WebsiteConfiguration 是 S3 的静态网站配置。COS 的 RedirectAllRequestsTo 只能把请求重定向到 HTTPS，
+// 不能指定其他主机，重定向规则也不支持 HostName 和 HttpRedirectCode。
+type s3WebsiteConfiguration struct {
+	XMLName               xml.Name                `xml:"WebsiteConfiguration"`
+	XMLNS                 string                  `xml:"xmlns,attr,omitempty"`
+	IndexDocument         *s3WebsiteIndexDocument `xml:"IndexDocument,omitempty"`
+	ErrorDocument         *s3WebsiteErrorDocument `xml:"ErrorDocument,omitempty"`
+	RedirectAllRequestsTo *s3WebsiteRedirect      `xml:"RedirectAllRequestsTo,omitempty"`
+	RoutingRules          []s3WebsiteRoutingRule  `xml:"RoutingRules>RoutingRule,omitempty"`
+}
+
+type s3WebsiteIndexDocument struct {
+	Suffix string `xml:"Suffix"`
+}
+
+type s3WebsiteErrorDocument struct {
+	Key string `xml:"Key"`
+}
+
+type s3WebsiteRedirect struct {
+	HostName             string `xml:"HostName,omitempty"`
+	HTTPRedirectCode     string `xml:"HttpRedirectCode,omitempty"`
+	Protocol             string `xml:"Protocol,omitempty"`
+	ReplaceKeyPrefixWith string `xml:"ReplaceKeyPrefixWith,omitempty"`
+	ReplaceKeyWith       string `xml:"ReplaceKeyWith,omitempty"`
+}
+
+type s3WebsiteCondition struct {
+	HTTPErrorCodeReturnedEquals string `xml:"HttpErrorCodeReturnedEquals,omitempty"`
+	KeyPrefixEquals             string `xml:"KeyPrefixEquals,omitempty"`
+}
+
+type s3WebsiteRoutingRule struct {
+	Condition *s3WebsiteCondition `xml:"Condition,omitempty"`
+	Redirect  s3WebsiteRedirect   `xml:"Redirect"`
+}
+
+var errWebsiteRedirectNotSupported = errors.New("COS static websites cannot redirect to another host or with a custom HTTP redirect code")
+
+// cosWebsiteOptions 将 S3 的静态网站配置转换为 COS 的配置，COS 不支持的重定向返回 errWebsiteRedirectNotSupported。
+func cosWebsiteOptions(configuration s3WebsiteConfiguration) (*cos.BucketPutWebsiteOptions, error) {
+	redirect := configuration.RedirectAllRequestsTo
+	if redirect != nil && redirect.HostName != "" {
+		return nil, errWebsiteRedirectNotSupported
+	}
+	if configuration.IndexDocument == nil || configuration.IndexDocument.Suffix == "" {
+		return nil, errors.New("COS static websites require an IndexDocument suffix")
+	}
+	opt := &cos.BucketPutWebsiteOptions{Index: configuration.IndexDocument.Suffix}
+	if configuration.ErrorDocument != nil {
+		opt.Error = &cos.ErrorDocument{Key: configuration.ErrorDocument.Key}
+	}
+	if redirect != nil {
+		if redirect.Protocol != "https" {
+			return nil, errors.New("RedirectAllRequestsTo without HostName only supports redirecting to https")
+		}
+		opt.RedirectProtocol = &cos.RedirectRequestsProtocol{Protocol: redirect.Protocol}
+	}
+	if len(configuration.RoutingRules) > 0 {
+		opt.RoutingRules = &cos.WebsiteRoutingRules{}
+	}
+	for _, rule := range configuration.RoutingRules {
+		if rule.Redirect.HostName != "" || rule.Redirect.HTTPRedirectCode != "" {
+			return nil, errWebsiteRedirectNotSupported
+		}
+		if rule.Redirect.ReplaceKeyWith != "" && rule.Redirect.ReplaceKeyPrefixWith != "" {
+			return nil, errors.New("ReplaceKeyWith and ReplaceKeyPrefixWith cannot be used together")
+		}
+		cosRule := cos.WebsiteRoutingRule{
+			RedirectProtocol:         rule.Redirect.Protocol,
+			RedirectReplaceKey:       rule.Redirect.ReplaceKeyWith,
+			RedirectReplaceKeyPrefix: rule.Redirect.ReplaceKeyPrefixWith,
+		}
+		if rule.Condition != nil {
+			cosRule.ConditionErrorCode = rule.Condition.HTTPErrorCodeReturnedEquals
+			cosRule.ConditionPrefix = rule.Condition.KeyPrefixEquals
+		}
+		opt.RoutingRules.Rules = append(opt.RoutingRules.Rules, cosRule)
+	}
+	return opt, nil
+}
+
+// GetBucketWebsite 处理 S3 的 GET Bucket website 请求。
+// GET /{bucket}?website
+func (ctrl *S3Controller) GetBucketWebsite(c *gin.Context) {
+	result, resp, err := ctrl.cosClient(c).Bucket.GetWebsite(c.Request.Context())
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("GetBucketWebsite", resp)
+
+	payload := s3WebsiteConfiguration{XMLNS: s3XMLNamespace}
+	if result.Index != "" {
+		payload.IndexDocument = &s3WebsiteIndexDocument{Suffix: result.Index}
+	}
+	if result.Error != nil && result.Error.Key != "" {
+		payload.ErrorDocument = &s3WebsiteErrorDocument{Key: result.Error.Key}
+	}
+	if result.RedirectProtocol != nil && result.RedirectProtocol.Protocol != "" {
+		payload.RedirectAllRequestsTo = &s3WebsiteRedirect{Protocol: strings.ToLower(result.RedirectProtocol.Protocol)}
+	}
+	if result.RoutingRules != nil {
+		for _, rule := range result.RoutingRules.Rules {
+			s3Rule := s3WebsiteRoutingRule{Redirect: s3WebsiteRedirect{
+				Protocol:             rule.RedirectProtocol,
+				ReplaceKeyWith:       rule.RedirectReplaceKey,
+				ReplaceKeyPrefixWith: rule.RedirectReplaceKeyPrefix,
+			}}
+			if rule.ConditionErrorCode != "" || rule.ConditionPrefix != "" {
+				s3Rule.Condition = &s3WebsiteCondition{HTTPErrorCodeReturnedEquals: rule.ConditionErrorCode, KeyPrefixEquals: rule.ConditionPrefix}
+			}
+			payload.RoutingRules = append(payload.RoutingRules, s3Rule)
+		}
+	}
+	writeBucketConfiguration(c, "GetBucketWebsite", payload)
+}
+
+// PutBucketWebsite 处理 S3 的 PUT Bucket website 请求。
+// PUT /{bucket}?website
+func (ctrl *S3Controller) PutBucketWebsite(c *gin.Context) {
+	var configuration s3WebsiteConfiguration
+	if !ctrl.readBucketConfigurationXML(c, &configuration) {
+		return
+	}
+	opt, err := cosWebsiteOptions(configuration)
+	if errors.Is(err, errWebsiteRedirectNotSupported) {
+		writeS3Error(c, http.StatusNotImplemented, "NotImplemented", err.Error())
+		return
+	}
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	resp, err := ctrl.cosClient(c).Bucket.PutWebsite(c.Request.Context(), opt)
+	ctrl.finishBucketConfiguration(c, "PutBucketWebsite", resp, err, http.StatusOK)
+}
+
+// DeleteBucketWebsite 处理 S3 的 DELETE Bucket website 请求。
+// DELETE /{bucket}?website
+func (ctrl *S3Controller) DeleteBucketWebsite(c *gin.Context) {
+	resp, err := ctrl.cosClient(c).Bucket.DeleteWebsite(c.Request.Context())
+	ctrl.finishBucketConfiguration(c, "DeleteBucketWebsite", resp, err, http.StatusNoContent)
+}
@@ -0,0 +1,421 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// cosAnonymousPrincipal 是 COS 存储桶策略中代表任何人的主体，对应 S3 策略中的 "*"。
+const cosAnonymousPrincipal = "qcs::cam::anyone:anyone"
+
+// s3ActionsToCOS 记录 S3 操作对应的 COS 操作，COS 把部分 S3 操作拆分成了多个操作，未列出的操作名称两者相同。
+var s3ActionsToCOS = map[string][]string{
+	"GetObject":                  {"GetObject", "HeadObject"},
+	"PutObject":                  {"PutObject", "PostObject", "InitiateMultipartUpload", "UploadPart", "CompleteMultipartUpload"},
+	"ListBucket":                 {"GetBucket", "HeadBucket"},
+	"ListBucketVersions":         {"GetBucketObjectVersions"},
+	"ListBucketMultipartUploads": {"ListMultipartUploads"},
+	"ListMultipartUploadParts":   {"ListParts"},
+}
+
+// cosActionsToS3 是 s3ActionsToCOS 的反向映射，读取策略时使用。
+var cosActionsToS3 = func() map[string]string {
+	actions := map[string]string{}
+	for s3Action, cosActions := range s3ActionsToCOS {
+		for _, cosAction := range cosActions {
+			actions[cosAction] = s3Action
+		}
+	}
+	return actions
+}()
+
+// s3ConditionOperatorsToCOS 是 S3 策略条件运算符对应的 CAM 条件运算符。
+var s3ConditionOperatorsToCOS = map[string]string{
+	"StringEquals":       "string_equal",
+	"StringNotEquals":    "string_not_equal",
+	"StringLike":         "string_like",
+	"NumericEquals":      "numeric_equal",
+	"NumericLessThan":    "numeric_less_than",
+	"NumericGreaterThan": "numeric_greater_than",
+	"DateLessThan":       "date_less_than",
+	"DateGreaterThan":    "date_greater_than",
+	"Bool":               "bool_equal",
+	"IpAddress":          "ip_equal",
+	"NotIpAddress":       "ip_not_equal",
+}
+
+// s3ConditionKeysToCOS 是 S3 策略条件键对应的 COS 条件键，不在表中的条件键无法转换。
+var s3ConditionKeysToCOS = map[string]string{
+	"aws:sourceip":        "qcs:ip",
+	"aws:securetransport": "qcs:secure_transport",
+	"s3:prefix":           "cos:prefix",
+}
+
+var errMalformedPolicy = errors.New("malformed bucket policy")
+
+// s3PolicyValues 是策略中既可以写成字符串也可以写成字符串数组的字段。
+type s3PolicyValues []string
+
+func (v *s3PolicyValues) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*v = s3PolicyValues{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*v = multiple
+	return nil
+}
+
+// s3PolicyPrincipal 是策略的 Principal，"*" 表示任何人。QCS 用于保留读取策略时返回的 COS 主体，使策略可以原样写回。
+type s3PolicyPrincipal struct {
+	AWS s3PolicyValues `json:"AWS,omitempty"`
+	QCS s3PolicyValues `json:"QCS,omitempty"`
+}
+
+func (p *s3PolicyPrincipal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return fmt.Errorf("%w: invalid principal %q", errMalformedPolicy, wildcard)
+		}
+		p.AWS = s3PolicyValues{"*"}
+		return nil
+	}
+	type principal s3PolicyPrincipal
+	return json.Unmarshal(data, (*principal)(p))
+}
+
+type s3PolicyStatement struct {
+	Sid       string                               `json:"Sid,omitempty"`
+	Effect    string                               `json:"Effect"`
+	Principal *s3PolicyPrincipal                   `json:"Principal,omitempty"`
+	Action    s3PolicyValues                       `json:"Action"`
+	Resource  s3PolicyValues                       `json:"Resource"`
+	Condition map[string]map[string]s3PolicyValues `json:"Condition,omitempty"`
+	// COS 存储桶策略不支持以下取反字段，出现时拒绝整个策略
+	NotPrincipal json.RawMessage `json:"NotPrincipal,omitempty"`
+	NotAction    json.RawMessage `json:"NotAction,omitempty"`
+	NotResource  json.RawMessage `json:"NotResource,omitempty"`
+}
+
+type s3PolicyDocument struct {
+	Version   string              `json:"Version,omitempty"`
+	ID        string              `json:"Id,omitempty"`
+	Statement []s3PolicyStatement `json:"Statement"`
+}
+
+// parseS3Policy 解析 S3 存储桶策略，Statement 可以是单个对象或对象数组。
+func parseS3Policy(data []byte) (*s3PolicyDocument, error) {
+	var raw struct {
+		Version   string          `json:"Version"`
+		ID        string          `json:"Id"`
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedPolicy, err)
+	}
+	document := &s3PolicyDocument{Version: raw.Version, ID: raw.ID}
+	if err := json.Unmarshal(raw.Statement, &document.Statement); err != nil {
+		var statement s3PolicyStatement
+		if err := json.Unmarshal(raw.Statement, &statement); err != nil {
+			return nil, fmt.Errorf("%w: invalid Statement: %v", errMalformedPolicy, err)
+		}
+		document.Statement = []s3PolicyStatement{statement}
+	}
+	if len(document.Statement) == 0 {
+		return nil, fmt.Errorf("%w: policy has no statements", errMalformedPolicy)
+	}
+	return document, nil
+}
+
+// cosPolicyResources 描述一个存储桶在 COS 策略中的资源前缀，例如
+// qcs::cos:ap-guangzhou:uid/1250000000:examplebucket-1250000000/，bucket 是客户端使用的 S3 存储桶名称。
+type cosPolicyResources struct {
+	bucket string
+	prefix string
+}
+
+// policyResources 返回当前请求所属存储桶的资源前缀，需要 COS 默认域名中的存储桶名称 (包含 APPID) 和存储桶地域。
+func (ctrl *S3Controller) policyResources(c *gin.Context) (cosPolicyResources, error) {
+	bucket, _ := ctrl.extractBucketAndKey(c)
+	cosBucket, _, _ := strings.Cut(ctrl.cosClient(c).BaseURL.BucketURL.Hostname(), ".")
+	dash := strings.LastIndex(cosBucket, "-")
+	appID := cosBucket[dash+1:]
+	region := ctrl.Buckets.Region(bucket)
+	if dash < 0 || appID == "" || strings.Trim(appID, "0123456789") != "" || region == "" {
+		return cosPolicyResources{}, errors.New("bucket policies require the bucket to be configured with its COS default domain and region")
+	}
+	return cosPolicyResources{bucket: bucket, prefix: fmt.Sprintf("qcs::cos:%s:uid/%s:%s/", region, appID, cosBucket)}, nil
+}
+
+// toCOS 将 S3 资源 ARN 转换为 COS 资源，策略只能引用请求所属的存储桶。
+func (r cosPolicyResources) toCOS(resource string) (string, error) {
+	if resource == "*" {
+		return r.prefix + "*", nil
+	}
+	path, ok := strings.CutPrefix(resource, "arn:aws:s3:::")
+	if !ok {
+		return "", fmt.Errorf("%w: invalid resource %q", errMalformedPolicy, resource)
+	}
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != r.bucket {
+		return "", fmt.Errorf("%w: policy has invalid resource %q", errMalformedPolicy, resource)
+	}
+	return r.prefix + key, nil
+}
+
+// toS3 将 COS 资源转换为 S3 资源 ARN，其他存储桶的资源原样返回。
+func (r cosPolicyResources) toS3(resource string) string {
+	key, ok := strings.CutPrefix(resource, r.prefix)
+	if !ok {
+		return resource
+	}
+	if key == "" {
+		return s3BucketARN(r.bucket)
+	}
+	return s3BucketARN(r.bucket) + "/" + key
+}
+
+func s3BucketARN(bucket string) string {
+	return "arn:aws:s3:::" + bucket
+}
+
+// cosPolicyFromS3 将 S3 存储桶策略转换为 COS 存储桶策略，无法等价转换的写法返回 errMalformedPolicy。
+func cosPolicyFromS3(document *s3PolicyDocument, resources cosPolicyResources) (*cos.BucketPutPolicyOptions, error) {
+	if document.Version != "" && document.Version != "2012-10-17" && document.Version != "2008-10-17" {
+		return nil, fmt.Errorf("%w: unsupported policy version %q", errMalformedPolicy, document.Version)
+	}
+	opt := &cos.BucketPutPolicyOptions{Version: "2.0"}
+	for _, statement := range document.Statement {
+		if len(statement.NotPrincipal) > 0 || len(statement.NotAction) > 0 || len(statement.NotResource) > 0 {
+			return nil, fmt.Errorf("%w: NotPrincipal, NotAction and NotResource are not supported", errMalformedPolicy)
+		}
+		cosStatement := cos.BucketStatement{Sid: statement.Sid}
+		switch statement.Effect {
+		case "Allow", "Deny":
+			cosStatement.Effect = strings.ToLower(statement.Effect)
+		default:
+			return nil, fmt.Errorf("%w: invalid effect %q", errMalformedPolicy, statement.Effect)
+		}
+
+		if statement.Principal == nil {
+			return nil, fmt.Errorf("%w: statement %q has no principal", errMalformedPolicy, statement.Sid)
+		}
+		var principals []string
+		for _, principal := range statement.Principal.AWS {
+			if principal != "*" {
+				return nil, fmt.Errorf("%w: principal %q cannot be mapped to COS, use {\"QCS\": [...]} for CAM principals", errMalformedPolicy, principal)
+			}
+			principals = append(principals, cosAnonymousPrincipal)
+		}
+		principals = append(principals, statement.Principal.QCS...)
+		if len(principals) == 0 {
+			return nil, fmt.Errorf("%w: statement %q has no principal", errMalformedPolicy, statement.Sid)
+		}
+		cosStatement.Principal = map[string][]string{"qcs": principals}
+
+		if len(statement.Action) == 0 || len(statement.Resource) == 0 {
+			return nil, fmt.Errorf("%w: statement %q requires Action and Resource", errMalformedPolicy, statement.Sid)
+		}
+		for _, action := range statement.Action {
+			name, ok := strings.CutPrefix(action, "s3:")
+			if action != "*" && !ok {
+				return nil, fmt.Errorf("%w: invalid action %q", errMalformedPolicy, action)
+			}
+			if action == "*" {
+				name = "*"
+			}
+			cosActions, ok := s3ActionsToCOS[name]
+			if !ok {
+				cosActions = []string{name}
+			}
+			for _, cosAction := range cosActions {
+				cosStatement.Action = append(cosStatement.Action, "name/cos:"+cosAction)
+			}
+		}
+		for _, resource := range statement.Resource {
+			cosResource, err := resources.toCOS(resource)
+			if err != nil {
+				return nil, err
+			}
+			cosStatement.Resource = append(cosStatement.Resource, cosResource)
+		}
+
+		for operator, conditions := range statement.Condition {
+			cosOperator, ok := s3ConditionOperatorsToCOS[operator]
+			if !ok {
+				return nil, fmt.Errorf("%w: condition operator %q is not supported", errMalformedPolicy, operator)
+			}
+			if cosStatement.Condition == nil {
+				cosStatement.Condition = map[string]map[string]interface{}{}
+			}
+			cosConditions := map[string]interface{}{}
+			for key, values := range conditions {
+				cosKey, ok := s3ConditionKeysToCOS[strings.ToLower(key)]
+				if !ok {
+					return nil, fmt.Errorf("%w: condition key %q is not supported", errMalformedPolicy, key)
+				}
+				cosConditions[cosKey] = []string(values)
+			}
+			cosStatement.Condition[cosOperator] = cosConditions
+		}
+		opt.Statement = append(opt.Statement, cosStatement)
+	}
+	return opt, nil
+}
+
+// s3PolicyFromCOS 将 COS 存储桶策略转换为 S3 存储桶策略，任何人以 "*" 表示，其他 COS 主体放在 QCS 中。
+func s3PolicyFromCOS(policy *cos.BucketGetPolicyResult, resources cosPolicyResources) *s3PolicyDocument {
+	document := &s3PolicyDocument{Version: "2012-10-17"}
+	s3Operators := reverseMap(s3ConditionOperatorsToCOS)
+	s3Keys := map[string]string{"qcs:ip": "aws:SourceIp", "qcs:secure_transport": "aws:SecureTransport", "cos:prefix": "s3:prefix"}
+	for _, statement := range policy.Statement {
+		s3Statement := s3PolicyStatement{Sid: statement.Sid, Principal: &s3PolicyPrincipal{}}
+		if effect := strings.ToLower(statement.Effect); effect != "" {
+			s3Statement.Effect = strings.ToUpper(effect[:1]) + effect[1:]
+		}
+		for _, principals := range statement.Principal {
+			for _, principal := range principals {
+				if principal == cosAnonymousPrincipal || principal == "*" {
+					s3Statement.Principal.AWS = append(s3Statement.Principal.AWS, "*")
+				} else {
+					s3Statement.Principal.QCS = append(s3Statement.Principal.QCS, principal)
+				}
+			}
+		}
+
+		seen := map[string]bool{}
+		for _, action := range statement.Action {
+			name, ok := strings.CutPrefix(action, "name/cos:")
+			if !ok {
+				name = action
+			}
+			if s3Action, ok := cosActionsToS3[name]; ok {
+				name = s3Action
+			}
+			s3Action := "s3:" + name
+			if name == "*" {
+				s3Action = "s3:*"
+			}
+			if !seen[s3Action] {
+				seen[s3Action] = true
+				s3Statement.Action = append(s3Statement.Action, s3Action)
+			}
+		}
+		for _, resource := range statement.Resource {
+			s3Statement.Resource = append(s3Statement.Resource, resources.toS3(resource))
+		}
+
+		for operator, conditions := range statement.Condition {
+			s3Operator, ok := s3Operators[operator]
+			if !ok {
+				s3Operator = operator
+			}
+			if s3Statement.Condition == nil {
+				s3Statement.Condition = map[string]map[string]s3PolicyValues{}
+			}
+			s3Conditions := map[string]s3PolicyValues{}
+			for key, value := range conditions {
+				if s3Key, ok := s3Keys[key]; ok {
+					key = s3Key
+				}
+				s3Conditions[key] = policyConditionValues(value)
+			}
+			s3Statement.Condition[s3Operator] = s3Conditions
+		}
+		document.Statement = append(document.Statement, s3Statement)
+	}
+	return document
+}
+
+// policyConditionValues 将 COS 返回的条件值 (字符串、数字、布尔值或它们的数组) 转换为字符串数组。
+func policyConditionValues(value interface{}) s3PolicyValues {
+	switch value := value.(type) {
+	case []interface{}:
+		var values s3PolicyValues
+		for _, item := range value {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case []string:
+		return value
+	default:
+		return s3PolicyValues{fmt.Sprint(value)}
+	}
+}
+
+func reverseMap(m map[string]string) map[string]string {
+	reversed := make(map[string]string, len(m))
+	for key, value := range m {
+		reversed[value] = key
+	}
+	return reversed
+}
+
+// GetBucketPolicy 处理 S3 的 GET Bucket policy 请求，返回转换为 S3 格式的 COS 存储桶策略。
+// GET /{bucket}?policy
+func (ctrl *S3Controller) GetBucketPolicy(c *gin.Context) {
+	resources, err := ctrl.policyResources(c)
+	if err != nil {
+		writeS3Error(c, http.StatusNotImplemented, "NotImplemented", err.Error())
+		return
+	}
+	result, resp, err := ctrl.cosClient(c).Bucket.GetPolicy(c.Request.Context())
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("GetBucketPolicy", resp)
+
+	encoded, err := json.Marshal(s3PolicyFromCOS(result, resources))
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal GetBucketPolicy response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", encoded)
+}
+
+// PutBucketPolicy 处理 S3 的 PUT Bucket policy 请求。S3 的主体、操作、资源和条件会转换为 COS 的写法，
+// 无法等价转换的策略返回 400 MalformedPolicy，而不是写入一个含义不同的策略。
+// PUT /{bucket}?policy
+func (ctrl *S3Controller) PutBucketPolicy(c *gin.Context) {
+	resources, err := ctrl.policyResources(c)
+	if err != nil {
+		writeS3Error(c, http.StatusNotImplemented, "NotImplemented", err.Error())
+		return
+	}
+	body, ok := ctrl.readBucketConfiguration(c)
+	if !ok {
+		return
+	}
+	document, err := parseS3Policy(body)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "MalformedPolicy", err.Error())
+		return
+	}
+	opt, err := cosPolicyFromS3(document, resources)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "MalformedPolicy", err.Error())
+		return
+	}
+	resp, err := ctrl.cosClient(c).Bucket.PutPolicy(c.Request.Context(), opt)
+	ctrl.finishBucketConfiguration(c, "PutBucketPolicy", resp, err, http.StatusNoContent)
+}
+
+// DeleteBucketPolicy 处理 S3 的 DELETE Bucket policy 请求。
+// DELETE /{bucket}?policy
+func (ctrl *S3Controller) DeleteBucketPolicy(c *gin.Context) {
+	resp, err := ctrl.cosClient(c).Bucket.DeletePolicy(c.Request.Context())
+	ctrl.finishBucketConfiguration(c, "DeleteBucketPolicy", resp, err, http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// cosClientContextKey 是分发器保存当前请求所属存储桶的 COS 客户端时使用的上下文键。
+const cosClientContextKey = "cos-proxy.cos-client"
+
+// BucketRegistry 保存客户端使用的 S3 存储桶名称到 COS 客户端的映射，
+// 每个名称对应一个独立的 COS 存储桶，可以使用各自的访问密钥。
+type BucketRegistry struct {
+	buckets map[string]*registeredBucket
+}
+
+type registeredBucket struct {
+	client *cos.Client
+	region string
+	// created 是存储桶注册到代理的时间，即代理的启动时间
+	created time.Time
+	// requireEncryption 为 true 时拒绝没有指定服务端加密的写入请求
+	requireEncryption bool
+	// objectLock 为 nil 表示存储桶没有启用对象锁定
+	objectLock *ObjectLockConfiguration
+}
+
+// NewBucketRegistry 创建一个空的存储桶注册表。
+func NewBucketRegistry() *BucketRegistry {
+	return &BucketRegistry{buckets: map[string]*registeredBucket{}}
+}
+
+// Register 将 S3 存储桶名称映射到 COS 客户端，region 是 COS 存储桶所在的地域，同一名称只能注册一次。
+func (r *BucketRegistry) Register(name, region string, client *cos.Client) error {
+	if _, ok := r.buckets[name]; ok {
+		return fmt.Errorf("bucket %s is already registered", name)
+	}
+	r.buckets[name] = &registeredBucket{client: client, region: region, created: time.Now().UTC()}
+	return nil
+}
+
+// Lookup 返回存储桶名称对应的 COS 客户端，未注册的名称返回 nil。
+func (r *BucketRegistry) Lookup(name string) *cos.Client {
+	if bucket, ok := r.buckets[name]; ok {
+		return bucket.client
+	}
+	return nil
+}
+
+// Region 返回存储桶所在的 COS 地域，未知时返回空字符串。
+func (r *BucketRegistry) Region(name string) string {
+	if bucket, ok := r.buckets[name]; ok {
+		return bucket.region
+	}
+	return ""
+}
+
+// CreationDate 返回 ListBuckets 中使用的创建时间，未注册的名称返回零值。
+// 这是存储桶注册到代理的时间 (即代理的启动时间)，而不是 COS 存储桶的实际创建时间，
+// 后者需要调用 COS 的 GetService，代理使用的密钥通常只有存储桶级别的权限。
+func (r *BucketRegistry) CreationDate(name string) time.Time {
+	if bucket, ok := r.buckets[name]; ok {
+		return bucket.created
+	}
+	return time.Time{}
+}
+
+// RequireEncryption 要求写入该存储桶的对象必须指定服务端加密 (SSE-COS、SSE-KMS 或 SSE-C)。
+func (r *BucketRegistry) RequireEncryption(name string) error {
+	bucket, ok := r.buckets[name]
+	if !ok {
+		return fmt.Errorf("bucket %s is not registered", name)
+	}
+	bucket.requireEncryption = true
+	return nil
+}
+
+// EncryptionRequired 判断写入该存储桶的对象是否必须指定服务端加密。
+func (r *BucketRegistry) EncryptionRequired(name string) bool {
+	if bucket, ok := r.buckets[name]; ok {
+		return bucket.requireEncryption
+	}
+	return false
+}
+
+// EnableObjectLock 为存储桶启用由代理执行的对象锁定。
+func (r *BucketRegistry) EnableObjectLock(name string, config ObjectLockConfiguration) error {
+	bucket, ok := r.buckets[name]
+	if !ok {
+		return fmt.Errorf("bucket %s is not registered", name)
+	}
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("bucket %s: %w", name, err)
+	}
+	bucket.objectLock = &config
+	return nil
+}
+
+// ObjectLock 返回存储桶的对象锁定配置，未启用时返回 nil。
+func (r *BucketRegistry) ObjectLock(name string) *ObjectLockConfiguration {
+	if bucket, ok := r.buckets[name]; ok {
+		return bucket.objectLock
+	}
+	return nil
+}
+
+// Names 按字典序返回全部已注册的存储桶名称。
+func (r *BucketRegistry) Names() []string {
+	names := make([]string, 0, len(r.buckets))
+	for name := range r.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cosClient 返回分发器为当前请求选定的 COS 客户端。
+func (ctrl *S3Controller) cosClient(c *gin.Context) *cos.Client {
+	return c.MustGet(cosClientContextKey).(*cos.Client)
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// S3 客户端提供的 SSE-C 密钥头部前缀，复制源对象的密钥使用 x-amz-copy-source- 前缀的同名头部。
+const (
+	s3CustomerKeyPrefix           = "x-amz-server-side-encryption-customer-"
+	s3CopySourceCustomerKeyPrefix = "x-amz-copy-source-server-side-encryption-customer-"
+)
+
+// s3EncryptionHeaders 是写入对象时与服务端加密相关的请求头部，表单上传时以同名表单字段提交。
+var s3EncryptionHeaders = []string{
+	"x-amz-server-side-encryption",
+	"x-amz-server-side-encryption-aws-kms-key-id",
+	"x-amz-server-side-encryption-context",
+	s3CustomerKeyPrefix + "algorithm",
+	s3CustomerKeyPrefix + "key",
+	s3CustomerKeyPrefix + "key-MD5",
+}
+
+var errSSECustomerKeyIncompatible = errors.New("server side encryption with customer provided key is incompatible with the encryption method specified")
+
+// sseCustomerKey 是 SSE-C 请求中客户端提供的加密密钥，COS 与 S3 的取值相同。
+type sseCustomerKey struct {
+	algorithm string
+	key       string
+	keyMD5    string
+}
+
+// s3CustomerKey 读取 prefix 开头的 SSE-C 头部，三个头部必须同时出现，且算法只能是 AES256。
+func s3CustomerKey(header http.Header, prefix string) (sseCustomerKey, error) {
+	key := sseCustomerKey{
+		algorithm: header.Get(prefix + "algorithm"),
+		key:       header.Get(prefix + "key"),
+		keyMD5:    header.Get(prefix + "key-MD5"),
+	}
+	if key == (sseCustomerKey{}) {
+		return key, nil
+	}
+	if key.algorithm != "AES256" {
+		return key, fmt.Errorf("the encryption algorithm %q specified in %salgorithm is not valid", key.algorithm, prefix)
+	}
+	if key.key == "" || key.keyMD5 == "" {
+		return key, fmt.Errorf("requests specifying server side encryption with customer provided keys must provide %skey and %skey-MD5", prefix, prefix)
+	}
+	return key, nil
+}
+
+// s3Encryption 是写入对象时指定的服务端加密方式，已转换为 COS 的取值。
+type s3Encryption struct {
+	// serverSide 是 x-cos-server-side-encryption 的取值：AES256 (SSE-COS) 或 cos/kms (SSE-KMS)
+	serverSide string
+	kmsKeyID   string
+	kmsContext string
+	customer   sseCustomerKey
+}
+
+// s3EncryptionFromHeader 将 x-amz-server-side-encryption* 头部转换为 COS 的服务端加密参数。
+// S3 的 AES256 (SSE-S3) 对应 COS 的 SSE-COS，aws:kms 对应 cos/kms，COS 没有与 aws:kms:dsse 对应的加密方式。
+func s3EncryptionFromHeader(header http.Header) (s3Encryption, error) {
+	var encryption s3Encryption
+	switch algorithm := header.Get("x-amz-server-side-encryption"); algorithm {
+	case "":
+	case "AES256":
+		encryption.serverSide = "AES256"
+	case "aws:kms":
+		encryption.serverSide = "cos/kms"
+	default:
+		return encryption, fmt.Errorf("server side encryption %q is not supported", algorithm)
+	}
+
+	encryption.kmsKeyID = header.Get("x-amz-server-side-encryption-aws-kms-key-id")
+	encryption.kmsContext = header.Get("x-amz-server-side-encryption-context")
+	if (encryption.kmsKeyID != "" || encryption.kmsContext != "") && encryption.serverSide != "cos/kms" {
+		return encryption, errors.New("x-amz-server-side-encryption-aws-kms-key-id and x-amz-server-side-encryption-context require x-amz-server-side-encryption: aws:kms")
+	}
+
+	var err error
+	if encryption.customer, err = s3CustomerKey(header, s3CustomerKeyPrefix); err != nil {
+		return encryption, err
+	}
+	if encryption.customer != (sseCustomerKey{}) && encryption.serverSide != "" {
+		return encryption, errSSECustomerKeyIncompatible
+	}
+	return encryption, nil
+}
+
+// encrypted 判断写入请求是否指定了任意一种服务端加密方式。
+func (e s3Encryption) encrypted() bool {
+	return e.serverSide != "" || e.customer != (sseCustomerKey{})
+}
+
+// applyToPut 将服务端加密参数写入 PutObject/PostObject/CreateMultipartUpload 的 COS 请求头部。
+// SDK 没有 KMS 密钥和加密上下文的字段，这两个头部通过 XOptionHeader 发送，调用前需要先设置好其他自定义头部。
+func (e s3Encryption) applyToPut(opt *cos.ObjectPutHeaderOptions) {
+	opt.XCosServerSideEncryption = e.serverSide
+	opt.XOptionHeader = e.kmsHeader(opt.XOptionHeader)
+	opt.XCosSSECustomerAglo = e.customer.algorithm
+	opt.XCosSSECustomerKey = e.customer.key
+	opt.XCosSSECustomerKeyMD5 = e.customer.keyMD5
+}
+
+// applyToCopy 将目标对象的服务端加密参数写入 CopyObject 的 COS 请求头部。
+func (e s3Encryption) applyToCopy(opt *cos.ObjectCopyHeaderOptions) {
+	opt.XCosServerSideEncryption = e.serverSide
+	opt.XOptionHeader = e.kmsHeader(opt.XOptionHeader)
+	opt.XCosSSECustomerAglo = e.customer.algorithm
+	opt.XCosSSECustomerKey = e.customer.key
+	opt.XCosSSECustomerKeyMD5 = e.customer.keyMD5
+}
+
+// kmsHeader 将 SSE-KMS 的密钥 ID 和加密上下文追加到自定义头部中，没有指定时原样返回 header。
+func (e s3Encryption) kmsHeader(header *http.Header) *http.Header {
+	if e.kmsKeyID == "" && e.kmsContext == "" {
+		return header
+	}
+	if header == nil {
+		header = &http.Header{}
+	}
+	if e.kmsKeyID != "" {
+		header.Set("x-cos-server-side-encryption-cos-kms-key-id", e.kmsKeyID)
+	}
+	if e.kmsContext != "" {
+		header.Set("x-cos-server-side-encryption-context", e.kmsContext)
+	}
+	return header
+}
+
+// customerKeyHeader 将目标对象的 SSE-C 密钥追加到自定义头部中，用于 SDK 没有对应字段的请求 (如 UploadPartCopy)。
+func (k sseCustomerKey) customerKeyHeader(header *http.Header) *http.Header {
+	if k == (sseCustomerKey{}) {
+		return header
+	}
+	if header == nil {
+		header = &http.Header{}
+	}
+	header.Set("x-cos-server-side-encryption-customer-algorithm", k.algorithm)
+	header.Set("x-cos-server-side-encryption-customer-key", k.key)
+	header.Set("x-cos-server-side-encryption-customer-key-MD5", k.keyMD5)
+	return header
+}
+
+// checkEncryptionRequired 在存储桶配置了 require_encryption 而写入请求没有指定服务端加密时返回 403，
+// 请求被拒绝时返回 false。
+func (ctrl *S3Controller) checkEncryptionRequired(c *gin.Context, encryption s3Encryption) bool {
+	bucket, _ := ctrl.extractBucketAndKey(c)
+	if encryption.encrypted() || !ctrl.Buckets.EncryptionRequired(bucket) {
+		return true
+	}
+	writeS3Error(c, http.StatusForbidden, "AccessDenied", "Server side encryption is required for objects written to this bucket")
+	return false
+}
+
+// writeS3EncryptionHeaders 将 COS 返回的服务端加密头部以 S3 的 x-amz-server-side-encryption* 头部返回。
+func writeS3EncryptionHeaders(c *gin.Context, header http.Header) {
+	switch header.Get("x-cos-server-side-encryption") {
+	case "AES256":
+		c.Header("x-amz-server-side-encryption", "AES256")
+	case "cos/kms":
+		c.Header("x-amz-server-side-encryption", "aws:kms")
+	}
+	if kmsKeyID := header.Get("x-cos-server-side-encryption-cos-kms-key-id"); kmsKeyID != "" {
+		c.Header("x-amz-server-side-encryption-aws-kms-key-id", kmsKeyID)
+	}
+	if algorithm := header.Get("x-cos-server-side-encryption-customer-algorithm"); algorithm != "" {
+		c.Header(s3CustomerKeyPrefix+"algorithm", algorithm)
+	}
+	if keyMD5 := header.Get("x-cos-server-side-encryption-customer-key-MD5"); keyMD5 != "" {
+		c.Header(s3CustomerKeyPrefix+"key-MD5", keyMD5)
+	}
+}
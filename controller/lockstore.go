@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// objectLockState 是一个对象版本的保留状态，Mode 为空表示没有保留期限。
+type objectLockState struct {
+	Mode        string    `json:"mode,omitempty"`
+	RetainUntil time.Time `json:"retain_until,omitempty"`
+	LegalHold   bool      `json:"legal_hold,omitempty"`
+	// LegalHoldSet 记录是否设置过法律保留，用于区分 GetObjectLegalHold 返回 OFF 还是 404
+	LegalHoldSet bool `json:"legal_hold_set,omitempty"`
+}
+
+// retained 判断对象在 now 时是否仍处于保留期限内。
+func (s objectLockState) retained(now time.Time) bool {
+	return s.Mode != "" && now.Before(s.RetainUntil)
+}
+
+// protected 判断对象在 now 时是否受保护，受保护的对象版本不能被覆盖或删除。
+func (s objectLockState) protected(now time.Time) bool {
+	return s.LegalHold || s.retained(now)
+}
+
+var errObjectLockStoreNotConfigured = errors.New("object lock store is not configured")
+
+// ObjectLockStore 将对象的保留状态保存在本地 JSON 文件中，每次修改后整体写回。
+// 状态只保存在运行代理的主机上，多副本之间不会同步，启用对象锁定的存储桶只能由单个副本提供服务。
+type ObjectLockStore struct {
+	mu   sync.Mutex
+	path string
+	// objects 以 objectLockID 为键保存对象版本的保留状态
+	objects map[string]objectLockState
+	// uploads 保存 CreateMultipartUpload 时指定的保留设置，CompleteMultipartUpload 时转移到对象上
+	uploads map[string]objectLockState
+}
+
+type objectLockFile struct {
+	Objects map[string]objectLockState `json:"objects"`
+	Uploads map[string]objectLockState `json:"uploads,omitempty"`
+}
+
+// OpenObjectLockStore 打开 path 指向的保留状态文件，文件不存在时从空状态开始，首次修改时创建。
+func OpenObjectLockStore(path string) (*ObjectLockStore, error) {
+	store := &ObjectLockStore{
+		path:    path,
+		objects: map[string]objectLockState{},
+		uploads: map[string]objectLockState{},
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object lock store: %w", err)
+	}
+	var file objectLockFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse object lock store: %w", err)
+	}
+	for id, state := range file.Objects {
+		store.objects[id] = state
+	}
+	for uploadID, state := range file.Uploads {
+		store.uploads[uploadID] = state
+	}
+	return store, nil
+}
+
+// objectLockID 是对象版本在保留状态文件中的键，未开启版本控制的存储桶中 versionID 为空。
+func objectLockID(bucket, key, versionID string) string {
+	return bucket + "/" + escapeObjectKey(key) + "?versionId=" + url.QueryEscape(versionID)
+}
+
+// get 返回对象版本的保留状态，store 为 nil 时视为没有任何保留状态。
+func (s *ObjectLockStore) get(id string) (objectLockState, bool) {
+	if s == nil {
+		return objectLockState{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.objects[id]
+	return state, ok
+}
+
+// put 保存对象版本的保留状态，零值表示删除该记录。
+func (s *ObjectLockStore) put(id string, state objectLockState) error {
+	if s == nil {
+		return errObjectLockStoreNotConfigured
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.objects[id]
+	if state == (objectLockState{}) {
+		if !existed {
+			return nil
+		}
+		delete(s.objects, id)
+	} else {
+		s.objects[id] = state
+	}
+	if err := s.save(); err != nil {
+		if existed {
+			s.objects[id] = previous
+		} else {
+			delete(s.objects, id)
+		}
+		return err
+	}
+	return nil
+}
+
+// putUpload 保存分块上传初始化时指定的保留设置。
+func (s *ObjectLockStore) putUpload(uploadID string, state objectLockState) error {
+	if s == nil {
+		return errObjectLockStoreNotConfigured
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[uploadID] = state
+	if err := s.save(); err != nil {
+		delete(s.uploads, uploadID)
+		return err
+	}
+	return nil
+}
+
+// takeUpload 取出并删除分块上传初始化时指定的保留设置。
+func (s *ObjectLockStore) takeUpload(uploadID string) (objectLockState, error) {
+	if s == nil {
+		return objectLockState{}, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.uploads[uploadID]
+	if !ok {
+		return objectLockState{}, nil
+	}
+	delete(s.uploads, uploadID)
+	if err := s.save(); err != nil {
+		s.uploads[uploadID] = state
+		return objectLockState{}, err
+	}
+	return state, nil
+}
+
+// save 先写入临时文件再重命名，避免进程中途退出时留下不完整的状态文件，调用方需持有锁。
+func (s *ObjectLockStore) save() error {
+	data, err := json.MarshalIndent(objectLockFile{Objects: s.objects, Uploads: s.uploads}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write object lock store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write object lock store: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write object lock store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write object lock store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write object lock store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// s3ResponseOverrides 是 GET/HEAD Object 支持的 response-* 查询参数及其覆盖的响应头部，
+// 常用于在预签名 URL 中指定下载文件名 (response-content-disposition)。
+var s3ResponseOverrides = []struct {
+	param  string
+	header string
+}{
+	{param: "response-content-type", header: "Content-Type"},
+	{param: "response-content-language", header: "Content-Language"},
+	{param: "response-expires", header: "Expires"},
+	{param: "response-cache-control", header: "Cache-Control"},
+	{param: "response-content-disposition", header: "Content-Disposition"},
+	{param: "response-content-encoding", header: "Content-Encoding"},
+}
+
+// AuthenticatedContextKey 是准入中间件标记请求携带有效签名 (包括预签名 URL) 时使用的上下文键。
+const AuthenticatedContextKey = "cos-proxy.authenticated"
+
+// rejectAnonymousResponseOverrides 与 S3 一致拒绝匿名请求中的 response-* 参数，
+// 否则任何人都可以让公开可读的对象以 text/html 等类型返回，在代理的域名下构成反射型 XSS。
+func rejectAnonymousResponseOverrides(c *gin.Context) bool {
+	if c.GetBool(AuthenticatedContextKey) {
+		return false
+	}
+	for _, override := range s3ResponseOverrides {
+		if _, ok := c.GetQuery(override.param); ok {
+			writeS3Error(c, http.StatusBadRequest, "InvalidRequest", "Request specific response headers cannot be used for anonymous GET requests.")
+			return true
+		}
+	}
+	return false
+}
+
+// writeS3ResponseOverrides 用 response-* 查询参数覆盖已经写入的对象响应头部。
+func writeS3ResponseOverrides(c *gin.Context) {
+	for _, override := range s3ResponseOverrides {
+		if value := c.Query(override.param); value != "" {
+			c.Header(override.header, value)
+		}
+	}
+}
+
+// s3StoredObjectHeaders 是上传时随对象保存、读取时原样返回的标准 HTTP 头部 (Content-Type 单独处理)。
+var s3StoredObjectHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Expires",
+}
+
+// setCOSObjectMetadata 将请求中的标准元数据头部和 x-amz-meta-* 自定义元数据写入 COS 的上传选项。
+// aws-chunked 编码在进入控制器之前已经从 Content-Encoding 中去除。
+func setCOSObjectMetadata(opt *cos.ObjectPutHeaderOptions, header http.Header) {
+	opt.CacheControl = header.Get("Cache-Control")
+	opt.ContentDisposition = header.Get("Content-Disposition")
+	opt.ContentEncoding = header.Get("Content-Encoding")
+	opt.ContentLanguage = header.Get("Content-Language")
+	opt.Expires = header.Get("Expires")
+	opt.XCosMetaXXX = cosMetaHeaderFromS3(header)
+}
+
+// postObjectMetadata 从表单上传的字段中取出元数据，字段名不区分大小写，返回值可直接交给 setCOSObjectMetadata。
+func postObjectMetadata(form *multipart.Form) http.Header {
+	header := http.Header{}
+	for field, values := range form.Value {
+		if len(values) == 0 {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(field), "x-amz-meta-") {
+			header.Set(field, values[0])
+			continue
+		}
+		for _, name := range s3StoredObjectHeaders {
+			if strings.EqualFold(field, name) {
+				header.Set(name, values[0])
+			}
+		}
+	}
+	return header
+}
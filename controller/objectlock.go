@@ -0,0 +1,434 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// S3 对象锁定的两种保留模式：GOVERNANCE 可以由拥有 s3:BypassGovernanceRetention 权限的请求绕过，COMPLIANCE 在到期前任何人都不能缩短或删除。
+const (
+	objectLockGovernance = "GOVERNANCE"
+	objectLockCompliance = "COMPLIANCE"
+)
+
+// maxObjectLockRequestBodySize 限制 PutObjectRetention/PutObjectLegalHold 请求体的大小。
+const maxObjectLockRequestBodySize = 64 << 10
+
+// ObjectLockConfiguration 是存储桶的对象锁定配置。COS 只提供存储桶级别的合规保留，
+// 这里的保留期限和法律保留由代理自身记录并在覆盖、删除对象时执行，直接访问 COS 的请求不受限制。
+type ObjectLockConfiguration struct {
+	// Prefixes 是启用对象锁定的对象 key 前缀，为空时对整个存储桶生效
+	Prefixes []string
+	// DefaultMode 和 DefaultDays 是写入对象时未指定保留设置所使用的默认保留规则，DefaultDays 为 0 时没有默认规则
+	DefaultMode string
+	DefaultDays int
+}
+
+func (cfg ObjectLockConfiguration) validate() error {
+	switch {
+	case cfg.DefaultDays < 0:
+		return errors.New("object lock default retention days must be positive")
+	case cfg.DefaultDays == 0 && cfg.DefaultMode != "":
+		return errors.New("object lock default retention mode requires days")
+	case cfg.DefaultDays > 0 && cfg.DefaultMode != objectLockGovernance && cfg.DefaultMode != objectLockCompliance:
+		return fmt.Errorf("invalid object lock default retention mode %q", cfg.DefaultMode)
+	}
+	return nil
+}
+
+// covers 判断对象 key 是否位于启用对象锁定的前缀下，cfg 为 nil 表示存储桶没有启用对象锁定。
+func (cfg *ObjectLockConfiguration) covers(key string) bool {
+	if cfg == nil {
+		return false
+	}
+	if len(cfg.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range cfg.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type s3Retention struct {
+	XMLName         xml.Name `xml:"Retention"`
+	XMLNS           string   `xml:"xmlns,attr,omitempty"`
+	Mode            string   `xml:"Mode,omitempty"`
+	RetainUntilDate string   `xml:"RetainUntilDate,omitempty"`
+}
+
+type s3LegalHold struct {
+	XMLName xml.Name `xml:"LegalHold"`
+	XMLNS   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status"`
+}
+
+// parseRetention 校验保留模式和保留截止时间，两者必须同时指定或同时为空，截止时间必须晚于 now。
+func parseRetention(mode, retainUntilDate string, now time.Time) (objectLockState, error) {
+	var state objectLockState
+	if (mode == "") != (retainUntilDate == "") {
+		return state, errors.New("the retain until date and the object lock mode must both be supplied")
+	}
+	if mode == "" {
+		return state, nil
+	}
+	if mode != objectLockGovernance && mode != objectLockCompliance {
+		return state, fmt.Errorf("unknown object lock mode %q", mode)
+	}
+	retainUntil, err := time.Parse(time.RFC3339, retainUntilDate)
+	if err != nil {
+		return state, errors.New("the retain until date must be provided in ISO 8601 format")
+	}
+	if !retainUntil.After(now) {
+		return state, errors.New("the retain until date must be in the future")
+	}
+	state.Mode, state.RetainUntil = mode, retainUntil.UTC()
+	return state, nil
+}
+
+// objectLockFromHeader 读取写入对象时的 x-amz-object-lock-* 头部。
+func objectLockFromHeader(header http.Header, now time.Time) (objectLockState, error) {
+	state, err := parseRetention(header.Get("x-amz-object-lock-mode"), header.Get("x-amz-object-lock-retain-until-date"), now)
+	if err != nil {
+		return state, err
+	}
+	switch legalHold := header.Get("x-amz-object-lock-legal-hold"); legalHold {
+	case "":
+	case "ON", "OFF":
+		state.LegalHold, state.LegalHoldSet = legalHold == "ON", true
+	default:
+		return state, errors.New("legal hold must be either of 'ON' or 'OFF'")
+	}
+	return state, nil
+}
+
+// bypassGovernanceRetention 判断请求是否要求绕过 GOVERNANCE 模式的保留期限，准入中间件已经确认调用方拥有对应权限。
+func bypassGovernanceRetention(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("x-amz-bypass-governance-retention"), "true")
+}
+
+// objectLockBlocks 判断对象版本在 now 时是否禁止覆盖或删除。
+func objectLockBlocks(state objectLockState, bypass bool, now time.Time) bool {
+	if state.LegalHold {
+		return true
+	}
+	if !state.retained(now) {
+		return false
+	}
+	return state.Mode == objectLockCompliance || !bypass
+}
+
+// objectLockForWrite 解析写入请求指定的保留设置，不在对象锁定前缀下的对象不能指定保留设置。
+// 解析失败时写入错误响应并返回 false。
+func (ctrl *S3Controller) objectLockForWrite(c *gin.Context, bucket, key string, header http.Header) (objectLockState, bool) {
+	state, err := objectLockFromHeader(header, time.Now())
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return state, false
+	}
+	if state != (objectLockState{}) && !ctrl.Buckets.ObjectLock(bucket).covers(key) {
+		writeS3Error(c, http.StatusBadRequest, "InvalidRequest", "Bucket is missing Object Lock Configuration")
+		return state, false
+	}
+	return state, true
+}
+
+// checkObjectLock 在覆盖或删除对象版本之前检查保留状态，受保护时返回 403 并返回 false。
+// 未开启版本控制的存储桶中覆盖写入会替换对象本身，因此写入前检查 versionID 为空的记录。
+func (ctrl *S3Controller) checkObjectLock(c *gin.Context, bucket, key, versionID string) bool {
+	state, _ := ctrl.ObjectLocks.get(objectLockID(bucket, key, versionID))
+	if !objectLockBlocks(state, bypassGovernanceRetention(c), time.Now()) {
+		return true
+	}
+	writeS3Error(c, http.StatusForbidden, "AccessDenied", "Access Denied because object protected by object lock.")
+	return false
+}
+
+// saveObjectLock 在写入成功后记录新对象版本的保留状态，未指定保留期限时使用存储桶的默认保留规则。
+// 对象已经写入但保留状态保存失败时返回 500，客户端应当重试写入。
+func (ctrl *S3Controller) saveObjectLock(c *gin.Context, bucket, key, versionID string, state objectLockState) bool {
+	now := time.Now()
+	if cfg := ctrl.Buckets.ObjectLock(bucket); cfg.covers(key) && state.Mode == "" && cfg.DefaultDays > 0 {
+		state.Mode, state.RetainUntil = cfg.DefaultMode, now.AddDate(0, 0, cfg.DefaultDays).UTC()
+	}
+	if ctrl.ObjectLocks == nil && state == (objectLockState{}) {
+		return true
+	}
+	if err := ctrl.ObjectLocks.put(objectLockID(bucket, key, versionID), state); err != nil {
+		log.Printf("failed to save object lock state of %s/%s (version %q): %v", bucket, key, versionID, err)
+		writeS3Error(c, http.StatusInternalServerError, "InternalError", "The object was stored but its object lock settings could not be saved")
+		return false
+	}
+	return true
+}
+
+// forgetObjectLock 在对象版本被删除后清除其保留状态。
+func (ctrl *S3Controller) forgetObjectLock(bucket, key, versionID string) {
+	if ctrl.ObjectLocks == nil {
+		return
+	}
+	if err := ctrl.ObjectLocks.put(objectLockID(bucket, key, versionID), objectLockState{}); err != nil {
+		log.Printf("failed to clear object lock state of %s/%s (version %q): %v", bucket, key, versionID, err)
+	}
+}
+
+// writeS3ObjectLockHeaders 以 x-amz-object-lock-* 头部返回对象版本的保留状态。
+func (ctrl *S3Controller) writeS3ObjectLockHeaders(c *gin.Context, bucket, key, versionID string) {
+	state, ok := ctrl.ObjectLocks.get(objectLockID(bucket, key, versionID))
+	if !ok {
+		return
+	}
+	if state.Mode != "" {
+		c.Header("x-amz-object-lock-mode", state.Mode)
+		c.Header("x-amz-object-lock-retain-until-date", state.RetainUntil.Format(time.RFC3339))
+	}
+	switch {
+	case state.LegalHold:
+		c.Header("x-amz-object-lock-legal-hold", "ON")
+	case state.LegalHoldSet:
+		c.Header("x-amz-object-lock-legal-hold", "OFF")
+	}
+}
+
+// objectLockTarget 校验对象位于对象锁定前缀下并确认对象版本存在，返回保留状态使用的版本 ID。
+// 未指定 versionId 时使用 COS 返回的最新版本，未开启版本控制的存储桶中为空字符串。
+func (ctrl *S3Controller) objectLockTarget(c *gin.Context) (bucket, key, versionID string, ok bool) {
+	bucket, key = ctrl.extractBucketAndKey(c)
+	if key == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return "", "", "", false
+	}
+	if !ctrl.Buckets.ObjectLock(bucket).covers(key) {
+		writeS3Error(c, http.StatusBadRequest, "InvalidRequest", "Bucket is missing Object Lock Configuration")
+		return "", "", "", false
+	}
+
+	var versionIDs []string
+	if versionID := c.Query("versionId"); versionID != "" {
+		versionIDs = append(versionIDs, versionID)
+	}
+	resp, err := ctrl.cosClient(c).Object.Head(c.Request.Context(), key, nil, versionIDs...)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return "", "", "", false
+	}
+	resp.Body.Close()
+	versionID = resp.Header.Get("x-cos-version-id")
+	if versionID == "" {
+		versionID = c.Query("versionId")
+	}
+	return bucket, key, versionID, true
+}
+
+// readObjectLockBody 读取 PutObjectRetention/PutObjectLegalHold 的请求体并解析到 v 中，失败时写入错误响应。
+func (ctrl *S3Controller) readObjectLockBody(c *gin.Context, v interface{}) bool {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxObjectLockRequestBodySize+1))
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return false
+	}
+	if len(body) > maxObjectLockRequestBodySize {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return false
+	}
+	if err := verifyRequestBody(c); err != nil {
+		ctrl.handleCOSError(c, err)
+		return false
+	}
+	if err := xml.Unmarshal(body, v); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return false
+	}
+	return true
+}
+
+// GetObjectRetention 处理 S3 的 GET Object retention 请求。
+// GET /{bucket}/{key}?retention
+func (ctrl *S3Controller) GetObjectRetention(c *gin.Context) {
+	bucket, key, versionID, ok := ctrl.objectLockTarget(c)
+	if !ok {
+		return
+	}
+	state, _ := ctrl.ObjectLocks.get(objectLockID(bucket, key, versionID))
+	if state.Mode == "" {
+		writeS3Error(c, http.StatusNotFound, "NoSuchObjectLockConfiguration", "The specified object does not have a ObjectLock configuration")
+		return
+	}
+
+	payload := s3Retention{
+		XMLNS:           s3XMLNamespace,
+		Mode:            state.Mode,
+		RetainUntilDate: state.RetainUntil.Format(time.RFC3339),
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal GetObjectRetention response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// PutObjectRetention 处理 S3 的 PUT Object retention 请求。
+// 保留期限只能延长；缩短或移除 GOVERNANCE 模式的保留期限需要 x-amz-bypass-governance-retention，COMPLIANCE 模式在到期前不能缩短、移除或改为 GOVERNANCE。
+// PUT /{bucket}/{key}?retention
+func (ctrl *S3Controller) PutObjectRetention(c *gin.Context) {
+	bucket, key, versionID, ok := ctrl.objectLockTarget(c)
+	if !ok {
+		return
+	}
+	var retention s3Retention
+	if !ctrl.readObjectLockBody(c, &retention) {
+		return
+	}
+	now := time.Now()
+	requested, err := parseRetention(retention.Mode, retention.RetainUntilDate, now)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+
+	id := objectLockID(bucket, key, versionID)
+	state, _ := ctrl.ObjectLocks.get(id)
+	if state.retained(now) {
+		weakened := requested.Mode == "" || requested.RetainUntil.Before(state.RetainUntil) ||
+			(state.Mode == objectLockCompliance && requested.Mode != objectLockCompliance)
+		if weakened && (state.Mode == objectLockCompliance || !bypassGovernanceRetention(c)) {
+			writeS3Error(c, http.StatusForbidden, "AccessDenied", "Access Denied because object protected by object lock.")
+			return
+		}
+	}
+	state.Mode, state.RetainUntil = requested.Mode, requested.RetainUntil
+	if err := ctrl.ObjectLocks.put(id, state); err != nil {
+		log.Printf("failed to save object lock state of %s/%s (version %q): %v", bucket, key, versionID, err)
+		writeS3Error(c, http.StatusInternalServerError, "InternalError", "The object lock settings could not be saved")
+		return
+	}
+	if versionID != "" {
+		c.Header("x-amz-version-id", versionID)
+	}
+	c.Status(http.StatusOK)
+}
+
+// GetObjectLegalHold 处理 S3 的 GET Object legal hold 请求。
+// GET /{bucket}/{key}?legal-hold
+func (ctrl *S3Controller) GetObjectLegalHold(c *gin.Context) {
+	bucket, key, versionID, ok := ctrl.objectLockTarget(c)
+	if !ok {
+		return
+	}
+	state, _ := ctrl.ObjectLocks.get(objectLockID(bucket, key, versionID))
+	if !state.LegalHoldSet {
+		writeS3Error(c, http.StatusNotFound, "NoSuchObjectLockConfiguration", "The specified object does not have a ObjectLock configuration")
+		return
+	}
+
+	payload := s3LegalHold{XMLNS: s3XMLNamespace, Status: "OFF"}
+	if state.LegalHold {
+		payload.Status = "ON"
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal GetObjectLegalHold response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// PutObjectLegalHold 处理 S3 的 PUT Object legal hold 请求，法律保留与保留期限相互独立，开启期间对象不能被覆盖或删除。
+// PUT /{bucket}/{key}?legal-hold
+func (ctrl *S3Controller) PutObjectLegalHold(c *gin.Context) {
+	bucket, key, versionID, ok := ctrl.objectLockTarget(c)
+	if !ok {
+		return
+	}
+	var legalHold s3LegalHold
+	if !ctrl.readObjectLockBody(c, &legalHold) {
+		return
+	}
+	if legalHold.Status != "ON" && legalHold.Status != "OFF" {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+
+	id := objectLockID(bucket, key, versionID)
+	state, _ := ctrl.ObjectLocks.get(id)
+	state.LegalHold, state.LegalHoldSet = legalHold.Status == "ON", true
+	if err := ctrl.ObjectLocks.put(id, state); err != nil {
+		log.Printf("failed to save object lock state of %s/%s (version %q): %v", bucket, key, versionID, err)
+		writeS3Error(c, http.StatusInternalServerError, "InternalError", "The object lock settings could not be saved")
+		return
+	}
+	if versionID != "" {
+		c.Header("x-amz-version-id", versionID)
+	}
+	c.Status(http.StatusOK)
+}
+
+// GetObjectLockConfiguration 处理 S3 的 GET Bucket object lock configuration 请求，返回 BUCKETS_FILE 中配置的默认保留规则。
+// GET /{bucket}?object-lock
+func (ctrl *S3Controller) GetObjectLockConfiguration(c *gin.Context) {
+	bucket, _ := ctrl.extractBucketAndKey(c)
+	cfg := ctrl.Buckets.ObjectLock(bucket)
+	if cfg == nil {
+		writeS3Error(c, http.StatusNotFound, "ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket")
+		return
+	}
+
+	type defaultRetention struct {
+		Mode string `xml:"Mode"`
+		Days int    `xml:"Days"`
+	}
+	type rule struct {
+		DefaultRetention defaultRetention `xml:"DefaultRetention"`
+	}
+	payload := struct {
+		XMLName           xml.Name `xml:"ObjectLockConfiguration"`
+		XMLNS             string   `xml:"xmlns,attr"`
+		ObjectLockEnabled string   `xml:"ObjectLockEnabled"`
+		Rule              *rule    `xml:"Rule,omitempty"`
+	}{
+		XMLNS:             s3XMLNamespace,
+		ObjectLockEnabled: "Enabled",
+	}
+	if cfg.DefaultDays > 0 {
+		payload.Rule = &rule{DefaultRetention: defaultRetention{Mode: cfg.DefaultMode, Days: cfg.DefaultDays}}
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal GetObjectLockConfiguration response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// deleteObjectsAllowedByLock 将批量删除中受对象锁定保护的对象转换为 AccessDenied 错误，返回其余可以删除的对象。
+func (ctrl *S3Controller) deleteObjectsAllowedByLock(c *gin.Context, bucket string, objects []cos.Object) ([]cos.Object, []deleteError) {
+	var allowed []cos.Object
+	var denied []deleteError
+	bypass, now := bypassGovernanceRetention(c), time.Now()
+	for _, object := range objects {
+		state, _ := ctrl.ObjectLocks.get(objectLockID(bucket, object.Key, object.VersionId))
+		if objectLockBlocks(state, bypass, now) {
+			denied = append(denied, deleteError{
+				Key:       object.Key,
+				VersionID: object.VersionId,
+				Code:      "AccessDenied",
+				Message:   "Access Denied because object protected by object lock.",
+			})
+			continue
+		}
+		allowed = append(allowed, object)
+	}
+	return allowed, denied
+}
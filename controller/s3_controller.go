@@ -1,11 +1,21 @@
 package controllers
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -91,7 +101,7 @@ func (ctrl *S3Controller) ListObjects(c *gin.Context) {
 		hasMaxKeysParam = true
 	}
 
-	result, resp, err := ctrl.CosClient.Bucket.Get(c.Request.Context(), opt)
+	result, resp, err := ctrl.cosClient(c).Bucket.Get(c.Request.Context(), opt)
 	if err != nil {
 		ctrl.handleCOSError(c, err)
 		return
@@ -119,6 +129,9 @@ func (ctrl *S3Controller) ListObjects(c *gin.Context) {
 	}
 
 	contents := result.Contents
+	for i := range contents {
+		contents[i].StorageClass = s3StorageClassFromCOS(contents[i].StorageClass)
+	}
 	commonPrefixes := toListCommonPrefixes(result.CommonPrefixes)
 	markerValue := result.Marker
 	if markerValue == "" && opt.Marker != "" {
@@ -217,20 +230,220 @@ type listBucketResultV2 struct {
 	EncodingType          string             `xml:"EncodingType,omitempty"`
 }
 
+// maxDeleteObjects 是 S3 单次批量删除允许的最大对象数。
+const maxDeleteObjects = 1000
+
+// maxDeleteRequestBodySize 限制批量删除请求体的大小，1000 个最长 1024 字节的 key 远小于该值。
+const maxDeleteRequestBodySize = 2 << 20
+
+// DeleteObjects 处理 S3 的批量删除 (Multi-Object Delete) 请求。
+// POST /{bucket}?delete
+func (ctrl *S3Controller) DeleteObjects(c *gin.Context) {
+	bucket, key := ctrl.extractBucketAndKey(c)
+	if bucket == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid bucket"})
+		return
+	}
+	if key != "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "DeleteObjects is only supported at the bucket level"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxDeleteRequestBodySize+1))
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	if len(body) > maxDeleteRequestBodySize {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+
+	// S3 要求批量删除请求必须携带 Content-MD5（或新版 SDK 使用的 x-amz-checksum-*）用于校验请求体
+	if code, message := verifyRequestBodyChecksum(c.Request.Header, body); code != "" {
+		writeS3Error(c, http.StatusBadRequest, code, message)
+		return
+	}
+
+	var deleteRequest struct {
+		Quiet   bool `xml:"Quiet"`
+		Objects []struct {
+			Key       string `xml:"Key"`
+			VersionID string `xml:"VersionId"`
+		} `xml:"Object"`
+	}
+	if err := xml.Unmarshal(body, &deleteRequest); err != nil || len(deleteRequest.Objects) == 0 || len(deleteRequest.Objects) > maxDeleteObjects {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+
+	opt := &cos.ObjectDeleteMultiOptions{
+		Quiet:   deleteRequest.Quiet,
+		Objects: make([]cos.Object, len(deleteRequest.Objects)),
+	}
+	for i, object := range deleteRequest.Objects {
+		opt.Objects[i] = cos.Object{Key: object.Key, VersionId: object.VersionID}
+	}
+	// 受对象锁定保护的对象不发送给 COS，直接作为删除失败返回
+	var denied []deleteError
+	opt.Objects, denied = ctrl.deleteObjectsAllowedByLock(c, bucket, opt.Objects)
+
+	// 调用 COS SDK 批量删除对象
+	result := &cos.ObjectDeleteMultiResult{}
+	if len(opt.Objects) > 0 {
+		var resp *cos.Response
+		result, resp, err = ctrl.cosClient(c).Object.DeleteMulti(c.Request.Context(), opt)
+		if err != nil {
+			ctrl.handleCOSError(c, err)
+			return
+		}
+		if resp != nil {
+			if resp.Body != nil {
+				defer resp.Body.Close()
+			}
+			logCOSResponse("DeleteObjects", resp)
+		}
+	}
+
+	payload := deleteResult{XMLNS: s3XMLNamespace}
+	for _, deleted := range result.DeletedObjects {
+		ctrl.forgetObjectLock(bucket, deleted.Key, deleted.VersionId)
+		// Quiet 模式下只返回删除失败的对象
+		if !deleteRequest.Quiet {
+			payload.Deleted = append(payload.Deleted, deletedObject{Key: deleted.Key, VersionID: deleted.VersionId})
+		}
+	}
+	payload.Errors = append(payload.Errors, denied...)
+	for _, failed := range result.Errors {
+		payload.Errors = append(payload.Errors, deleteError{
+			Key:       failed.Key,
+			VersionID: failed.VersionId,
+			Code:      failed.Code,
+			Message:   failed.Message,
+		})
+	}
+
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal DeleteObjects response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+type deletedObject struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+}
+
+type deleteError struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	XMLNS   string          `xml:"xmlns,attr"`
+	Deleted []deletedObject `xml:"Deleted,omitempty"`
+	Errors  []deleteError   `xml:"Error,omitempty"`
+}
+
+// ListBuckets 处理 S3 的 ListBuckets 请求，返回代理中已配置的全部存储桶。
+// GET /
+func (ctrl *S3Controller) ListBuckets(c *gin.Context) {
+	payload := listAllMyBucketsResult{
+		XMLNS: s3XMLNamespace,
+		Owner: bucketOwner{ID: "cos-proxy", DisplayName: "cos-proxy"},
+	}
+	for _, name := range ctrl.Buckets.Names() {
+		payload.Buckets = append(payload.Buckets, listedBucket{
+			Name:         name,
+			CreationDate: ctrl.Buckets.CreationDate(name).Format("2006-01-02T15:04:05.000Z"),
+		})
+	}
+
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal ListBuckets response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+type bucketOwner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type listedBucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name       `xml:"ListAllMyBucketsResult"`
+	XMLNS   string         `xml:"xmlns,attr"`
+	Owner   bucketOwner    `xml:"Owner"`
+	Buckets []listedBucket `xml:"Buckets>Bucket"`
+}
+
+// HeadBucket 处理 S3 的 HEAD Bucket 请求，由 COS 判断存储桶是否存在以及是否有访问权限。
+// HEAD /{bucket}
+func (ctrl *S3Controller) HeadBucket(c *gin.Context) {
+	bucket, _ := ctrl.extractBucketAndKey(c)
+	resp, err := ctrl.cosClient(c).Bucket.Head(c.Request.Context())
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("HeadBucket", resp)
+
+	if region := ctrl.Buckets.Region(bucket); region != "" {
+		c.Header("x-amz-bucket-region", region)
+	}
+	c.Status(http.StatusOK)
+}
+
+// GetBucketLocation 处理 S3 的 GetBucketLocation 请求，返回存储桶所在的 COS 地域，例如 ap-guangzhou。
+// GET /{bucket}?location
+func (ctrl *S3Controller) GetBucketLocation(c *gin.Context) {
+	bucket, _ := ctrl.extractBucketAndKey(c)
+	payload := struct {
+		XMLName xml.Name `xml:"LocationConstraint"`
+		XMLNS   string   `xml:"xmlns,attr"`
+		Region  string   `xml:",chardata"`
+	}{
+		XMLNS:  s3XMLNamespace,
+		Region: ctrl.Buckets.Region(bucket),
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal GetBucketLocation response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
 // S3Controller 负责处理所有传入的 S3 API 兼容请求。
 type S3Controller struct {
 	// BaseDomain 是代理服务的基础域名，例如 "proxy.example.com"。
 	// 这个字段对于解析虚拟托管类型 (Virtual-Hosted Style) 的请求至关重要。
 	BaseDomain string
-	CosClient  *cos.Client
+	// Buckets 将请求中的存储桶名称映射到对应的 COS 客户端。
+	Buckets *BucketRegistry
+	// ObjectLocks 保存对象的保留期限和法律保留状态，没有存储桶启用对象锁定时可以为 nil。
+	ObjectLocks *ObjectLockStore
 }
 
 // NewS3Controller 创建一个新的 S3Controller 实例。
 // baseDomain 是代理服务配置的域名，用于区分存储桶名称。
-func NewS3Controller(baseDomain string, cosClient *cos.Client) *S3Controller {
+func NewS3Controller(baseDomain string, buckets *BucketRegistry) *S3Controller {
 	return &S3Controller{
 		BaseDomain: baseDomain,
-		CosClient:  cosClient,
+		Buckets:    buckets,
 	}
 }
 
@@ -246,15 +459,172 @@ func (ctrl *S3Controller) RegisterRoutes(router *gin.Engine) {
 
 // s3RequestDispatcher 是一个中央分发器，根据 HTTP 方法和查询参数将请求路由到正确的处理函数。
 func (ctrl *S3Controller) s3RequestDispatcher(c *gin.Context) {
+	// 每个请求都必须指向一个已注册的存储桶，未知名称不能落入任何默认存储桶
+	bucket, key := ctrl.extractBucketAndKey(c)
+	if bucket == "" {
+		if c.Request.Method == http.MethodGet {
+			// 没有存储桶的 GET / 是 ListBuckets 请求
+			ctrl.ListBuckets(c)
+			return
+		}
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid bucket"})
+		return
+	}
+	client := ctrl.Buckets.Lookup(bucket)
+	if client == nil {
+		writeS3Error(c, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	c.Set(cosClientContextKey, client)
+
+	// 未实现的子资源 (例如 ?acl、?versioning) 不能落入普通的对象操作，否则会覆盖或删除对象本身
+	if subResource := unsupportedSubResource(c.Request.URL.Query()); subResource != "" {
+		log.Printf("subresource not implemented: %s %s?%s", c.Request.Method, c.Param("path"), c.Request.URL.RawQuery)
+		writeS3Error(c, http.StatusNotImplemented, "NotImplemented", fmt.Sprintf("The %s subresource is not implemented", subResource))
+		return
+	}
+
+	// 存储桶级别的查询操作
+	if key == "" {
+		if _, ok := c.Request.URL.Query()["location"]; ok && c.Request.Method == http.MethodGet {
+			ctrl.GetBucketLocation(c)
+			return
+		}
+		if c.Request.Method == http.MethodHead {
+			ctrl.HeadBucket(c)
+			return
+		}
+	}
+
+	if _, ok := c.Request.URL.Query()["versions"]; ok && c.Request.Method == "GET" {
+		ctrl.ListObjectVersions(c)
+		return
+	}
+	if _, ok := c.Request.URL.Query()["versioning"]; ok {
+		if c.Request.Method != "GET" {
+			writeS3Error(c, http.StatusNotImplemented, "NotImplemented", "Bucket versioning configuration must be changed in COS")
+			return
+		}
+		ctrl.GetBucketVersioning(c)
+		return
+	}
+	if _, ok := c.Request.URL.Query()["acl"]; ok {
+		switch {
+		case c.Request.Method == "GET" && key == "":
+			ctrl.GetBucketAcl(c)
+		case c.Request.Method == "GET":
+			ctrl.GetObjectAcl(c)
+		case c.Request.Method == "PUT" && key == "":
+			writeS3Error(c, http.StatusNotImplemented, "NotImplemented", "Bucket ACL modification is not implemented")
+		case c.Request.Method == "PUT":
+			ctrl.PutObjectAcl(c)
+		default:
+			c.XML(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed."})
+		}
+		return
+	}
+	if _, ok := c.Request.URL.Query()["tagging"]; ok {
+		if key == "" {
+			writeS3Error(c, http.StatusNotImplemented, "NotImplemented", "Bucket tagging is not implemented")
+			return
+		}
+		switch c.Request.Method {
+		case "GET":
+			ctrl.GetObjectTagging(c)
+		case "PUT":
+			ctrl.PutObjectTagging(c)
+		case "DELETE":
+			ctrl.DeleteObjectTagging(c)
+		default:
+			c.XML(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed."})
+		}
+		return
+	}
+	if _, ok := c.Request.URL.Query()["restore"]; ok {
+		// 只有 POST /{key}?restore 是 RestoreObject (恢复归档对象) 请求
+		if c.Request.Method != "POST" || key == "" {
+			c.XML(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed."})
+			return
+		}
+		ctrl.RestoreObject(c)
+		return
+	}
+	if _, ok := c.Request.URL.Query()["object-lock"]; ok {
+		switch {
+		case c.Request.Method == "GET" && key == "":
+			ctrl.GetObjectLockConfiguration(c)
+		case c.Request.Method == "PUT" && key == "":
+			writeS3Error(c, http.StatusNotImplemented, "NotImplemented", "Object lock configuration must be changed in BUCKETS_FILE")
+		default:
+			c.XML(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed."})
+		}
+		return
+	}
+	if _, ok := c.Request.URL.Query()["retention"]; ok {
+		switch c.Request.Method {
+		case "GET":
+			ctrl.GetObjectRetention(c)
+		case "PUT":
+			ctrl.PutObjectRetention(c)
+		default:
+			c.XML(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed."})
+		}
+		return
+	}
+	if _, ok := c.Request.URL.Query()["legal-hold"]; ok {
+		switch c.Request.Method {
+		case "GET":
+			ctrl.GetObjectLegalHold(c)
+		case "PUT":
+			ctrl.PutObjectLegalHold(c)
+		default:
+			c.XML(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed."})
+		}
+		return
+	}
+	// 存储桶配置子资源转换为 COS 对应的存储桶配置接口
+	if _, ok := c.Request.URL.Query()["cors"]; ok {
+		ctrl.dispatchBucketConfiguration(c, key, ctrl.GetBucketCors, ctrl.PutBucketCors, ctrl.DeleteBucketCors)
+		return
+	}
+	if _, ok := c.Request.URL.Query()["lifecycle"]; ok {
+		ctrl.dispatchBucketConfiguration(c, key, ctrl.GetBucketLifecycleConfiguration, ctrl.PutBucketLifecycleConfiguration, ctrl.DeleteBucketLifecycle)
+		return
+	}
+	if _, ok := c.Request.URL.Query()["policy"]; ok {
+		ctrl.dispatchBucketConfiguration(c, key, ctrl.GetBucketPolicy, ctrl.PutBucketPolicy, ctrl.DeleteBucketPolicy)
+		return
+	}
+	if _, ok := c.Request.URL.Query()["website"]; ok {
+		ctrl.dispatchBucketConfiguration(c, key, ctrl.GetBucketWebsite, ctrl.PutBucketWebsite, ctrl.DeleteBucketWebsite)
+		return
+	}
+
 	// 根据 S3 API 规范，分片上传操作通过查询参数来区分
 	if _, ok := c.Request.URL.Query()["uploads"]; ok {
-		// 这是 CreateMultipartUpload 请求
-		ctrl.CreateMultipartUpload(c)
+		switch c.Request.Method {
+		case "GET":
+			// 这是 ListMultipartUploads 请求
+			ctrl.ListMultipartUploads(c)
+		case "POST":
+			// 这是 CreateMultipartUpload 请求
+			ctrl.CreateMultipartUpload(c)
+		default:
+			c.XML(http.StatusBadRequest, gin.H{"error": "Invalid request method for multipart upload."})
+		}
 		return
 	}
 	if _, ok := c.Request.URL.Query()["uploadId"]; ok {
 		switch c.Request.Method {
+		case "GET":
+			// 这是 ListParts 请求
+			ctrl.ListParts(c)
 		case "PUT":
+			if c.GetHeader("x-amz-copy-source") != "" {
+				// 这是 UploadPartCopy 请求
+				ctrl.UploadPartCopy(c)
+				return
+			}
 			// 这是 UploadPart 请求
 			ctrl.UploadPart(c)
 		case "POST":
@@ -272,19 +642,26 @@ func (ctrl *S3Controller) s3RequestDispatcher(c *gin.Context) {
 	// 处理单一对象操作
 	switch c.Request.Method {
 	case "GET":
-		bucket, key := ctrl.extractBucketAndKey(c)
 		if key == "" {
 			ctrl.ListObjects(c)
 			return
 		}
-		if bucket == "" {
-			c.XML(http.StatusBadRequest, gin.H{"error": "Invalid bucket"})
-			return
-		}
 		ctrl.GetObject(c)
+	case "HEAD":
+		ctrl.HeadObject(c)
 	case "PUT":
+		if c.GetHeader("x-amz-copy-source") != "" {
+			// 带有 x-amz-copy-source 头部的 PUT 是 CopyObject 请求
+			ctrl.CopyObject(c)
+			return
+		}
 		ctrl.PutObject(c)
 	case "POST":
+		if _, ok := c.Request.URL.Query()["delete"]; ok {
+			// 这是 DeleteObjects (批量删除) 请求
+			ctrl.DeleteObjects(c)
+			return
+		}
 		// POST 通常用于基于浏览器的上传，它不遵循标准的 bucket/key 路径
 		ctrl.PostObject(c)
 	case "DELETE":
@@ -302,7 +679,7 @@ func (ctrl *S3Controller) s3RequestDispatcher(c *gin.Context) {
 // PutObject 处理 S3 的 PUT Object 请求。
 // PUT /{bucket}/{key} 或 https://{bucket}.example.com/{key}
 func (ctrl *S3Controller) PutObject(c *gin.Context) {
-	_, key := ctrl.extractBucketAndKey(c)
+	bucket, key := ctrl.extractBucketAndKey(c)
 	if key == "" {
 		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
 		return
@@ -316,54 +693,126 @@ func (ctrl *S3Controller) PutObject(c *gin.Context) {
 		},
 	}
 
-	// 提取并设置自定义元数据 (x-amz-meta-* -> x-cos-meta-*)
-	for h, v := range c.Request.Header {
-		if strings.HasPrefix(strings.ToLower(h), "x-amz-meta-") {
-			if opt.ObjectPutHeaderOptions.XCosMetaXXX == nil {
-				opt.ObjectPutHeaderOptions.XCosMetaXXX = &http.Header{}
-			}
-			// 将 x-amz-meta- 转换为 x-cos-meta-
-			cosMetaKey := "x-cos-meta-" + strings.TrimPrefix(strings.ToLower(h), "x-amz-meta-")
-			opt.ObjectPutHeaderOptions.XCosMetaXXX.Set(cosMetaKey, v[0])
-		}
+	// 提取并设置标准元数据头部和自定义元数据 (x-amz-meta-* -> x-cos-meta-*)
+	setCOSObjectMetadata(opt.ObjectPutHeaderOptions, c.Request.Header)
+
+	// 存储类型 (x-amz-storage-class -> x-cos-storage-class)
+	storageClass, err := cosStorageClassFromS3(c.GetHeader("x-amz-storage-class"))
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidStorageClass", err.Error())
+		return
+	}
+	opt.ObjectPutHeaderOptions.XCosStorageClass = storageClass
+
+	// 服务端加密 (x-amz-server-side-encryption* -> x-cos-server-side-encryption*)
+	encryption, err := s3EncryptionFromHeader(c.Request.Header)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	if !ctrl.checkEncryptionRequired(c, encryption) {
+		return
+	}
+
+	// 上传时附带的标签 (x-amz-tagging -> x-cos-tagging)
+	tagging, err := cosTaggingHeader(c.Request.Header)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidTag", err.Error())
+		return
+	}
+	opt.ObjectPutHeaderOptions.XOptionHeader = tagging
+	encryption.applyToPut(opt.ObjectPutHeaderOptions)
+
+	// 预设 ACL 和授权头部 (x-amz-acl/x-amz-grant-* -> x-cos-acl/x-cos-grant-*)
+	if opt.ACLHeaderOptions, err = cosACLHeaderFromS3(c.Request.Header); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+
+	// 对象锁定：解析写入时指定的保留设置，受保护的对象不能被覆盖
+	lock, ok := ctrl.objectLockForWrite(c, bucket, key, c.Request.Header)
+	if !ok || !ctrl.checkObjectLock(c, bucket, key, "") {
+		return
+	}
+
+	// 条件写入：If-None-Match: * 只在对象不存在时创建，If-Match 只在 ETag 一致时覆盖
+	if !ctrl.checkWritePreconditions(c, key) {
+		return
 	}
+	opt.ObjectPutHeaderOptions.XOptionHeader = withForbidOverwrite(c, opt.ObjectPutHeaderOptions.XOptionHeader)
 
 	// 调用 COS SDK 上传对象
-	resp, err := ctrl.CosClient.Object.Put(c.Request.Context(), key, c.Request.Body, opt)
+	resp, err := ctrl.cosClient(c).Object.Put(c.Request.Context(), key, c.Request.Body, opt)
 	if err != nil {
-		ctrl.handleCOSError(c, err)
+		ctrl.handleWriteError(c, err)
 		return
 	}
 	defer resp.Body.Close()
 
 	logCOSResponse("PutObject", resp)
 
+	// 请求体摘要与签名不一致时，删除已经写入的对象
+	if err := verifyRequestBody(c); err != nil {
+		log.Printf("PutObject body verification failed for %s, deleting uploaded object: %v", key, err)
+		if delResp, delErr := ctrl.cosClient(c).Object.Delete(c.Request.Context(), key); delErr != nil {
+			log.Printf("failed to delete unverified object %s: %v", key, delErr)
+		} else {
+			delResp.Body.Close()
+		}
+		ctrl.handleCOSError(c, err)
+		return
+	}
+
+	if !ctrl.saveObjectLock(c, bucket, key, resp.Header.Get("x-cos-version-id"), lock) {
+		return
+	}
+
 	// 将 COS 返回的头部（特别是 ETag）透传给客户端
 	for key, values := range resp.Header {
 		for _, value := range values {
 			c.Header(key, value)
 		}
 	}
+	writeS3VersionID(c, resp.Header)
+	writeS3EncryptionHeaders(c, resp.Header)
 	c.Status(resp.StatusCode)
 }
 
 // GetObject 处理 S3 的 GET Object 请求。
 // GET /{bucket}/{key} 或 https://{bucket}.example.com/{key}
 func (ctrl *S3Controller) GetObject(c *gin.Context) {
-	_, key := ctrl.extractBucketAndKey(c)
+	bucket, key := ctrl.extractBucketAndKey(c)
 	if key == "" {
 		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
 		return
 	}
+	if rejectAnonymousResponseOverrides(c) {
+		return
+	}
 
 	// 准备 COS SDK 的 GetObjectOptions，并透传 Range 头
 	opt := &cos.ObjectGetOptions{}
 	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" {
 		opt.Range = rangeHeader
 	}
+	// 透传条件请求头部，COS 按条件返回 304/412
+	opt.XOptionHeader = cosConditionalHeader(c.Request.Header)
+	// 读取 SSE-C 对象时需要提供上传时使用的密钥
+	customerKey, err := s3CustomerKey(c.Request.Header, s3CustomerKeyPrefix)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	opt.XCosSSECustomerAglo, opt.XCosSSECustomerKey, opt.XCosSSECustomerKeyMD5 = customerKey.algorithm, customerKey.key, customerKey.keyMD5
+
+	// 指定 versionId 时读取对象的历史版本
+	var versionIDs []string
+	if versionID := c.Query("versionId"); versionID != "" {
+		versionIDs = append(versionIDs, versionID)
+	}
 
 	// 调用 COS SDK 获取对象
-	resp, err := ctrl.CosClient.Object.Get(c.Request.Context(), key, opt)
+	resp, err := ctrl.cosClient(c).Object.Get(c.Request.Context(), key, opt, versionIDs...)
 	if err != nil {
 		ctrl.handleCOSError(c, err)
 		return
@@ -376,27 +825,86 @@ func (ctrl *S3Controller) GetObject(c *gin.Context) {
 			c.Header(key, value)
 		}
 	}
+	writeS3StorageHeaders(c, resp.Header)
+	writeS3VersionID(c, resp.Header)
+	writeS3EncryptionHeaders(c, resp.Header)
+	ctrl.writeS3ObjectLockHeaders(c, bucket, key, resp.Header.Get("x-cos-version-id"))
+	writeS3ResponseOverrides(c)
 
 	// 将 COS 的响应体流式传输给客户端
-	c.DataFromReader(resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, nil)
+	c.DataFromReader(resp.StatusCode, resp.ContentLength, c.Writer.Header().Get("Content-Type"), resp.Body, nil)
+}
+
+// HeadObject 处理 S3 的 HEAD Object 请求。
+// HEAD /{bucket}/{key} 或 https://{bucket}.example.com/{key}
+func (ctrl *S3Controller) HeadObject(c *gin.Context) {
+	bucket, key := ctrl.extractBucketAndKey(c)
+	if key == "" {
+		// HEAD 响应不能携带响应体
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if rejectAnonymousResponseOverrides(c) {
+		return
+	}
+
+	var versionIDs []string
+	if versionID := c.Query("versionId"); versionID != "" {
+		versionIDs = append(versionIDs, versionID)
+	}
+
+	customerKey, err := s3CustomerKey(c.Request.Header, s3CustomerKeyPrefix)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	// 调用 COS SDK 获取对象元数据
+	opt := &cos.ObjectHeadOptions{
+		XCosSSECustomerAglo:   customerKey.algorithm,
+		XCosSSECustomerKey:    customerKey.key,
+		XCosSSECustomerKeyMD5: customerKey.keyMD5,
+		XOptionHeader:         cosConditionalHeader(c.Request.Header),
+	}
+	resp, err := ctrl.cosClient(c).Object.Head(c.Request.Context(), key, opt, versionIDs...)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// 将 COS 的元数据头部转换为 S3 语义后返回
+	writeS3ObjectHeaders(c, resp.Header)
+	ctrl.writeS3ObjectLockHeaders(c, bucket, key, resp.Header.Get("x-cos-version-id"))
+	writeS3ResponseOverrides(c)
+	c.Status(http.StatusOK)
 }
 
 // DeleteObject 处理 S3 的 DELETE Object 请求。
 // DELETE /{bucket}/{key} 或 https://{bucket}.example.com/{key}
 func (ctrl *S3Controller) DeleteObject(c *gin.Context) {
-	_, key := ctrl.extractBucketAndKey(c)
+	bucket, key := ctrl.extractBucketAndKey(c)
 	if key == "" {
 		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
 		return
 	}
 
+	// 指定 versionId 时永久删除该版本，否则在开启版本控制的存储桶中只会创建删除标记
+	opt := &cos.ObjectDeleteOptions{VersionId: c.Query("versionId")}
+	if !ctrl.checkObjectLock(c, bucket, key, opt.VersionId) {
+		return
+	}
+
 	// 调用 COS SDK 删除对象
-	resp, err := ctrl.CosClient.Object.Delete(c.Request.Context(), key)
+	resp, err := ctrl.cosClient(c).Object.Delete(c.Request.Context(), key, opt)
 	if err != nil {
 		ctrl.handleCOSError(c, err)
 		return
 	}
 	defer resp.Body.Close()
+	logCOSResponse("DeleteObject", resp)
+	writeS3VersionID(c, resp.Header)
+	ctrl.forgetObjectLock(bucket, key, opt.VersionId)
 
 	// 根据 S3 规范，成功删除（无论对象是否存在）都应返回 204 No Content
 	// COS SDK 在对象不存在时也会返回 204，正好符合要求
@@ -418,7 +926,7 @@ func (ctrl *S3Controller) PostObject(c *gin.Context) {
 		return
 	}
 
-	// 提取 'key' 和 'file' 字段，忽略所有认证相关字段
+	// 提取 'key' 和 'file' 字段，POST policy 签名等认证字段已由准入中间件校验
 	keyValues, okKey := form.Value["key"]
 	fileHeaders, okFile := form.File["file"]
 	if !okKey || len(keyValues) == 0 || !okFile || len(fileHeaders) == 0 {
@@ -440,21 +948,64 @@ func (ctrl *S3Controller) PostObject(c *gin.Context) {
 	}
 	defer file.Close()
 
+	// 表单中的 Content-Type 字段优先于文件分段自身的 Content-Type
+	contentType := PostFormValue(form, "Content-Type")
+	if contentType == "" {
+		contentType = fileHeaders[0].Header.Get("Content-Type")
+	}
+
 	// 准备 COS SDK 的 PutObjectOptions
 	opt := &cos.ObjectPutOptions{
 		ObjectPutHeaderOptions: &cos.ObjectPutHeaderOptions{
-			ContentType:   fileHeaders[0].Header.Get("Content-Type"),
+			ContentType:   contentType,
 			ContentLength: fileHeaders[0].Size,
 		},
 	}
-
-	// 调用 COS SDK 上传对象
-	resp, err := ctrl.CosClient.Object.Put(c.Request.Context(), key, file, opt)
+	// 表单中的 Cache-Control、Content-Disposition 等字段和 x-amz-meta-* 字段随对象保存
+	setCOSObjectMetadata(opt.ObjectPutHeaderOptions, postObjectMetadata(form))
+	if opt.ObjectPutHeaderOptions.XCosStorageClass, err = cosStorageClassFromS3(PostFormValue(form, "x-amz-storage-class")); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidStorageClass", err.Error())
+		return
+	}
+	// 服务端加密参数以同名表单字段提交
+	encryptionHeader := http.Header{}
+	for _, name := range s3EncryptionHeaders {
+		if value := PostFormValue(form, name); value != "" {
+			encryptionHeader.Set(name, value)
+		}
+	}
+	encryption, err := s3EncryptionFromHeader(encryptionHeader)
 	if err != nil {
-		ctrl.handleCOSError(c, err)
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
 		return
 	}
-	defer resp.Body.Close()
+	if !ctrl.checkEncryptionRequired(c, encryption) {
+		return
+	}
+	encryption.applyToPut(opt.ObjectPutHeaderOptions)
+
+	// 受对象锁定保护的对象不能被表单上传覆盖，新对象使用存储桶的默认保留规则
+	bucket, _ := ctrl.extractBucketAndKey(c)
+	if !ctrl.checkObjectLock(c, bucket, key, "") {
+		return
+	}
+	// 表单中的 acl 字段是 S3 预设 ACL
+	if canned := PostFormValue(form, "acl"); canned != "" {
+		cosACL, ok := cosObjectCannedACLs[canned]
+		if !ok {
+			writeS3Error(c, http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("the canned ACL %q is not supported", canned))
+			return
+		}
+		opt.ACLHeaderOptions = &cos.ACLHeaderOptions{XCosACL: cosACL}
+	}
+
+	// 调用 COS SDK 上传对象
+	resp, err := ctrl.cosClient(c).Object.Put(c.Request.Context(), key, file, opt)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
 
 	// 将 COS 返回的头部透传给客户端
 	for h, values := range resp.Header {
@@ -462,7 +1013,197 @@ func (ctrl *S3Controller) PostObject(c *gin.Context) {
 			c.Header(h, value)
 		}
 	}
-	c.Status(resp.StatusCode)
+	writeS3EncryptionHeaders(c, resp.Header)
+	if !ctrl.saveObjectLock(c, bucket, key, resp.Header.Get("x-cos-version-id"), objectLockState{}) {
+		return
+	}
+
+	etag := resp.Header.Get("ETag")
+
+	// success_action_redirect 优先于 success_action_status，与 S3 的行为一致
+	if redirect := PostFormValue(form, "success_action_redirect"); redirect != "" {
+		if target, err := url.Parse(redirect); err == nil && (target.Scheme == "http" || target.Scheme == "https") {
+			query := target.Query()
+			query.Set("bucket", bucket)
+			query.Set("key", key)
+			query.Set("etag", etag)
+			target.RawQuery = query.Encode()
+			c.Redirect(http.StatusSeeOther, target.String())
+			return
+		}
+	}
+
+	switch status := PostFormValue(form, "success_action_status"); status {
+	case "":
+		c.Status(resp.StatusCode)
+	case "200":
+		c.Status(http.StatusOK)
+	case "201":
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		// 表单提交的目标是存储桶地址，对象地址为其后追加 key
+		location := scheme + "://" + c.Request.Host + strings.TrimSuffix(c.Request.URL.Path, "/") + "/" + escapeObjectKey(key)
+		payload := postResponse{
+			Location: location,
+			Bucket:   bucket,
+			Key:      key,
+			ETag:     etag,
+		}
+		encoded, err := xml.MarshalIndent(payload, "", "  ")
+		if err != nil {
+			c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal PostObject response"})
+			return
+		}
+		c.Data(http.StatusCreated, "application/xml", []byte(xml.Header+string(encoded)))
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+type postResponse struct {
+	XMLName  xml.Name `xml:"PostResponse"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// PostFormValue 按照 S3 的规则不区分大小写地读取表单字段。
+func PostFormValue(form *multipart.Form, name string) string {
+	for field, values := range form.Value {
+		if strings.EqualFold(field, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// CopyObject 处理 S3 的服务端复制请求 (PUT Object - Copy)。
+// PUT /{bucket}/{key}，并携带 x-amz-copy-source: /{bucket}/{source-key}
+func (ctrl *S3Controller) CopyObject(c *gin.Context) {
+	bucket, key := ctrl.extractBucketAndKey(c)
+	if key == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	sourceBucket, sourceKey, sourceVersionID, err := ParseCopySource(c.GetHeader("x-amz-copy-source"))
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 没有指定版本号时 SDK 会在第一个 '?' 处拆分复制源，包含 '?' 的 key 无法被正确复制
+	if sourceVersionID == "" && strings.Contains(sourceKey, "?") {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", errUnsupportedCopySourceKey.Error())
+		return
+	}
+	sourceClient := ctrl.Buckets.Lookup(sourceBucket)
+	if sourceClient == nil {
+		writeS3Error(c, http.StatusNotFound, "NoSuchBucket", "The specified copy source bucket does not exist")
+		return
+	}
+
+	headerOpt := &cos.ObjectCopyHeaderOptions{
+		XCosCopySourceIfMatch:           c.GetHeader("x-amz-copy-source-if-match"),
+		XCosCopySourceIfNoneMatch:       c.GetHeader("x-amz-copy-source-if-none-match"),
+		XCosCopySourceIfModifiedSince:   c.GetHeader("x-amz-copy-source-if-modified-since"),
+		XCosCopySourceIfUnmodifiedSince: c.GetHeader("x-amz-copy-source-if-unmodified-since"),
+	}
+
+	// x-amz-metadata-directive 默认为 COPY，即沿用源对象的元数据
+	switch strings.ToUpper(c.GetHeader("x-amz-metadata-directive")) {
+	case "", "COPY":
+		headerOpt.XCosMetadataDirective = "Copy"
+	case "REPLACE":
+		headerOpt.XCosMetadataDirective = "Replaced"
+		headerOpt.ContentType = c.GetHeader("Content-Type")
+		headerOpt.CacheControl = c.GetHeader("Cache-Control")
+		headerOpt.ContentDisposition = c.GetHeader("Content-Disposition")
+		headerOpt.ContentEncoding = c.GetHeader("Content-Encoding")
+		headerOpt.Expires = c.GetHeader("Expires")
+		headerOpt.XCosMetaXXX = cosMetaHeaderFromS3(c.Request.Header)
+	default:
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid x-amz-metadata-directive"})
+		return
+	}
+	// 复制时可以通过 x-amz-storage-class 转换存储类型，包括复制到对象自身
+	if headerOpt.XCosStorageClass, err = cosStorageClassFromS3(c.GetHeader("x-amz-storage-class")); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidStorageClass", err.Error())
+		return
+	}
+	// 目标对象的加密方式由 x-amz-server-side-encryption* 指定，复制 SSE-C 源对象时需要提供源对象的密钥
+	encryption, err := s3EncryptionFromHeader(c.Request.Header)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	if !ctrl.checkEncryptionRequired(c, encryption) {
+		return
+	}
+	encryption.applyToCopy(headerOpt)
+	sourceCustomerKey, err := s3CustomerKey(c.Request.Header, s3CopySourceCustomerKeyPrefix)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	headerOpt.XCosCopySourceSSECustomerAglo = sourceCustomerKey.algorithm
+	headerOpt.XCosCopySourceSSECustomerKey = sourceCustomerKey.key
+	headerOpt.XCosCopySourceSSECustomerKeyMD5 = sourceCustomerKey.keyMD5
+	// 复制不会继承源对象的保留状态，目标对象的保留设置由 x-amz-object-lock-* 指定
+	lock, ok := ctrl.objectLockForWrite(c, bucket, key, c.Request.Header)
+	if !ok || !ctrl.checkObjectLock(c, bucket, key, "") {
+		return
+	}
+
+	// COS 要求复制源为 <bucket-host>/<key> 的形式，SDK 会负责对 key 进行编码
+	sourceURL := sourceClient.BaseURL.BucketURL.Host + "/" + sourceKey
+	var versionIDs []string
+	if sourceVersionID != "" {
+		versionIDs = append(versionIDs, sourceVersionID)
+	}
+
+	opt := &cos.ObjectCopyOptions{ObjectCopyHeaderOptions: headerOpt}
+	result, resp, err := ctrl.cosClient(c).Object.Copy(c.Request.Context(), key, sourceURL, opt, versionIDs...)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	var versionID string
+	if resp != nil {
+		if resp.Body != nil {
+			defer resp.Body.Close()
+		}
+		logCOSResponse("CopyObject", resp)
+		if versionID = resp.Header.Get("x-cos-version-id"); versionID != "" {
+			c.Header("x-amz-version-id", versionID)
+		}
+		writeS3EncryptionHeaders(c, resp.Header)
+	}
+	if !ctrl.saveObjectLock(c, bucket, key, versionID, lock) {
+		return
+	}
+	if sourceVersionID != "" {
+		c.Header("x-amz-copy-source-version-id", sourceVersionID)
+	}
+
+	payload := struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		XMLNS        string   `xml:"xmlns,attr"`
+		LastModified string   `xml:"LastModified"`
+		ETag         string   `xml:"ETag"`
+	}{
+		XMLNS:        s3XMLNamespace,
+		LastModified: result.LastModified,
+		ETag:         result.ETag,
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal CopyObject response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
 }
 
 // ===================================================================
@@ -484,19 +1225,41 @@ func (ctrl *S3Controller) CreateMultipartUpload(c *gin.Context) {
 			ContentType: c.GetHeader("Content-Type"),
 		},
 	}
-	// 提取并设置自定义元数据
-	for h, v := range c.Request.Header {
-		if strings.HasPrefix(strings.ToLower(h), "x-amz-meta-") {
-			if opt.ObjectPutHeaderOptions.XCosMetaXXX == nil {
-				opt.ObjectPutHeaderOptions.XCosMetaXXX = &http.Header{}
-			}
-			cosMetaKey := "x-cos-meta-" + strings.TrimPrefix(strings.ToLower(h), "x-amz-meta-")
-			opt.ObjectPutHeaderOptions.XCosMetaXXX.Set(cosMetaKey, v[0])
-		}
+	// 提取并设置标准元数据头部和自定义元数据
+	setCOSObjectMetadata(opt.ObjectPutHeaderOptions, c.Request.Header)
+	storageClass, err := cosStorageClassFromS3(c.GetHeader("x-amz-storage-class"))
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidStorageClass", err.Error())
+		return
+	}
+	opt.ObjectPutHeaderOptions.XCosStorageClass = storageClass
+	// 分块上传的加密方式在初始化时指定，SSE-C 的密钥还需要在每个 UploadPart 请求中提供
+	encryption, err := s3EncryptionFromHeader(c.Request.Header)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	if !ctrl.checkEncryptionRequired(c, encryption) {
+		return
+	}
+	tagging, err := cosTaggingHeader(c.Request.Header)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidTag", err.Error())
+		return
+	}
+	opt.ObjectPutHeaderOptions.XOptionHeader = tagging
+	encryption.applyToPut(opt.ObjectPutHeaderOptions)
+	if opt.ACLHeaderOptions, err = cosACLHeaderFromS3(c.Request.Header); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	lock, ok := ctrl.objectLockForWrite(c, bucket, key, c.Request.Header)
+	if !ok {
+		return
 	}
 
 	// 调用 COS SDK 初始化分块上传
-	result, resp, err := ctrl.CosClient.Object.InitiateMultipartUpload(c.Request.Context(), key, opt)
+	result, resp, err := ctrl.cosClient(c).Object.InitiateMultipartUpload(c.Request.Context(), key, opt)
 	if err != nil {
 		ctrl.handleCOSError(c, err)
 		return
@@ -507,6 +1270,15 @@ func (ctrl *S3Controller) CreateMultipartUpload(c *gin.Context) {
 			defer resp.Body.Close()
 		}
 		logCOSResponse("InitiateMultipartUpload", resp)
+		writeS3EncryptionHeaders(c, resp.Header)
+	}
+	// 保留设置在合并分片后才应用到对象上，在此之前按 UploadId 暂存
+	if lock != (objectLockState{}) {
+		if err := ctrl.ObjectLocks.putUpload(result.UploadID, lock); err != nil {
+			log.Printf("failed to save object lock settings of upload %s: %v", result.UploadID, err)
+			writeS3Error(c, http.StatusInternalServerError, "InternalError", "The object lock settings could not be saved")
+			return
+		}
 	}
 
 	// 构造成 S3 标准的 XML 响应格式，并确保字段经过 XML 转义
@@ -568,15 +1340,14 @@ func (ctrl *S3Controller) UploadPart(c *gin.Context) {
 	if sha1 := c.GetHeader("x-cos-content-sha1"); sha1 != "" {
 		uploadOpt.XCosContentSHA1 = sha1
 	}
-	if sseAlg := c.GetHeader("x-amz-server-side-encryption-customer-algorithm"); sseAlg != "" {
-		uploadOpt.XCosSSECustomerAglo = sseAlg
-	}
-	if sseKey := c.GetHeader("x-amz-server-side-encryption-customer-key"); sseKey != "" {
-		uploadOpt.XCosSSECustomerKey = sseKey
-	}
-	if sseKeyMD5 := c.GetHeader("x-amz-server-side-encryption-customer-key-MD5"); sseKeyMD5 != "" {
-		uploadOpt.XCosSSECustomerKeyMD5 = sseKeyMD5
+	customerKey, err := s3CustomerKey(c.Request.Header, s3CustomerKeyPrefix)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
 	}
+	uploadOpt.XCosSSECustomerAglo = customerKey.algorithm
+	uploadOpt.XCosSSECustomerKey = customerKey.key
+	uploadOpt.XCosSSECustomerKeyMD5 = customerKey.keyMD5
 	if trafficLimit := c.GetHeader("x-cos-traffic-limit"); trafficLimit != "" {
 		if uploadOpt.XOptionHeader == nil {
 			uploadOpt.XOptionHeader = &http.Header{}
@@ -584,7 +1355,7 @@ func (ctrl *S3Controller) UploadPart(c *gin.Context) {
 		uploadOpt.XOptionHeader.Set("x-cos-traffic-limit", trafficLimit)
 	}
 	// 注意：COS SDK v5 的 UploadPart 方法会自动从 Reader 中计算 ContentLength
-	resp, err := ctrl.CosClient.Object.UploadPart(c.Request.Context(), key, uploadID, partNum, c.Request.Body, uploadOpt)
+	resp, err := ctrl.cosClient(c).Object.UploadPart(c.Request.Context(), key, uploadID, partNum, c.Request.Body, uploadOpt)
 	if err != nil {
 		ctrl.handleCOSError(c, err)
 		return
@@ -593,15 +1364,123 @@ func (ctrl *S3Controller) UploadPart(c *gin.Context) {
 
 	logCOSResponse("UploadPart", resp)
 
+	// 请求体摘要与签名不一致时让该分片上传失败，客户端重传同一分片号会覆盖它
+	if err := verifyRequestBody(c); err != nil {
+		log.Printf("UploadPart body verification failed for %s part %d: %v", key, partNum, err)
+		ctrl.handleCOSError(c, err)
+		return
+	}
+
 	// 关键：从 COS 的响应中获取该分片的 ETag，并设置到响应头中
 	etag := resp.Header.Get("ETag")
 	if etag != "" {
 		c.Header("ETag", etag)
 	}
+	writeS3EncryptionHeaders(c, resp.Header)
 
 	c.Status(http.StatusOK)
 }
 
+// UploadPartCopy 处理以已有对象（或其字节区间）作为分片内容的请求。
+// PUT /{bucket}/{key}?partNumber=N&uploadId=ID，并携带 x-amz-copy-source
+func (ctrl *S3Controller) UploadPartCopy(c *gin.Context) {
+	_, key := ctrl.extractBucketAndKey(c)
+	partNumber := c.Query("partNumber")
+	uploadID := c.Query("uploadId")
+
+	if key == "" || partNumber == "" || uploadID == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Missing required parameters for UploadPartCopy"})
+		return
+	}
+
+	partNum, err := strconv.Atoi(partNumber)
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid partNumber"})
+		return
+	}
+
+	sourceBucket, sourceKey, sourceVersionID, err := ParseCopySource(c.GetHeader("x-amz-copy-source"))
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// CopyPart 总是在第一个 '?' 处拆分复制源，包含 '?' 的 key 无法被正确复制
+	if strings.Contains(sourceKey, "?") {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", errUnsupportedCopySourceKey.Error())
+		return
+	}
+	sourceClient := ctrl.Buckets.Lookup(sourceBucket)
+	if sourceClient == nil {
+		writeS3Error(c, http.StatusNotFound, "NoSuchBucket", "The specified copy source bucket does not exist")
+		return
+	}
+
+	// CopyPart 会分别对复制源的 key 和查询参数进行编码，这里传入未编码的 key 和版本号
+	sourceURL := sourceClient.BaseURL.BucketURL.Host + "/" + sourceKey
+	if sourceVersionID != "" {
+		sourceURL += "?versionId=" + sourceVersionID
+	}
+
+	opt := &cos.ObjectCopyPartOptions{
+		XCosCopySourceRange:             c.GetHeader("x-amz-copy-source-range"),
+		XCosCopySourceIfMatch:           c.GetHeader("x-amz-copy-source-if-match"),
+		XCosCopySourceIfNoneMatch:       c.GetHeader("x-amz-copy-source-if-none-match"),
+		XCosCopySourceIfModifiedSince:   c.GetHeader("x-amz-copy-source-if-modified-since"),
+		XCosCopySourceIfUnmodifiedSince: c.GetHeader("x-amz-copy-source-if-unmodified-since"),
+	}
+	// SSE-C 分块上传需要提供目标对象的密钥，复制 SSE-C 源对象时还需要提供源对象的密钥
+	customerKey, err := s3CustomerKey(c.Request.Header, s3CustomerKeyPrefix)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	opt.XOptionHeader = customerKey.customerKeyHeader(opt.XOptionHeader)
+	sourceCustomerKey, err := s3CustomerKey(c.Request.Header, s3CopySourceCustomerKeyPrefix)
+	if err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	opt.XCosCopySourceSSECustomerAglo = sourceCustomerKey.algorithm
+	opt.XCosCopySourceSSECustomerKey = sourceCustomerKey.key
+	opt.XCosCopySourceSSECustomerKeyMD5 = sourceCustomerKey.keyMD5
+
+	result, resp, err := ctrl.cosClient(c).Object.CopyPart(c.Request.Context(), key, uploadID, partNum, sourceURL, opt)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	if resp != nil {
+		if resp.Body != nil {
+			defer resp.Body.Close()
+		}
+		logCOSResponse("UploadPartCopy", resp)
+		writeS3EncryptionHeaders(c, resp.Header)
+	}
+	if sourceVersionID != "" {
+		c.Header("x-amz-copy-source-version-id", sourceVersionID)
+	}
+
+	payload := struct {
+		XMLName      xml.Name `xml:"CopyPartResult"`
+		XMLNS        string   `xml:"xmlns,attr"`
+		LastModified string   `xml:"LastModified"`
+		ETag         string   `xml:"ETag"`
+	}{
+		XMLNS:        s3XMLNamespace,
+		LastModified: result.LastModified,
+		ETag:         result.ETag,
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal UploadPartCopy response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// maxCompleteMultipartUploadBodySize 限制合并分片请求体的大小，10000 个分片的列表远小于该值。
+const maxCompleteMultipartUploadBodySize = 2 << 20
+
 // CompleteMultipartUpload 处理完成分片上传的请求。
 // POST /{bucket}/{key}?uploadId=ID
 func (ctrl *S3Controller) CompleteMultipartUpload(c *gin.Context) {
@@ -613,15 +1492,28 @@ func (ctrl *S3Controller) CompleteMultipartUpload(c *gin.Context) {
 		return
 	}
 
-	// S3 规定请求体必须是 XML，Gin 的 ShouldBindXML 可以直接解析
+	// 完整读取请求体后再解析 XML，流式解析在根元素结束后就会停止读取，签名中的 x-amz-content-sha256 无法得到校验
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxCompleteMultipartUploadBodySize+1))
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	if len(body) > maxCompleteMultipartUploadBodySize {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+	if err := verifyRequestBody(c); err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
 	var completeUploadData struct {
 		Parts []struct {
 			PartNumber int    `xml:"PartNumber"`
 			ETag       string `xml:"ETag"`
 		} `xml:"Part"`
 	}
-	if err := c.ShouldBindXML(&completeUploadData); err != nil {
-		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid XML body"})
+	if err := xml.Unmarshal(body, &completeUploadData); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
 		return
 	}
 
@@ -635,19 +1527,38 @@ func (ctrl *S3Controller) CompleteMultipartUpload(c *gin.Context) {
 		}
 	}
 
+	// 条件写入在合并分片时校验，与 PutObject 的语义一致
+	if !ctrl.checkObjectLock(c, bucket, key, "") || !ctrl.checkWritePreconditions(c, key) {
+		return
+	}
+
 	// 调用 COS SDK 完成分块上传
 	compOpt := &cos.CompleteMultipartUploadOptions{Parts: cosParts}
-	result, resp, err := ctrl.CosClient.Object.CompleteMultipartUpload(c.Request.Context(), key, uploadID, compOpt)
+	compOpt.XOptionHeader = withForbidOverwrite(c, compOpt.XOptionHeader)
+	result, resp, err := ctrl.cosClient(c).Object.CompleteMultipartUpload(c.Request.Context(), key, uploadID, compOpt)
 	if err != nil {
-		ctrl.handleCOSError(c, err)
+		ctrl.handleWriteError(c, err)
 		return
 	}
 
+	var versionID string
 	if resp != nil {
 		if resp.Body != nil {
 			defer resp.Body.Close()
 		}
 		logCOSResponse("CompleteMultipartUpload", resp)
+		writeS3EncryptionHeaders(c, resp.Header)
+		versionID = resp.Header.Get("x-cos-version-id")
+	}
+	// 取不到初始化时指定的保留设置时不能退回默认保留期限，返回错误让客户端重试，而不是误以为对象已按要求锁定
+	lock, err := ctrl.ObjectLocks.takeUpload(uploadID)
+	if err != nil {
+		log.Printf("failed to load object lock settings of upload %s: %v", uploadID, err)
+		writeS3Error(c, http.StatusInternalServerError, "InternalError", "The object was stored but its object lock settings could not be saved")
+		return
+	}
+	if !ctrl.saveObjectLock(c, bucket, key, versionID, lock) {
+		return
 	}
 
 	// 成功后，返回 S3 标准的成功 XML 响应，并确保字段经过 XML 转义
@@ -686,7 +1597,7 @@ func (ctrl *S3Controller) AbortMultipartUpload(c *gin.Context) {
 	}
 
 	// 调用 COS SDK 中止分块上传
-	resp, err := ctrl.CosClient.Object.AbortMultipartUpload(c.Request.Context(), key, uploadID)
+	resp, err := ctrl.cosClient(c).Object.AbortMultipartUpload(c.Request.Context(), key, uploadID)
 	if err != nil {
 		ctrl.handleCOSError(c, err)
 		return
@@ -697,11 +1608,226 @@ func (ctrl *S3Controller) AbortMultipartUpload(c *gin.Context) {
 		}
 		logCOSResponse("AbortMultipartUpload", resp)
 	}
+	if _, err := ctrl.ObjectLocks.takeUpload(uploadID); err != nil {
+		log.Printf("failed to discard object lock settings of upload %s: %v", uploadID, err)
+	}
 
 	// 根据 S3 规范，成功中止后应返回 204 No Content
 	c.Status(http.StatusNoContent)
 }
 
+// ListMultipartUploads 处理列出进行中的分片上传的请求。
+// GET /{bucket}?uploads&prefix=...&key-marker=...&upload-id-marker=...
+func (ctrl *S3Controller) ListMultipartUploads(c *gin.Context) {
+	bucket, key := ctrl.extractBucketAndKey(c)
+	if bucket == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid bucket"})
+		return
+	}
+	if key != "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "ListMultipartUploads is only supported at the bucket level"})
+		return
+	}
+
+	opt := &cos.ListMultipartUploadsOptions{
+		Prefix:         c.Query("prefix"),
+		Delimiter:      c.Query("delimiter"),
+		EncodingType:   c.Query("encoding-type"),
+		KeyMarker:      c.Query("key-marker"),
+		UploadIDMarker: c.Query("upload-id-marker"),
+	}
+	maxUploadsForResponse := 1000
+	if maxUploadsParam := c.Query("max-uploads"); maxUploadsParam != "" {
+		maxUploads, err := strconv.Atoi(maxUploadsParam)
+		if err != nil || maxUploads < 0 {
+			c.XML(http.StatusBadRequest, gin.H{"error": "Invalid max-uploads"})
+			return
+		}
+		opt.MaxUploads = maxUploads
+		maxUploadsForResponse = maxUploads
+	}
+
+	// 调用 COS SDK 列出分块上传
+	result, resp, err := ctrl.cosClient(c).Bucket.ListMultipartUploads(c.Request.Context(), opt)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	if resp != nil {
+		if resp.Body != nil {
+			defer resp.Body.Close()
+		}
+		logCOSResponse("ListMultipartUploads", resp)
+	}
+	if result.MaxUploads != 0 {
+		maxUploadsForResponse = result.MaxUploads
+	}
+
+	payload := listMultipartUploadsResult{
+		XMLNS:              s3XMLNamespace,
+		Bucket:             bucket,
+		KeyMarker:          opt.KeyMarker,
+		UploadIDMarker:     opt.UploadIDMarker,
+		NextKeyMarker:      result.NextKeyMarker,
+		NextUploadIDMarker: result.NextUploadIDMarker,
+		Prefix:             opt.Prefix,
+		Delimiter:          opt.Delimiter,
+		MaxUploads:         maxUploadsForResponse,
+		IsTruncated:        result.IsTruncated,
+		CommonPrefixes:     toListCommonPrefixes(result.CommonPrefixes),
+		EncodingType:       opt.EncodingType,
+	}
+	for _, upload := range result.Uploads {
+		payload.Uploads = append(payload.Uploads, multipartUpload{
+			Key:          upload.Key,
+			UploadID:     upload.UploadID,
+			Initiator:    toS3Owner((*cos.Owner)(upload.Initiator)),
+			Owner:        toS3Owner(upload.Owner),
+			StorageClass: s3StorageClassFromCOS(upload.StorageClass),
+			Initiated:    upload.Initiated,
+		})
+	}
+
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal ListMultipartUploads response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// ListParts 处理列出某次分片上传中已上传分片的请求。
+// GET /{bucket}/{key}?uploadId=ID&part-number-marker=...&max-parts=...
+func (ctrl *S3Controller) ListParts(c *gin.Context) {
+	bucket, key := ctrl.extractBucketAndKey(c)
+	uploadID := c.Query("uploadId")
+
+	if key == "" || uploadID == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Missing required parameters for ListParts"})
+		return
+	}
+
+	opt := &cos.ObjectListPartsOptions{
+		EncodingType:     c.Query("encoding-type"),
+		PartNumberMarker: c.Query("part-number-marker"),
+	}
+	maxPartsForResponse := 1000
+	if maxPartsParam := c.Query("max-parts"); maxPartsParam != "" {
+		maxParts, err := strconv.Atoi(maxPartsParam)
+		if err != nil || maxParts < 0 {
+			c.XML(http.StatusBadRequest, gin.H{"error": "Invalid max-parts"})
+			return
+		}
+		opt.MaxParts = maxPartsParam
+		maxPartsForResponse = maxParts
+	}
+	if opt.PartNumberMarker != "" {
+		if _, err := strconv.Atoi(opt.PartNumberMarker); err != nil {
+			c.XML(http.StatusBadRequest, gin.H{"error": "Invalid part-number-marker"})
+			return
+		}
+	}
+
+	// 调用 COS SDK 列出已上传的分片
+	result, resp, err := ctrl.cosClient(c).Object.ListParts(c.Request.Context(), key, uploadID, opt)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	if resp != nil {
+		if resp.Body != nil {
+			defer resp.Body.Close()
+		}
+		logCOSResponse("ListParts", resp)
+	}
+	if maxParts, err := strconv.Atoi(result.MaxParts); err == nil && maxParts != 0 {
+		maxPartsForResponse = maxParts
+	}
+
+	payload := listPartsResult{
+		XMLNS:                s3XMLNamespace,
+		Bucket:               bucket,
+		Key:                  key,
+		UploadID:             uploadID,
+		Initiator:            toS3Owner((*cos.Owner)(result.Initiator)),
+		Owner:                toS3Owner(result.Owner),
+		StorageClass:         s3StorageClassFromCOS(result.StorageClass),
+		PartNumberMarker:     atoiOrZero(opt.PartNumberMarker),
+		NextPartNumberMarker: atoiOrZero(result.NextPartNumberMarker),
+		MaxParts:             maxPartsForResponse,
+		IsTruncated:          result.IsTruncated,
+	}
+	for _, part := range result.Parts {
+		payload.Parts = append(payload.Parts, uploadedPart{
+			PartNumber:   part.PartNumber,
+			LastModified: part.LastModified,
+			ETag:         part.ETag,
+			Size:         part.Size,
+		})
+	}
+
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal ListParts response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+type s3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName,omitempty"`
+}
+
+type multipartUpload struct {
+	Key          string   `xml:"Key"`
+	UploadID     string   `xml:"UploadId"`
+	Initiator    *s3Owner `xml:"Initiator,omitempty"`
+	Owner        *s3Owner `xml:"Owner,omitempty"`
+	StorageClass string   `xml:"StorageClass,omitempty"`
+	Initiated    string   `xml:"Initiated"`
+}
+
+type listMultipartUploadsResult struct {
+	XMLName            xml.Name           `xml:"ListMultipartUploadsResult"`
+	XMLNS              string             `xml:"xmlns,attr"`
+	Bucket             string             `xml:"Bucket"`
+	KeyMarker          string             `xml:"KeyMarker"`
+	UploadIDMarker     string             `xml:"UploadIdMarker"`
+	NextKeyMarker      string             `xml:"NextKeyMarker,omitempty"`
+	NextUploadIDMarker string             `xml:"NextUploadIdMarker,omitempty"`
+	Prefix             string             `xml:"Prefix,omitempty"`
+	Delimiter          string             `xml:"Delimiter,omitempty"`
+	MaxUploads         int                `xml:"MaxUploads"`
+	IsTruncated        bool               `xml:"IsTruncated"`
+	Uploads            []multipartUpload  `xml:"Upload,omitempty"`
+	CommonPrefixes     []listCommonPrefix `xml:"CommonPrefixes,omitempty"`
+	EncodingType       string             `xml:"EncodingType,omitempty"`
+}
+
+type uploadedPart struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+type listPartsResult struct {
+	XMLName              xml.Name       `xml:"ListPartsResult"`
+	XMLNS                string         `xml:"xmlns,attr"`
+	Bucket               string         `xml:"Bucket"`
+	Key                  string         `xml:"Key"`
+	UploadID             string         `xml:"UploadId"`
+	Initiator            *s3Owner       `xml:"Initiator,omitempty"`
+	Owner                *s3Owner       `xml:"Owner,omitempty"`
+	StorageClass         string         `xml:"StorageClass,omitempty"`
+	PartNumberMarker     int            `xml:"PartNumberMarker"`
+	NextPartNumberMarker int            `xml:"NextPartNumberMarker,omitempty"`
+	MaxParts             int            `xml:"MaxParts"`
+	IsTruncated          bool           `xml:"IsTruncated"`
+	Parts                []uploadedPart `xml:"Part,omitempty"`
+}
+
 // ===================================================================
 // ====================== 辅助函数 (Helpers) =======================
 // ===================================================================
@@ -709,13 +1835,16 @@ func (ctrl *S3Controller) AbortMultipartUpload(c *gin.Context) {
 // extractBucketAndKey 从请求中解析出 bucket 和 key。
 // 它实现了对虚拟托管类型 (bucket.domain.com) 和路径类型 (/bucket/key) 请求的兼容。
 func (ctrl *S3Controller) extractBucketAndKey(c *gin.Context) (bucket, key string) {
-	host := c.Request.Host
-	path := c.Param("path") // 从 "/*path" 路由中获取
+	return ParseBucketAndKey(c.Request.Host, c.Param("path"), ctrl.BaseDomain) // path 从 "/*path" 路由中获取
+}
 
+// ParseBucketAndKey 根据请求的 Host 和路径解析出 bucket 和 key，
+// 供控制器和需要在分发前识别目标对象的中间件共用。
+func ParseBucketAndKey(host, path, baseDomain string) (bucket, key string) {
 	// 1. 优先尝试虚拟托管类型 (Virtual-Hosted Style)
 	// 例如: my-bucket.proxy.example.com
-	if ctrl.BaseDomain != "" && strings.HasSuffix(host, ctrl.BaseDomain) {
-		potentialBucket := strings.TrimSuffix(host, "."+ctrl.BaseDomain)
+	if baseDomain != "" && strings.HasSuffix(host, baseDomain) {
+		potentialBucket := strings.TrimSuffix(host, "."+baseDomain)
 		if potentialBucket != "" && potentialBucket != host {
 			bucket = potentialBucket
 			key = strings.TrimPrefix(path, "/")
@@ -736,6 +1865,166 @@ func (ctrl *S3Controller) extractBucketAndKey(c *gin.Context) (bucket, key strin
 	return
 }
 
+// cosMetaHeaderFromS3 提取请求中的 x-amz-meta-* 头部并转换为 COS 的 x-cos-meta-* 头部。
+// 没有自定义元数据时返回 nil。
+func cosMetaHeaderFromS3(header http.Header) *http.Header {
+	var meta *http.Header
+	for h, v := range header {
+		if strings.HasPrefix(strings.ToLower(h), "x-amz-meta-") {
+			if meta == nil {
+				meta = &http.Header{}
+			}
+			// 将 x-amz-meta- 转换为 x-cos-meta-
+			cosMetaKey := "x-cos-meta-" + strings.TrimPrefix(strings.ToLower(h), "x-amz-meta-")
+			meta.Set(cosMetaKey, v[0])
+		}
+	}
+	return meta
+}
+
+var errInvalidCopySource = errors.New("invalid x-amz-copy-source")
+
+var errUnsupportedCopySourceKey = errors.New("copy source keys containing '?' are not supported by the COS SDK")
+
+// ParseCopySource 解析 x-amz-copy-source 头部，格式为 [/]{bucket}/{key}[?versionId=ID]，
+// 其中 key 部分是 URL 编码的。
+func ParseCopySource(value string) (bucket, key, versionID string, err error) {
+	if value == "" {
+		return "", "", "", errors.New("missing x-amz-copy-source")
+	}
+
+	path, query, _ := strings.Cut(value, "?")
+	if query != "" {
+		values, parseErr := url.ParseQuery(query)
+		if parseErr != nil {
+			return "", "", "", errInvalidCopySource
+		}
+		versionID = values.Get("versionId")
+	}
+
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return "", "", "", errInvalidCopySource
+	}
+	parts := strings.SplitN(strings.TrimPrefix(unescaped, "/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", errInvalidCopySource
+	}
+	return parts[0], parts[1], versionID, nil
+}
+
+// s3SubResources 是 S3 通过查询参数区分的子资源，值为 true 表示代理已经实现。
+// 未实现的子资源必须显式拒绝，不能按照普通的对象或存储桶操作处理。
+var s3SubResources = map[string]bool{
+	"accelerate":          false,
+	"acl":                 true,
+	"analytics":           false,
+	"attributes":          false,
+	"cors":                true,
+	"delete":              true,
+	"encryption":          false,
+	"intelligent-tiering": false,
+	"inventory":           false,
+	"legal-hold":          true,
+	"lifecycle":           true,
+	"location":            true,
+	"logging":             false,
+	"metrics":             false,
+	"notification":        false,
+	"object-lock":         true,
+	"ownershipControls":   false,
+	"partNumber":          false,
+	"policy":              true,
+	"policyStatus":        false,
+	"publicAccessBlock":   false,
+	"replication":         false,
+	"requestPayment":      false,
+	"restore":             true,
+	"retention":           true,
+	"select":              false,
+	"tagging":             true,
+	"torrent":             false,
+	"uploadId":            true,
+	"uploads":             true,
+	"versioning":          true,
+	"versions":            true,
+	"website":             true,
+}
+
+// unsupportedSubResource 返回请求中第一个未实现的 S3 子资源，全部已实现时返回空字符串。
+// 普通查询参数 (prefix、max-keys 等) 不属于子资源，不受影响。
+func unsupportedSubResource(query url.Values) string {
+	for name := range query {
+		// partNumber 只在 UploadPart/UploadPartCopy 中与 uploadId 一起使用，GetObject/HeadObject 按分块读取尚未实现
+		if name == "partNumber" && query.Has("uploadId") {
+			continue
+		}
+		if supported, ok := s3SubResources[name]; ok && !supported {
+			return name
+		}
+	}
+	return ""
+}
+
+// escapeObjectKey 按路径段对对象 key 进行 URL 编码，保留其中的 "/"。
+func escapeObjectKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3PassthroughObjectHeaders 是 COS 与 S3 语义一致、可以直接透传的对象头部。
+var s3PassthroughObjectHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"ETag",
+	"Last-Modified",
+	"Accept-Ranges",
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Expires",
+}
+
+// writeS3ObjectHeaders 将 COS 返回的对象元数据头部转换为 S3 兼容的头部写入响应。
+func writeS3ObjectHeaders(c *gin.Context, header http.Header) {
+	for _, name := range s3PassthroughObjectHeaders {
+		if value := header.Get(name); value != "" {
+			c.Header(name, value)
+		}
+	}
+
+	for h, values := range header {
+		lower := strings.ToLower(h)
+		if strings.HasPrefix(lower, "x-cos-meta-") && len(values) > 0 {
+			// 将 x-cos-meta- 转换为 x-amz-meta-
+			c.Header("x-amz-meta-"+strings.TrimPrefix(lower, "x-cos-meta-"), values[0])
+		}
+	}
+
+	writeS3StorageHeaders(c, header)
+	writeS3EncryptionHeaders(c, header)
+	writeS3VersionID(c, header)
+}
+
+func toS3Owner(owner *cos.Owner) *s3Owner {
+	if owner == nil {
+		return nil
+	}
+	return &s3Owner{ID: owner.ID, DisplayName: owner.DisplayName}
+}
+
+func atoiOrZero(value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
 func toListCommonPrefixes(prefixes []string) []listCommonPrefix {
 	if len(prefixes) == 0 {
 		return nil
@@ -761,12 +2050,116 @@ func logCOSResponse(operation string, resp *cos.Response) {
 	log.Printf("COS %s response:\n%s", operation, string(dump))
 }
 
+// requestBodyChecksums 列出了 S3 客户端可用于校验请求体的 x-amz-checksum-* 头部及其算法。
+var requestBodyChecksums = []struct {
+	header string
+	hash   func() hash.Hash
+}{
+	{header: "x-amz-checksum-crc32", hash: func() hash.Hash { return crc32.NewIEEE() }},
+	{header: "x-amz-checksum-crc32c", hash: func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }},
+	{header: "x-amz-checksum-sha1", hash: sha1.New},
+	{header: "x-amz-checksum-sha256", hash: sha256.New},
+}
+
+// verifyRequestBodyChecksum 校验请求体与 Content-MD5 或 x-amz-checksum-* 头部是否一致。
+// 校验通过时返回空的错误码，否则返回 S3 错误码和错误信息。
+func verifyRequestBodyChecksum(header http.Header, body []byte) (code, message string) {
+	if contentMD5 := header.Get("Content-MD5"); contentMD5 != "" {
+		sum := md5.Sum(body)
+		if contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			return "BadDigest", "The Content-MD5 you specified did not match what we received."
+		}
+		return "", ""
+	}
+
+	for _, checksum := range requestBodyChecksums {
+		expected := header.Get(checksum.header)
+		if expected == "" {
+			continue
+		}
+		h := checksum.hash()
+		h.Write(body)
+		if expected != base64.StdEncoding.EncodeToString(h.Sum(nil)) {
+			return "BadDigest", fmt.Sprintf("The %s you specified did not match the calculated checksum.", checksum.header)
+		}
+		return "", ""
+	}
+
+	return "InvalidRequest", "Missing required header for this request: Content-MD5"
+}
+
+// s3RequestError 由可以直接映射为 S3 错误响应的请求错误实现，
+// 例如 main 包中在读取请求体时发现的签名或校验和错误。
+type s3RequestError interface {
+	error
+	S3Error() (status int, code string)
+}
+
+// verifiedBody 由在读取结束后校验请求体完整性的 Body 包装实现，例如 x-amz-content-sha256 摘要校验。
+type verifiedBody interface {
+	VerifyBody() error
+}
+
+// verifyRequestBody 在请求体被完整读取后确认其完整性校验已经通过。
+func verifyRequestBody(c *gin.Context) error {
+	if body, ok := c.Request.Body.(verifiedBody); ok {
+		return body.VerifyBody()
+	}
+	return nil
+}
+
+// writeS3Error 返回 S3 风格的 XML 错误响应，HEAD 请求只返回状态码。
+func writeS3Error(c *gin.Context, status int, code, message string) {
+	if c.Request.Method == http.MethodHead {
+		c.Status(status)
+		return
+	}
+
+	payload := struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{
+		Code:    code,
+		Message: message,
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.Status(status)
+		return
+	}
+	c.Data(status, "application/xml; charset=utf-8", []byte(xml.Header+string(encoded)))
+}
+
 // handleCOSError 是一个辅助函数，用于处理来自 COS SDK 的错误并返回 S3 兼容的 XML 响应。
 func (ctrl *S3Controller) handleCOSError(c *gin.Context, err error) {
 	if cosErr, ok := err.(*cos.ErrorResponse); ok {
 		log.Printf("COS Error: Code=%s, Message=%s, RequestID=%s, StatusCode=%d", cosErr.Code, cosErr.Message, cosErr.RequestID, cosErr.Response.StatusCode)
 		// 确保在函数结束时关闭原始响应体
 		defer cosErr.Response.Body.Close()
+		// 读取最新版本为删除标记的对象时，S3 客户端依赖 x-amz-delete-marker 区分对象被删除和不存在
+		writeS3VersionID(c, cosErr.Response.Header)
+
+		// 条件请求未满足：304 响应不能携带响应体，只返回缓存校验需要的头部
+		if cosErr.Response.StatusCode == http.StatusNotModified {
+			for _, name := range []string{"ETag", "Last-Modified", "Cache-Control", "Expires"} {
+				if value := cosErr.Response.Header.Get(name); value != "" {
+					c.Header(name, value)
+				}
+			}
+			c.Status(http.StatusNotModified)
+			return
+		}
+		if cosErr.Response.StatusCode == http.StatusPreconditionFailed && cosErr.Code == "" {
+			cosErr.Code = "PreconditionFailed"
+			cosErr.Message = "At least one of the pre-conditions you specified did not hold"
+		}
+
+		// 根据 S3 规范，HEAD 请求的错误响应只返回状态码，不携带响应体
+		if c.Request.Method == http.MethodHead {
+			c.Status(cosErr.Response.StatusCode)
+			return
+		}
 
 		// 构建标准的 S3 XML 错误响应
 		s3ErrorXML := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
@@ -781,8 +2174,21 @@ func (ctrl *S3Controller) handleCOSError(c *gin.Context, err error) {
 		return
 	}
 
+	// 请求体校验失败（例如 aws-chunked 分块签名不匹配）等错误携带了对应的 S3 错误码
+	var requestErr s3RequestError
+	if errors.As(err, &requestErr) {
+		status, code := requestErr.S3Error()
+		log.Printf("Request Error: Code=%s, Message=%v", code, requestErr)
+		writeS3Error(c, status, code, requestErr.Error())
+		return
+	}
+
 	// 对于非 COS SDK 的其他错误，返回通用的服务器错误
 	log.Printf("Internal Server Error: %v", err)
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
 	// 同样返回 S3 风格的错误 XML
 	s3InternalErrorXML := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <Error>
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// cosStorageClasses 是上传时 S3 存储类型到 COS 存储类型的映射。
+// GLACIER_IR、ONEZONE_IA、REDUCED_REDUNDANCY 等在 COS 中没有语义相同的存储类型，会被拒绝。
+var cosStorageClasses = map[string]string{
+	"STANDARD":            "STANDARD",
+	"STANDARD_IA":         "STANDARD_IA",
+	"GLACIER":             "ARCHIVE",
+	"DEEP_ARCHIVE":        "DEEP_ARCHIVE",
+	"INTELLIGENT_TIERING": "INTELLIGENT_TIERING",
+}
+
+var errInvalidStorageClass = errors.New("the storage class you specified is not valid")
+
+// cosStorageClassFromS3 将 x-amz-storage-class 转换为 COS 的存储类型，未指定时返回空字符串。
+func cosStorageClassFromS3(storageClass string) (string, error) {
+	if storageClass == "" {
+		return "", nil
+	}
+	cosStorageClass, ok := cosStorageClasses[storageClass]
+	if !ok {
+		return "", errInvalidStorageClass
+	}
+	return cosStorageClass, nil
+}
+
+// s3StorageClassFromCOS 将 COS 的存储类型转换为 S3 的存储类型，未返回存储类型的对象为 STANDARD。
+// 多 AZ 存储类型 (MAZ_*) 按对应的单 AZ 存储类型返回。
+func s3StorageClassFromCOS(storageClass string) string {
+	switch strings.TrimPrefix(strings.ToUpper(storageClass), "MAZ_") {
+	case "", "STANDARD":
+		return "STANDARD"
+	case "ARCHIVE":
+		return "GLACIER"
+	default:
+		return strings.TrimPrefix(strings.ToUpper(storageClass), "MAZ_")
+	}
+}
+
+// writeS3StorageHeaders 将 COS 的存储类型和归档对象的恢复状态以 x-amz-storage-class/x-amz-restore 头部返回。
+// S3 对 STANDARD 类型的对象不返回 x-amz-storage-class；x-cos-restore 与 x-amz-restore 的格式相同，可以直接透传。
+func writeS3StorageHeaders(c *gin.Context, header http.Header) {
+	if storageClass := s3StorageClassFromCOS(header.Get("x-cos-storage-class")); storageClass != "STANDARD" {
+		c.Header("x-amz-storage-class", storageClass)
+	}
+	if restore := header.Get("x-cos-restore"); restore != "" {
+		c.Header("x-amz-restore", restore)
+	}
+}
+
+// maxRestoreRequestBodySize 限制 RestoreObject 请求体的大小。
+const maxRestoreRequestBodySize = 64 << 10
+
+// s3RestoreRequest 是 S3 RestoreObject 的请求体，Tier 可以出现在 GlacierJobParameters 中或直接出现在根元素下。
+type s3RestoreRequest struct {
+	XMLName              xml.Name `xml:"RestoreRequest"`
+	Days                 int      `xml:"Days"`
+	Tier                 string   `xml:"Tier"`
+	GlacierJobParameters struct {
+		Tier string `xml:"Tier"`
+	} `xml:"GlacierJobParameters"`
+	Type string `xml:"Type"`
+}
+
+// RestoreObject 处理 S3 的 POST Object restore 请求，为 GLACIER/DEEP_ARCHIVE (COS ARCHIVE/DEEP_ARCHIVE) 对象创建临时副本。
+// COS 与 S3 一样在开始恢复时返回 202，对已恢复的对象更新有效期时返回 200，恢复进行中时返回 409。
+// POST /{bucket}/{key}?restore
+func (ctrl *S3Controller) RestoreObject(c *gin.Context) {
+	_, key := ctrl.extractBucketAndKey(c)
+	if key == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRestoreRequestBodySize+1))
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	if len(body) > maxRestoreRequestBodySize {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+	if err := verifyRequestBody(c); err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	var request s3RestoreRequest
+	if err := xml.Unmarshal(body, &request); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+	// COS 不支持 S3 Select 类型的恢复请求
+	if request.Type != "" {
+		writeS3Error(c, http.StatusNotImplemented, "NotImplemented", fmt.Sprintf("Restore request type %s is not implemented", request.Type))
+		return
+	}
+	if request.Days <= 0 {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+
+	tier := request.GlacierJobParameters.Tier
+	if tier == "" {
+		tier = request.Tier
+	}
+	if tier == "" {
+		tier = "Standard"
+	}
+	switch tier {
+	case "Expedited", "Standard", "Bulk":
+	default:
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+
+	opt := &cos.ObjectRestoreOptions{
+		Days: request.Days,
+		Tier: &cos.CASJobParameters{Tier: tier},
+	}
+	var versionIDs []string
+	if versionID := c.Query("versionId"); versionID != "" {
+		versionIDs = append(versionIDs, versionID)
+	}
+	resp, err := ctrl.cosClient(c).Object.PostRestore(c.Request.Context(), key, opt, versionIDs...)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("RestoreObject", resp)
+	writeS3VersionID(c, resp.Header)
+	c.Status(resp.StatusCode)
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// S3 对对象标签的限制：每个对象最多 10 个标签，key 最长 128 个字符，value 最长 256 个字符。
+const (
+	maxObjectTags     = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// maxTaggingRequestBodySize 限制 PutObjectTagging 请求体的大小，10 个最长的标签远小于该值。
+const maxTaggingRequestBodySize = 64 << 10
+
+type s3Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type s3TagSet struct {
+	Tags []s3Tag `xml:"Tag"`
+}
+
+type s3Tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	XMLNS   string   `xml:"xmlns,attr,omitempty"`
+	TagSet  s3TagSet `xml:"TagSet"`
+}
+
+// validateTags 按照 S3 的规则校验标签数量、长度以及 key 是否重复。
+func validateTags(tags []s3Tag) error {
+	if len(tags) > maxObjectTags {
+		return fmt.Errorf("object tags cannot be greater than %d", maxObjectTags)
+	}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag.Key == "" || len([]rune(tag.Key)) > maxTagKeyLength {
+			return errors.New("the TagKey you have provided is invalid")
+		}
+		if len([]rune(tag.Value)) > maxTagValueLength {
+			return errors.New("the TagValue you have provided is invalid")
+		}
+		if seen[tag.Key] {
+			return errors.New("cannot provide multiple tags with the same key")
+		}
+		seen[tag.Key] = true
+	}
+	return nil
+}
+
+// cosTaggingHeader 校验 x-amz-tagging 头部 (URL 查询字符串格式的标签) 并转换为 COS 的 x-cos-tagging 头部，
+// 没有携带标签时返回 nil。
+func cosTaggingHeader(header http.Header) (*http.Header, error) {
+	value := header.Get("x-amz-tagging")
+	if value == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(value)
+	if err != nil {
+		return nil, errors.New("the header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates")
+	}
+	var tags []s3Tag
+	for key, list := range values {
+		if len(list) != 1 {
+			return nil, errors.New("cannot provide multiple tags with the same key")
+		}
+		tags = append(tags, s3Tag{Key: key, Value: list[0]})
+	}
+	if err := validateTags(tags); err != nil {
+		return nil, err
+	}
+	cosHeader := &http.Header{}
+	cosHeader.Set("x-cos-tagging", values.Encode())
+	return cosHeader, nil
+}
+
+// GetObjectTagging 处理 S3 的 GET Object tagging 请求。
+// GET /{bucket}/{key}?tagging
+func (ctrl *S3Controller) GetObjectTagging(c *gin.Context) {
+	_, key := ctrl.extractBucketAndKey(c)
+	if key == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	var opts []interface{}
+	if versionID := c.Query("versionId"); versionID != "" {
+		opts = append(opts, versionID)
+	}
+	result, resp, err := ctrl.cosClient(c).Object.GetTagging(c.Request.Context(), key, opts...)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("GetObjectTagging", resp)
+	writeS3VersionID(c, resp.Header)
+
+	payload := s3Tagging{XMLNS: s3XMLNamespace}
+	for _, tag := range result.TagSet {
+		payload.TagSet.Tags = append(payload.TagSet.Tags, s3Tag{Key: tag.Key, Value: tag.Value})
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal GetObjectTagging response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// PutObjectTagging 处理 S3 的 PUT Object tagging 请求，新的标签集合会整体替换对象原有的标签。
+// PUT /{bucket}/{key}?tagging
+func (ctrl *S3Controller) PutObjectTagging(c *gin.Context) {
+	_, key := ctrl.extractBucketAndKey(c)
+	if key == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxTaggingRequestBodySize+1))
+	if err != nil {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	if len(body) > maxTaggingRequestBodySize {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+	// 请求体已经完整读取，先确认其与签名中的摘要一致
+	if err := verifyRequestBody(c); err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	var tagging s3Tagging
+	if err := xml.Unmarshal(body, &tagging); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+	if err := validateTags(tagging.TagSet.Tags); err != nil {
+		writeS3Error(c, http.StatusBadRequest, "InvalidTag", err.Error())
+		return
+	}
+
+	opt := &cos.ObjectPutTaggingOptions{}
+	for _, tag := range tagging.TagSet.Tags {
+		opt.TagSet = append(opt.TagSet, cos.ObjectTaggingTag{Key: tag.Key, Value: tag.Value})
+	}
+	var versionIDs []string
+	if versionID := c.Query("versionId"); versionID != "" {
+		versionIDs = append(versionIDs, versionID)
+	}
+	resp, err := ctrl.cosClient(c).Object.PutTagging(c.Request.Context(), key, opt, versionIDs...)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("PutObjectTagging", resp)
+	writeS3VersionID(c, resp.Header)
+	c.Status(http.StatusOK)
+}
+
+// DeleteObjectTagging 处理 S3 的 DELETE Object tagging 请求。
+// DELETE /{bucket}/{key}?tagging
+func (ctrl *S3Controller) DeleteObjectTagging(c *gin.Context) {
+	_, key := ctrl.extractBucketAndKey(c)
+	if key == "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	var opts []interface{}
+	if versionID := c.Query("versionId"); versionID != "" {
+		opts = append(opts, versionID)
+	}
+	resp, err := ctrl.cosClient(c).Object.DeleteTagging(c.Request.Context(), key, opts...)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("DeleteObjectTagging", resp)
+	writeS3VersionID(c, resp.Header)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// listVersionEntry 是 ListVersionsResult 中的一项，XMLName 为 Version 或 DeleteMarker。
+type listVersionEntry struct {
+	XMLName      xml.Name
+	Key          string   `xml:"Key"`
+	VersionID    string   `xml:"VersionId"`
+	IsLatest     bool     `xml:"IsLatest"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag,omitempty"`
+	Size         *int64   `xml:"Size,omitempty"`
+	StorageClass string   `xml:"StorageClass,omitempty"`
+	Owner        *s3Owner `xml:"Owner,omitempty"`
+}
+
+type listVersionsResult struct {
+	XMLName             xml.Name `xml:"ListVersionsResult"`
+	XMLNS               string   `xml:"xmlns,attr"`
+	Name                string   `xml:"Name"`
+	Prefix              string   `xml:"Prefix"`
+	KeyMarker           string   `xml:"KeyMarker"`
+	VersionIDMarker     string   `xml:"VersionIdMarker"`
+	NextKeyMarker       string   `xml:"NextKeyMarker,omitempty"`
+	NextVersionIDMarker string   `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int      `xml:"MaxKeys"`
+	Delimiter           string   `xml:"Delimiter,omitempty"`
+	IsTruncated         bool     `xml:"IsTruncated"`
+	Entries             []listVersionEntry
+	CommonPrefixes      []listCommonPrefix `xml:"CommonPrefixes,omitempty"`
+	EncodingType        string             `xml:"EncodingType,omitempty"`
+}
+
+// ListObjectVersions 处理 S3 的 List Object Versions 请求。
+// GET /{bucket}?versions&prefix=...&key-marker=...&version-id-marker=...
+func (ctrl *S3Controller) ListObjectVersions(c *gin.Context) {
+	bucket, key := ctrl.extractBucketAndKey(c)
+	if key != "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Listing is only supported at the bucket level"})
+		return
+	}
+
+	opt := &cos.BucketGetObjectVersionsOptions{
+		Prefix:          c.Query("prefix"),
+		Delimiter:       c.Query("delimiter"),
+		EncodingType:    c.Query("encoding-type"),
+		KeyMarker:       c.Query("key-marker"),
+		VersionIdMarker: c.Query("version-id-marker"),
+	}
+	maxKeys := 1000
+	if maxKeysParam := c.Query("max-keys"); maxKeysParam != "" {
+		var err error
+		maxKeys, err = strconv.Atoi(maxKeysParam)
+		if err != nil || maxKeys < 0 {
+			c.XML(http.StatusBadRequest, gin.H{"error": "Invalid max-keys"})
+			return
+		}
+		opt.MaxKeys = maxKeys
+	}
+	// S3 要求 version-id-marker 必须与 key-marker 一起使用
+	if opt.VersionIdMarker != "" && opt.KeyMarker == "" {
+		writeS3Error(c, http.StatusBadRequest, "InvalidArgument", "A version-id marker cannot be specified without a key marker.")
+		return
+	}
+
+	result, resp, err := ctrl.cosClient(c).Bucket.GetObjectVersions(c.Request.Context(), opt)
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	if resp != nil {
+		if resp.Body != nil {
+			defer resp.Body.Close()
+		}
+		logCOSResponse("ListObjectVersions", resp)
+	}
+
+	payload := listVersionsResult{
+		XMLNS:               s3XMLNamespace,
+		Name:                bucket,
+		Prefix:              opt.Prefix,
+		KeyMarker:           opt.KeyMarker,
+		VersionIDMarker:     opt.VersionIdMarker,
+		NextKeyMarker:       result.NextKeyMarker,
+		NextVersionIDMarker: result.NextVersionIdMarker,
+		MaxKeys:             maxKeys,
+		Delimiter:           result.Delimiter,
+		IsTruncated:         result.IsTruncated,
+		CommonPrefixes:      toListCommonPrefixes(result.CommonPrefixes),
+		EncodingType:        result.EncodingType,
+	}
+	if result.MaxKeys != 0 {
+		payload.MaxKeys = result.MaxKeys
+	}
+	for _, version := range result.Version {
+		size := version.Size
+		payload.Entries = append(payload.Entries, listVersionEntry{
+			XMLName:      xml.Name{Local: "Version"},
+			Key:          version.Key,
+			VersionID:    version.VersionId,
+			IsLatest:     version.IsLatest,
+			LastModified: version.LastModified,
+			ETag:         version.ETag,
+			Size:         &size,
+			StorageClass: s3StorageClassFromCOS(version.StorageClass),
+			Owner:        toS3Owner(version.Owner),
+		})
+	}
+	for _, marker := range result.DeleteMarker {
+		payload.Entries = append(payload.Entries, listVersionEntry{
+			XMLName:      xml.Name{Local: "DeleteMarker"},
+			Key:          marker.Key,
+			VersionID:    marker.VersionId,
+			IsLatest:     marker.IsLatest,
+			LastModified: marker.LastModified,
+			Owner:        toS3Owner(marker.Owner),
+		})
+	}
+	// COS 分别返回版本和删除标记，S3 按 key 排列、同一 key 下从新到旧排列
+	sort.SliceStable(payload.Entries, func(i, j int) bool {
+		if payload.Entries[i].Key != payload.Entries[j].Key {
+			return payload.Entries[i].Key < payload.Entries[j].Key
+		}
+		return payload.Entries[i].LastModified > payload.Entries[j].LastModified
+	})
+
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal ListObjectVersions response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// GetBucketVersioning 处理 S3 的 GET Bucket versioning 请求，从未开启过版本控制的存储桶不返回 Status。
+// GET /{bucket}?versioning
+func (ctrl *S3Controller) GetBucketVersioning(c *gin.Context) {
+	if _, key := ctrl.extractBucketAndKey(c); key != "" {
+		c.XML(http.StatusBadRequest, gin.H{"error": "Versioning is only supported at the bucket level"})
+		return
+	}
+
+	result, resp, err := ctrl.cosClient(c).Bucket.GetVersioning(c.Request.Context())
+	if err != nil {
+		ctrl.handleCOSError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+	logCOSResponse("GetBucketVersioning", resp)
+
+	payload := struct {
+		XMLName xml.Name `xml:"VersioningConfiguration"`
+		XMLNS   string   `xml:"xmlns,attr"`
+		Status  string   `xml:"Status,omitempty"`
+	}{
+		XMLNS:  s3XMLNamespace,
+		Status: result.Status,
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.XML(http.StatusInternalServerError, gin.H{"error": "Failed to marshal GetBucketVersioning response"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+// writeS3VersionID 将 COS 返回的版本 ID 和删除标记以 S3 的 x-amz-version-id/x-amz-delete-marker 头部返回。
+func writeS3VersionID(c *gin.Context, header http.Header) {
+	if versionID := header.Get("x-cos-version-id"); versionID != "" {
+		c.Header("x-amz-version-id", versionID)
+	}
+	if header.Get("x-cos-delete-marker") == "true" {
+		c.Header("x-amz-delete-marker", "true")
+	}
+}
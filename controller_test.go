@@ -0,0 +1,1256 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	controllers "cos-proxy/controller"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+func newTestController(t *testing.T) *gin.Engine {
+	t.Helper()
+	return newTestControllerWithCOS(t, "https://photos-1250000000.cos.ap-guangzhou.myqcloud.com")
+}
+
+// newTestControllerWithCOS 创建把 photos 存储桶指向 cosURL 的控制器，测试中通常是模拟 COS 的 httptest 服务，
+// middleware 在控制器之前执行，用于模拟准入中间件写入的上下文。
+func newTestControllerWithCOS(t *testing.T, cosURL string, middleware ...gin.HandlerFunc) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	registry, err := newBucketRegistry([]*bucketConfig{{Name: "photos", URL: cosURL, Region: "ap-guangzhou"}}, "id", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disableCOSCRC(registry)
+	router := gin.New()
+	router.Use(middleware...)
+	controllers.NewS3Controller("", registry).RegisterRoutes(router)
+	return router
+}
+
+// disableCOSCRC 关闭 SDK 上传后的 CRC64 校验，模拟的 COS 服务不会返回 x-cos-hash-crc64ecma。
+func disableCOSCRC(registry *controllers.BucketRegistry) {
+	for _, name := range registry.Names() {
+		registry.Lookup(name).Conf.EnableCRC = false
+	}
+}
+
+func TestControllerRejectsUnsupportedSubResources(t *testing.T) {
+	router := newTestController(t)
+	for _, target := range []string{
+		"http://s3.example.com/photos/a.txt?torrent",
+		"http://s3.example.com/photos?replication",
+		"http://s3.example.com/photos?tagging",
+		"http://s3.example.com/photos?acl",
+	} {
+		req := httptest.NewRequest(http.MethodPut, target, strings.NewReader("<AccessControlPolicy/>"))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusNotImplemented || !strings.Contains(recorder.Body.String(), "<Code>NotImplemented</Code>") {
+			t.Errorf("%s: expected NotImplemented, got status %d: %s", target, recorder.Code, recorder.Body)
+		}
+	}
+
+	// 按分块读取对象尚未实现，不能返回整个对象
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, "http://s3.example.com/photos/a.txt?partNumber=1", nil))
+		if recorder.Code != http.StatusNotImplemented {
+			t.Errorf("%s ?partNumber: expected NotImplemented, got status %d", method, recorder.Code)
+		}
+	}
+}
+
+func TestControllerValidatesTags(t *testing.T) {
+	router := newTestController(t)
+	duplicated := "<Tagging><TagSet>" + strings.Repeat("<Tag><Key>k</Key><Value>v</Value></Tag>", 2) + "</TagSet></Tagging>"
+	for name, tc := range map[string]struct {
+		header string
+		target string
+		body   string
+		code   string
+	}{
+		"malformed tagging body": {target: "http://s3.example.com/photos/a.txt?tagging", body: "<Tagging><TagSet>", code: "MalformedXML"},
+		"duplicate tag keys":     {target: "http://s3.example.com/photos/a.txt?tagging", body: duplicated, code: "InvalidTag"},
+		"too many header tags":   {target: "http://s3.example.com/photos/a.txt", header: "a=1&b=2&c=3&d=4&e=5&f=6&g=7&h=8&i=9&j=10&k=11", code: "InvalidTag"},
+		"invalid header tags":    {target: "http://s3.example.com/photos/a.txt", header: "a=%zz", code: "InvalidTag"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tc.target, strings.NewReader(tc.body))
+			if tc.header != "" {
+				req.Header.Set("x-amz-tagging", tc.header)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "<Code>"+tc.code+"</Code>") {
+				t.Fatalf("expected %s, got status %d: %s", tc.code, recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestControllerValidatesACLs(t *testing.T) {
+	router := newTestController(t)
+	for name, tc := range map[string]struct {
+		target string
+		header map[string]string
+		body   string
+		code   string
+	}{
+		"unsupported canned ACL": {target: "http://s3.example.com/photos/a.txt", header: map[string]string{"x-amz-acl": "public-read-write"}, code: "InvalidArgument"},
+		"canned ACL and grants":  {target: "http://s3.example.com/photos/a.txt", header: map[string]string{"x-amz-acl": "private", "x-amz-grant-read": `id="100000000001"`}, code: "InvalidArgument"},
+		"email grantee":          {target: "http://s3.example.com/photos/a.txt", header: map[string]string{"x-amz-grant-read": `emailAddress="a@example.com"`}, code: "InvalidArgument"},
+		"headers and body":       {target: "http://s3.example.com/photos/a.txt?acl", header: map[string]string{"x-amz-acl": "private"}, body: "<AccessControlPolicy/>", code: "UnexpectedContent"},
+		"no ACL":                 {target: "http://s3.example.com/photos/a.txt?acl", code: "MissingSecurityHeader"},
+		"unknown group": {target: "http://s3.example.com/photos/a.txt?acl", body: `<AccessControlPolicy><Owner><ID>qcs::cam::uin/100000000001:uin/100000000001</ID></Owner><AccessControlList><Grant>
+			<Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group"><URI>http://acs.amazonaws.com/groups/s3/LogDelivery</URI></Grantee>
+			<Permission>WRITE</Permission></Grant></AccessControlList></AccessControlPolicy>`, code: "MalformedACLError"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tc.target, strings.NewReader(tc.body))
+			for header, value := range tc.header {
+				req.Header.Set(header, value)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "<Code>"+tc.code+"</Code>") {
+				t.Fatalf("expected %s, got status %d: %s", tc.code, recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestControllerTranslatesCOSAccessControlPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/a.txt" || r.URL.RawQuery != "acl" {
+			t.Errorf("unexpected COS request %s %s", r.Method, r.URL)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<AccessControlPolicy>
+	<Owner><ID>qcs::cam::uin/100000000001:uin/100000000001</ID><DisplayName>100000000001</DisplayName></Owner>
+	<AccessControlList>
+		<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>qcs::cam::uin/100000000001:uin/100000000001</ID></Grantee><Permission>FULL_CONTROL</Permission></Grant>
+		<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group"><URI>http://cam.qcloud.com/groups/global/AllUsers</URI></Grantee><Permission>READ</Permission></Grant>
+	</AccessControlList>
+</AccessControlPolicy>`))
+	}))
+	defer server.Close()
+
+	recorder := httptest.NewRecorder()
+	newTestControllerWithCOS(t, server.URL).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos/a.txt?acl", nil))
+
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`<Owner>`,
+		`xsi:type="CanonicalUser"`,
+		`<URI>http://acs.amazonaws.com/groups/global/AllUsers</URI>`,
+		`<Permission>READ</Permission>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected GetObjectAcl response to contain %s, got status %d: %s", want, recorder.Code, body)
+		}
+	}
+}
+
+func TestControllerListsObjectVersions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query(); !got.Has("versions") || got.Get("key-marker") != "a.txt" || got.Get("version-id-marker") != "v0" {
+			t.Errorf("unexpected COS request %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<ListVersionsResult>
+	<Name>photos-1250000000</Name>
+	<IsTruncated>false</IsTruncated>
+	<Version><Key>a.txt</Key><VersionId>v1</VersionId><IsLatest>false</IsLatest><LastModified>2026-05-01T00:00:00.000Z</LastModified><ETag>"e1"</ETag><Size>0</Size><StorageClass>STANDARD</StorageClass></Version>
+	<Version><Key>b.txt</Key><VersionId>v3</VersionId><IsLatest>true</IsLatest><LastModified>2026-05-03T00:00:00.000Z</LastModified><ETag>"e3"</ETag><Size>3</Size><StorageClass>STANDARD</StorageClass></Version>
+	<DeleteMarker><Key>a.txt</Key><VersionId>v2</VersionId><IsLatest>true</IsLatest><LastModified>2026-05-02T00:00:00.000Z</LastModified></DeleteMarker>
+</ListVersionsResult>`))
+	}))
+	defer server.Close()
+
+	recorder := httptest.NewRecorder()
+	newTestControllerWithCOS(t, server.URL).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos?versions&key-marker=a.txt&version-id-marker=v0", nil))
+
+	body := recorder.Body.String()
+	marker, older, other := strings.Index(body, "<VersionId>v2</VersionId>"), strings.Index(body, "<VersionId>v1</VersionId>"), strings.Index(body, "<VersionId>v3</VersionId>")
+	if recorder.Code != http.StatusOK || !strings.Contains(body, "<Name>photos</Name>") || marker < 0 || !(marker < older && older < other) {
+		t.Fatalf("expected versions ordered by key and age, got status %d: %s", recorder.Code, body)
+	}
+	if !strings.Contains(body, "<DeleteMarker>") || !strings.Contains(body, "<Size>0</Size>") {
+		t.Fatalf("expected delete marker and zero-sized version, got %s", body)
+	}
+}
+
+func TestControllerPassesVersionIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			if r.URL.Query().Get("VersionId") != "v1" && r.URL.Query().Get("versionId") != "v1" {
+				t.Errorf("expected versionId to be forwarded, got %s", r.URL)
+			}
+			w.Header().Set("x-cos-version-id", "v1")
+			w.Header().Set("x-cos-delete-marker", "true")
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			// 最新版本是删除标记时 COS 返回 404
+			w.Header().Set("x-cos-delete-marker", "true")
+			w.Header().Set("x-cos-version-id", "v2")
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+		}
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "http://s3.example.com/photos/a.txt?versionId=v1", nil))
+	if recorder.Code != http.StatusNoContent || recorder.Header().Get("x-amz-version-id") != "v1" || recorder.Header().Get("x-amz-delete-marker") != "true" {
+		t.Fatalf("unexpected DeleteObject response %d %v", recorder.Code, recorder.Header())
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos/a.txt", nil))
+	if recorder.Code != http.StatusNotFound || recorder.Header().Get("x-amz-delete-marker") != "true" {
+		t.Fatalf("expected delete marker on GetObject, got %d %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestControllerForwardsReadConditions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// S3 的优先级规则下，If-Match/If-None-Match 存在时对应的日期条件不再转发
+		if r.Header.Get("If-Modified-Since") != "" || r.Header.Get("If-Unmodified-Since") != "" {
+			t.Errorf("expected date conditions to be dropped, got %v", r.Header)
+		}
+		w.Header().Set("ETag", `"e1"`)
+		switch {
+		case r.Header.Get("If-None-Match") == `"e1"`:
+			w.WriteHeader(http.StatusNotModified)
+		case r.Header.Get("If-Match") != "":
+			w.WriteHeader(http.StatusPreconditionFailed)
+		default:
+			w.Write([]byte("hello"))
+		}
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	req := httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos/a.txt", nil)
+	req.Header.Set("If-None-Match", `"e1"`)
+	req.Header.Set("If-Modified-Since", "Sat, 01 Jan 2000 00:00:00 GMT")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 || recorder.Header().Get("ETag") != `"e1"` {
+		t.Fatalf("expected empty 304 with ETag, got %d %v: %s", recorder.Code, recorder.Header(), recorder.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos/a.txt", nil)
+	req.Header.Set("If-Match", `"e0"`)
+	req.Header.Set("If-Unmodified-Since", "Sat, 01 Jan 2000 00:00:00 GMT")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusPreconditionFailed || !strings.Contains(recorder.Body.String(), "<Code>PreconditionFailed</Code>") {
+		t.Fatalf("expected PreconditionFailed, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestControllerEvaluatesWriteConditions(t *testing.T) {
+	var puts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead && r.URL.Path == "/existing.txt":
+			w.Header().Set("ETag", `"e1"`)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			puts++
+			if r.URL.Path == "/race.txt" && r.Header.Get("x-cos-forbid-overwrite") == "true" {
+				// 预检查之后对象被其他客户端创建
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.Header().Set("ETag", `"e2"`)
+		}
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	for _, tc := range []struct {
+		key     string
+		header  string
+		value   string
+		status  int
+		written bool
+	}{
+		{key: "existing.txt", header: "If-None-Match", value: "*", status: http.StatusPreconditionFailed},
+		{key: "new.txt", header: "If-None-Match", value: "*", status: http.StatusOK, written: true},
+		{key: "race.txt", header: "If-None-Match", value: "*", status: http.StatusPreconditionFailed, written: true},
+		{key: "existing.txt", header: "If-Match", value: `"e1"`, status: http.StatusOK, written: true},
+		{key: "existing.txt", header: "If-Match", value: `"e0"`, status: http.StatusPreconditionFailed},
+		{key: "new.txt", header: "If-Match", value: `"e1"`, status: http.StatusNotFound},
+		{key: "existing.txt", header: "If-None-Match", value: `"e1"`, status: http.StatusNotImplemented},
+	} {
+		puts = 0
+		req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos/"+tc.key, strings.NewReader("data"))
+		req.Header.Set(tc.header, tc.value)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != tc.status || (puts > 0) != tc.written {
+			t.Errorf("PUT %s with %s: %s: expected status %d (written=%t), got %d (puts=%d): %s", tc.key, tc.header, tc.value, tc.status, tc.written, recorder.Code, puts, recorder.Body)
+		}
+	}
+}
+
+func TestControllerAppliesResponseOverrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL, func(c *gin.Context) {
+		c.Set(controllers.AuthenticatedContextKey, c.Query("X-Amz-Signature") != "")
+	})
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		req := httptest.NewRequest(method, "http://s3.example.com/photos/a.txt?response-content-type=text%2Fplain&response-content-disposition=attachment%3B%20filename%3D%22b.txt%22&X-Amz-Signature=sig", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		header := recorder.Header()
+		if recorder.Code != http.StatusOK || header.Get("Content-Type") != "text/plain" || header.Get("Content-Disposition") != `attachment; filename="b.txt"` || header.Get("Cache-Control") != "no-cache" {
+			t.Fatalf("%s: expected overridden headers, got %d %v", method, recorder.Code, header)
+		}
+
+		// 匿名请求不能覆盖响应头部，否则公开对象可以被当作 text/html 返回
+		req = httptest.NewRequest(method, "http://s3.example.com/photos/a.txt?response-content-type=text%2Fhtml", nil)
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusBadRequest || recorder.Header().Get("Content-Type") == "text/html" {
+			t.Fatalf("%s: expected anonymous overrides to be rejected, got %d %v", method, recorder.Code, recorder.Header())
+		}
+		if method == http.MethodGet && !strings.Contains(recorder.Body.String(), "<Code>InvalidRequest</Code>") {
+			t.Fatalf("expected InvalidRequest, got %s", recorder.Body)
+		}
+	}
+}
+
+func TestControllerStoresObjectMetadata(t *testing.T) {
+	var stored http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("x-cos-meta-owner", "alice")
+			return
+		}
+		stored = r.Header.Clone()
+		w.Header().Set("ETag", `"e1"`)
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos/a.txt", strings.NewReader("hello"))
+	req.Header.Set("Cache-Control", "max-age=60")
+	req.Header.Set("Content-Disposition", "inline")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Language", "zh-CN")
+	req.Header.Set("Expires", "Sat, 01 Jan 2000 00:00:00 GMT")
+	req.Header.Set("x-amz-meta-owner", "alice")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected PutObject to succeed, got %d: %s", recorder.Code, recorder.Body)
+	}
+	for name, want := range map[string]string{
+		"Cache-Control":       "max-age=60",
+		"Content-Disposition": "inline",
+		"Content-Encoding":    "gzip",
+		"Content-Language":    "zh-CN",
+		"Expires":             "Sat, 01 Jan 2000 00:00:00 GMT",
+		"x-cos-meta-owner":    "alice",
+	} {
+		if got := stored.Get(name); got != want {
+			t.Errorf("expected %s %q to reach COS, got %q", name, want, got)
+		}
+	}
+
+	// 表单上传的元数据字段名不区分大小写
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("key", "b.txt")
+	writer.WriteField("cache-control", "no-store")
+	writer.WriteField("X-Amz-Meta-Owner", "bob")
+	part, _ := writer.CreateFormFile("file", "b.txt")
+	part.Write([]byte("hello"))
+	writer.Close()
+	req = httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected PostObject to succeed, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if stored.Get("Cache-Control") != "no-store" || stored.Get("x-cos-meta-owner") != "bob" {
+		t.Fatalf("expected form metadata to reach COS, got %v", stored)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "http://s3.example.com/photos/a.txt", nil))
+	if recorder.Header().Get("Cache-Control") != "max-age=60" || recorder.Header().Get("x-amz-meta-owner") != "alice" {
+		t.Fatalf("expected stored metadata to be returned, got %v", recorder.Header())
+	}
+}
+
+func TestControllerMapsStorageClasses(t *testing.T) {
+	var stored string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			stored = r.Header.Get("x-cos-storage-class")
+			if r.Header.Get("x-cos-copy-source") != "" {
+				w.Write([]byte(`<CopyObjectResult><ETag>"e1"</ETag><LastModified>2024-01-01T00:00:00.000Z</LastModified></CopyObjectResult>`))
+			}
+		case http.MethodPost:
+			stored = r.Header.Get("x-cos-storage-class")
+			w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>photos</Bucket><Key>a.gz</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+		case http.MethodHead:
+			w.Header().Set("x-cos-storage-class", "ARCHIVE")
+			w.Header().Set("x-cos-restore", `ongoing-request="false", expiry-date="Fri, 19 Jul 2019 00:00:00 GMT"`)
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<ListBucketResult><Name>photos</Name><Contents><Key>a.gz</Key><StorageClass>DEEP_ARCHIVE</StorageClass></Contents><Contents><Key>b.gz</Key><StorageClass>MAZ_STANDARD</StorageClass></Contents></ListBucketResult>`))
+		}
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos/a.gz", strings.NewReader("hello"))
+	req.Header.Set("x-amz-storage-class", "GLACIER")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || stored != "ARCHIVE" {
+		t.Fatalf("expected GLACIER to be stored as ARCHIVE, got %d %q", recorder.Code, stored)
+	}
+
+	stored = ""
+	req = httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos/b.gz", nil)
+	req.Header.Set("x-amz-copy-source", "photos/a.gz")
+	req.Header.Set("x-amz-storage-class", "GLACIER")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || stored != "ARCHIVE" {
+		t.Fatalf("expected copy to store GLACIER as ARCHIVE, got %d %q: %s", recorder.Code, stored, recorder.Body)
+	}
+
+	stored = ""
+	req = httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos/c.gz?uploads", nil)
+	req.Header.Set("x-amz-storage-class", "STANDARD_IA")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || stored != "STANDARD_IA" {
+		t.Fatalf("expected multipart upload to store STANDARD_IA, got %d %q: %s", recorder.Code, stored, recorder.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos/a.gz", strings.NewReader("hello"))
+	req.Header.Set("x-amz-storage-class", "REDUCED_REDUNDANCY")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "<Code>InvalidStorageClass</Code>") {
+		t.Fatalf("expected InvalidStorageClass, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "http://s3.example.com/photos/a.gz", nil))
+	if recorder.Header().Get("x-amz-storage-class") != "GLACIER" || !strings.Contains(recorder.Header().Get("x-amz-restore"), `ongoing-request="false"`) {
+		t.Fatalf("expected GLACIER with restore status, got %v", recorder.Header())
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos?list-type=2", nil))
+	body := recorder.Body.String()
+	if !strings.Contains(body, "<StorageClass>DEEP_ARCHIVE</StorageClass>") || !strings.Contains(body, "<StorageClass>STANDARD</StorageClass>") {
+		t.Fatalf("expected S3 storage classes in listing, got %s", body)
+	}
+}
+
+func TestControllerRestoresObjects(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !r.URL.Query().Has("restore") {
+			t.Errorf("unexpected COS request %s %s", r.Method, r.URL)
+		}
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos/a.gz?restore", strings.NewReader(`<RestoreRequest><Days>3</Days><GlacierJobParameters><Tier>Bulk</Tier></GlacierJobParameters></RestoreRequest>`))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusAccepted || !strings.Contains(received, "<Days>3</Days>") || !strings.Contains(received, "<CASJobParameters><Tier>Bulk</Tier></CASJobParameters>") {
+		t.Fatalf("expected restore to be forwarded, got %d, COS received %s", recorder.Code, received)
+	}
+
+	for _, tc := range []struct {
+		method string
+		body   string
+		status int
+	}{
+		{method: http.MethodPost, body: `<RestoreRequest><Days>3</Days><Type>SELECT</Type></RestoreRequest>`, status: http.StatusNotImplemented},
+		{method: http.MethodPost, body: `<RestoreRequest><Days>3</Days><Tier>Fast</Tier></RestoreRequest>`, status: http.StatusBadRequest},
+		{method: http.MethodPost, body: `<RestoreRequest></RestoreRequest>`, status: http.StatusBadRequest},
+		{method: http.MethodGet, status: http.StatusMethodNotAllowed},
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(tc.method, "http://s3.example.com/photos/a.gz?restore", strings.NewReader(tc.body)))
+		if recorder.Code != tc.status {
+			t.Errorf("%s %s: expected %d, got %d: %s", tc.method, tc.body, tc.status, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestControllerTranslatesServerSideEncryption(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		if r.Header.Get("x-cos-copy-source") != "" {
+			w.Write([]byte(`<CopyPartResult><ETag>"e1"</ETag><LastModified>2024-01-01T00:00:00.000Z</LastModified></CopyPartResult>`))
+		}
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>photos</Bucket><Key>a.txt</Key><UploadId>u1</UploadId></InitiateMultipartUploadResult>`))
+		}
+		if sse := r.Header.Get("x-cos-server-side-encryption"); sse != "" {
+			w.Header().Set("x-cos-server-side-encryption", sse)
+			w.Header().Set("x-cos-server-side-encryption-cos-kms-key-id", r.Header.Get("x-cos-server-side-encryption-cos-kms-key-id"))
+		}
+		if algorithm := r.Header.Get("x-cos-server-side-encryption-customer-algorithm"); algorithm != "" {
+			w.Header().Set("x-cos-server-side-encryption-customer-algorithm", algorithm)
+			w.Header().Set("x-cos-server-side-encryption-customer-key-MD5", r.Header.Get("x-cos-server-side-encryption-customer-key-MD5"))
+		}
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos/a.txt", strings.NewReader("hello"))
+	req.Header.Set("x-amz-server-side-encryption", "aws:kms")
+	req.Header.Set("x-amz-server-side-encryption-aws-kms-key-id", "kms-key")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || received.Get("x-cos-server-side-encryption") != "cos/kms" || received.Get("x-cos-server-side-encryption-cos-kms-key-id") != "kms-key" {
+		t.Fatalf("expected SSE-KMS to be forwarded, got %d, COS received %v", recorder.Code, received)
+	}
+	if recorder.Header().Get("x-amz-server-side-encryption") != "aws:kms" || recorder.Header().Get("x-amz-server-side-encryption-aws-kms-key-id") != "kms-key" {
+		t.Fatalf("expected SSE-KMS response headers, got %v", recorder.Header())
+	}
+
+	// KMS 加密上下文和上传标签都通过自定义头部发送，不能互相覆盖
+	req = httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos/a.txt?uploads", nil)
+	req.Header.Set("x-amz-server-side-encryption", "aws:kms")
+	req.Header.Set("x-amz-server-side-encryption-context", "eyJhIjoiYiJ9")
+	req.Header.Set("x-amz-tagging", "team=a")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || received.Get("x-cos-server-side-encryption-context") != "eyJhIjoiYiJ9" || received.Get("x-cos-tagging") != "team=a" {
+		t.Fatalf("expected KMS context and tagging to be forwarded, got %d, COS received %v", recorder.Code, received)
+	}
+
+	// UploadPartCopy 的目标对象密钥和复制源密钥分别转发
+	req = httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos/b.txt?partNumber=1&uploadId=u1", nil)
+	req.Header.Set("x-amz-copy-source", "photos/a.txt")
+	req.Header.Set("x-amz-server-side-encryption-customer-algorithm", "AES256")
+	req.Header.Set("x-amz-server-side-encryption-customer-key", "a2V5")
+	req.Header.Set("x-amz-server-side-encryption-customer-key-MD5", "bWQ1")
+	req.Header.Set("x-amz-copy-source-server-side-encryption-customer-algorithm", "AES256")
+	req.Header.Set("x-amz-copy-source-server-side-encryption-customer-key", "c3Jj")
+	req.Header.Set("x-amz-copy-source-server-side-encryption-customer-key-MD5", "bWQ2")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || received.Get("x-cos-server-side-encryption-customer-key") != "a2V5" || received.Get("x-cos-copy-source-server-side-encryption-customer-key") != "c3Jj" {
+		t.Fatalf("expected UploadPartCopy SSE-C keys to be forwarded, got %d: %s, COS received %v", recorder.Code, recorder.Body, received)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		req = httptest.NewRequest(method, "http://s3.example.com/photos/a.txt", nil)
+		req.Header.Set("x-amz-server-side-encryption-customer-algorithm", "AES256")
+		req.Header.Set("x-amz-server-side-encryption-customer-key", "a2V5")
+		req.Header.Set("x-amz-server-side-encryption-customer-key-MD5", "bWQ1")
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK || received.Get("x-cos-server-side-encryption-customer-key") != "a2V5" || recorder.Header().Get("x-amz-server-side-encryption-customer-key-MD5") != "bWQ1" {
+			t.Fatalf("%s: expected SSE-C key to be forwarded, got %d %v, COS received %v", method, recorder.Code, recorder.Header(), received)
+		}
+	}
+
+	for name, header := range map[string]map[string]string{
+		"unsupported algorithm": {"x-amz-server-side-encryption": "aws:kms:dsse"},
+		"key id without kms":    {"x-amz-server-side-encryption": "AES256", "x-amz-server-side-encryption-aws-kms-key-id": "kms-key"},
+		"incomplete SSE-C":      {"x-amz-server-side-encryption-customer-algorithm": "AES256"},
+		"SSE-C with SSE-S3": {
+			"x-amz-server-side-encryption":                    "AES256",
+			"x-amz-server-side-encryption-customer-algorithm": "AES256",
+			"x-amz-server-side-encryption-customer-key":       "a2V5",
+			"x-amz-server-side-encryption-customer-key-MD5":   "bWQ1",
+		},
+	} {
+		req = httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos/a.txt", strings.NewReader("hello"))
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "<Code>InvalidArgument</Code>") {
+			t.Errorf("%s: expected InvalidArgument, got %d: %s", name, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestControllerRequiresEncryption(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	gin.SetMode(gin.TestMode)
+	registry, err := newBucketRegistry([]*bucketConfig{{Name: "photos", URL: server.URL, RequireEncryption: true}}, "id", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disableCOSCRC(registry)
+	router := gin.New()
+	controllers.NewS3Controller("", registry).RegisterRoutes(router)
+
+	for _, tc := range []struct {
+		method string
+		target string
+		sse    string
+		status int
+	}{
+		{method: http.MethodPut, target: "http://s3.example.com/photos/a.txt", status: http.StatusForbidden},
+		{method: http.MethodPost, target: "http://s3.example.com/photos/a.txt?uploads", status: http.StatusForbidden},
+		{method: http.MethodPut, target: "http://s3.example.com/photos/a.txt", sse: "AES256", status: http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, strings.NewReader("hello"))
+		if tc.sse != "" {
+			req.Header.Set("x-amz-server-side-encryption", tc.sse)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != tc.status {
+			t.Errorf("%s %s (sse %q): expected %d, got %d: %s", tc.method, tc.target, tc.sse, tc.status, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestControllerEnforcesObjectLock(t *testing.T) {
+	var deletes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodDelete:
+			deletes++
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>photos</Bucket><Key>records/d.txt</Key><UploadId>u1</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploadId"):
+			w.Write([]byte(`<CompleteMultipartUploadResult><Bucket>photos</Bucket><Key>records/d.txt</Key><ETag>"e1"</ETag></CompleteMultipartUploadResult>`))
+		case r.Method == http.MethodPost:
+			deletes++
+			w.Write([]byte(`<DeleteResult><Deleted><Key>records/c.txt</Key></Deleted></DeleteResult>`))
+		}
+	}))
+	defer server.Close()
+	gin.SetMode(gin.TestMode)
+	lock := &objectLockConfig{Prefixes: []string{"records/"}}
+	lock.DefaultRetention = &struct {
+		Mode string `json:"mode"`
+		Days int    `json:"days"`
+	}{Mode: "GOVERNANCE", Days: 1}
+	registry, err := newBucketRegistry([]*bucketConfig{{Name: "photos", URL: server.URL, ObjectLock: lock}}, "id", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disableCOSCRC(registry)
+	storePath := filepath.Join(t.TempDir(), "object-lock.json")
+	newRouter := func() *gin.Engine {
+		store, err := controllers.OpenObjectLockStore(storePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctrl := controllers.NewS3Controller("", registry)
+		ctrl.ObjectLocks = store
+		router := gin.New()
+		ctrl.RegisterRoutes(router)
+		return router
+	}
+	router := newRouter()
+	retainUntil := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "lock outside prefixes", method: http.MethodPut, target: "/photos/a.txt", headers: map[string]string{"x-amz-object-lock-mode": "GOVERNANCE", "x-amz-object-lock-retain-until-date": retainUntil}, status: http.StatusBadRequest},
+		{name: "mode without date", method: http.MethodPut, target: "/photos/records/a.txt", headers: map[string]string{"x-amz-object-lock-mode": "GOVERNANCE"}, status: http.StatusBadRequest},
+		{name: "put compliance", method: http.MethodPut, target: "/photos/records/a.txt", body: "hello", headers: map[string]string{"x-amz-object-lock-mode": "COMPLIANCE", "x-amz-object-lock-retain-until-date": retainUntil}, status: http.StatusOK},
+		{name: "overwrite compliance", method: http.MethodPut, target: "/photos/records/a.txt", body: "hello", status: http.StatusForbidden},
+		{name: "delete compliance with bypass", method: http.MethodDelete, target: "/photos/records/a.txt", headers: map[string]string{"x-amz-bypass-governance-retention": "true"}, status: http.StatusForbidden},
+		{name: "shorten compliance", method: http.MethodPut, target: "/photos/records/a.txt?retention", body: `<Retention><Mode>GOVERNANCE</Mode><RetainUntilDate>` + retainUntil + `</RetainUntilDate></Retention>`, status: http.StatusForbidden},
+		{name: "put with default retention", method: http.MethodPut, target: "/photos/records/b.txt", body: "hello", status: http.StatusOK},
+		{name: "delete governance", method: http.MethodDelete, target: "/photos/records/b.txt", status: http.StatusForbidden},
+		{name: "delete governance with bypass", method: http.MethodDelete, target: "/photos/records/b.txt", headers: map[string]string{"x-amz-bypass-governance-retention": "true"}, status: http.StatusNoContent},
+		{name: "put without retention", method: http.MethodPut, target: "/photos/c.txt", body: "hello", status: http.StatusOK},
+		{name: "legal hold outside prefixes", method: http.MethodPut, target: "/photos/c.txt?legal-hold", body: `<LegalHold><Status>ON</Status></LegalHold>`, status: http.StatusBadRequest},
+		{name: "put legal hold", method: http.MethodPut, target: "/photos/records/c.txt?legal-hold", body: `<LegalHold><Status>ON</Status></LegalHold>`, status: http.StatusOK},
+		{name: "delete under legal hold with bypass", method: http.MethodDelete, target: "/photos/records/c.txt", headers: map[string]string{"x-amz-bypass-governance-retention": "true"}, status: http.StatusForbidden},
+		{name: "release legal hold", method: http.MethodPut, target: "/photos/records/c.txt?legal-hold", body: `<LegalHold><Status>OFF</Status></LegalHold>`, status: http.StatusOK},
+		{name: "delete released object", method: http.MethodDelete, target: "/photos/records/c.txt", status: http.StatusNoContent},
+		{name: "create locked multipart upload", method: http.MethodPost, target: "/photos/records/d.txt?uploads", headers: map[string]string{"x-amz-object-lock-mode": "COMPLIANCE", "x-amz-object-lock-retain-until-date": retainUntil}, status: http.StatusOK},
+		{name: "complete locked multipart upload", method: http.MethodPost, target: "/photos/records/d.txt?uploadId=u1", body: `<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>"e1"</ETag></Part></CompleteMultipartUpload>`, status: http.StatusOK},
+		{name: "delete completed multipart upload", method: http.MethodDelete, target: "/photos/records/d.txt", status: http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(tc.method, "http://s3.example.com"+tc.target, strings.NewReader(tc.body))
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.status, recorder.Code, recorder.Body)
+		}
+	}
+	if deletes != 2 {
+		t.Errorf("expected only unprotected objects to be deleted in COS, got %d deletes", deletes)
+	}
+
+	// 保留状态保存在文件中，重启后仍然生效
+	router = newRouter()
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos/records/a.txt?retention", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "<Mode>COMPLIANCE</Mode>") || !strings.Contains(recorder.Body.String(), retainUntil) {
+		t.Errorf("expected COMPLIANCE retention, got %d: %s", recorder.Code, recorder.Body)
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "http://s3.example.com/photos/records/a.txt", nil))
+	if got := recorder.Header().Get("x-amz-object-lock-mode"); got != "COMPLIANCE" {
+		t.Errorf("expected x-amz-object-lock-mode COMPLIANCE, got %q", got)
+	}
+
+	body := `<Delete><Object><Key>records/a.txt</Key></Object><Object><Key>records/c.txt</Key></Object></Delete>`
+	req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos?delete", strings.NewReader(body))
+	sum := md5.Sum([]byte(body))
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "<Code>AccessDenied</Code>") || !strings.Contains(recorder.Body.String(), "<Deleted>") {
+		t.Errorf("expected records/a.txt to be denied in DeleteObjects, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos?object-lock", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "<ObjectLockEnabled>Enabled</ObjectLockEnabled>") || !strings.Contains(recorder.Body.String(), "<Days>1</Days>") {
+		t.Errorf("expected object lock configuration, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	// 保留设置无法从状态文件中取出时，合并分片必须失败，而不是退回默认保留期限
+	req = httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos/records/e.txt?uploads", nil)
+	req.Header.Set("x-amz-object-lock-mode", "COMPLIANCE")
+	req.Header.Set("x-amz-object-lock-retain-until-date", retainUntil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected locked multipart upload to be created, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if err := os.RemoveAll(filepath.Dir(storePath)); err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos/records/e.txt?uploadId=u1", strings.NewReader(`<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>"e1"</ETag></Part></CompleteMultipartUpload>`)))
+	if recorder.Code != http.StatusInternalServerError || !strings.Contains(recorder.Body.String(), "<Code>InternalError</Code>") {
+		t.Errorf("expected InternalError when the upload's retention cannot be loaded, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	// 客户端重试时仍然使用初始化时指定的保留设置
+	if err := os.MkdirAll(filepath.Dir(storePath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos/records/e.txt?uploadId=u1", strings.NewReader(`<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>"e1"</ETag></Part></CompleteMultipartUpload>`)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the retried CompleteMultipartUpload to succeed, got %d: %s", recorder.Code, recorder.Body)
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos/records/e.txt?retention", nil))
+	if !strings.Contains(recorder.Body.String(), "<Mode>COMPLIANCE</Mode>") || !strings.Contains(recorder.Body.String(), retainUntil) {
+		t.Errorf("expected the requested COMPLIANCE retention after the retry, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestControllerTranslatesBucketCORS(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("cors") {
+			t.Errorf("unexpected COS request %s %s", r.Method, r.URL)
+		}
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<CORSConfiguration><CORSRule><AllowedOrigin>https://example.com</AllowedOrigin><AllowedMethod>GET</AllowedMethod><MaxAgeSeconds>300</MaxAgeSeconds></CORSRule></CORSConfiguration>`))
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos?cors", strings.NewReader(`<CORSConfiguration><CORSRule><AllowedOrigin>https://example.com</AllowedOrigin><AllowedMethod>GET</AllowedMethod><AllowedHeader>*</AllowedHeader></CORSRule></CORSConfiguration>`)))
+	if recorder.Code != http.StatusOK || !strings.Contains(received, "<AllowedOrigin>https://example.com</AllowedOrigin>") || !strings.Contains(received, "<AllowedHeader>*</AllowedHeader>") {
+		t.Fatalf("expected CORS rules to be forwarded, got %d: %s, COS received %s", recorder.Code, recorder.Body, received)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos?cors", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "<MaxAgeSeconds>300</MaxAgeSeconds>") {
+		t.Fatalf("expected CORS configuration, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	for _, tc := range []struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{method: http.MethodPut, target: "http://s3.example.com/photos?cors", body: `<CORSConfiguration><CORSRule><AllowedMethod>GET</AllowedMethod></CORSRule></CORSConfiguration>`, status: http.StatusBadRequest},
+		{method: http.MethodDelete, target: "http://s3.example.com/photos?cors", status: http.StatusNoContent},
+		{method: http.MethodGet, target: "http://s3.example.com/photos/a.txt?cors", status: http.StatusMethodNotAllowed},
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+		if recorder.Code != tc.status {
+			t.Errorf("%s %s: expected %d, got %d: %s", tc.method, tc.target, tc.status, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestControllerTranslatesBucketLifecycle(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<LifecycleConfiguration><Rule><ID>logs</ID><Filter><Prefix>logs/</Prefix></Filter><Status>Enabled</Status><Transition><Days>30</Days><StorageClass>STANDARD_IA</StorageClass></Transition><Expiration><Days>365</Days></Expiration></Rule><Rule><ID>large</ID><Filter><And><ObjectSizeGreaterThan>1024</ObjectSizeGreaterThan></And></Filter><Status>Enabled</Status><Expiration><Days>7</Days></Expiration></Rule></LifecycleConfiguration>`))
+		}
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos?lifecycle", strings.NewReader(`<LifecycleConfiguration><Rule><ID>archive</ID><Filter><Prefix>raw/</Prefix></Filter><Status>Enabled</Status><Transition><Days>90</Days><StorageClass>GLACIER</StorageClass></Transition></Rule></LifecycleConfiguration>`)))
+	if recorder.Code != http.StatusOK || !strings.Contains(received, "<StorageClass>ARCHIVE</StorageClass>") || !strings.Contains(received, "<Prefix>raw/</Prefix>") {
+		t.Fatalf("expected GLACIER transition to be stored as ARCHIVE, got %d: %s, COS received %s", recorder.Code, recorder.Body, received)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos?lifecycle", nil))
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusOK || !strings.Contains(body, "<StorageClass>STANDARD_IA</StorageClass>") || !strings.Contains(body, "<Prefix>logs/</Prefix>") {
+		t.Fatalf("expected lifecycle configuration, got %d: %s", recorder.Code, body)
+	}
+	if !strings.Contains(strings.Join(strings.Fields(body), ""), "<Filter><ObjectSizeGreaterThan>1024</ObjectSizeGreaterThan></Filter>") {
+		t.Fatalf("expected COS object size condition to be returned as a plain S3 filter, got %s", body)
+	}
+
+	// COS 的对象大小条件只能写在 And 中
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos?lifecycle", strings.NewReader(`<LifecycleConfiguration><Rule><ID>tagged</ID><Filter><Tag><Key>team</Key><Value>a</Value></Tag></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule><Rule><ID>large</ID><Filter><ObjectSizeGreaterThan>1024</ObjectSizeGreaterThan></Filter><Status>Enabled</Status><Expiration><Days>7</Days></Expiration></Rule></LifecycleConfiguration>`)))
+	if recorder.Code != http.StatusOK || !strings.Contains(received, "<Tag><Key>team</Key><Value>a</Value></Tag>") || !strings.Contains(received, "<And><ObjectSizeGreaterThan>1024</ObjectSizeGreaterThan></And>") {
+		t.Fatalf("expected tag and object size filters to be forwarded, got %d: %s, COS received %s", recorder.Code, recorder.Body, received)
+	}
+
+	for _, tc := range []struct {
+		body   string
+		status int
+	}{
+		{body: `<LifecycleConfiguration><Rule><Filter><Prefix>a/</Prefix></Filter><Status>Enabled</Status><NoncurrentVersionExpiration><NoncurrentDays>1</NoncurrentDays><NewerNoncurrentVersions>3</NewerNoncurrentVersions></NoncurrentVersionExpiration></Rule></LifecycleConfiguration>`, status: http.StatusNotImplemented},
+		{body: `<LifecycleConfiguration><Rule><Filter><Prefix>a/</Prefix><Tag><Key>a</Key><Value>b</Value></Tag></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule></LifecycleConfiguration>`, status: http.StatusBadRequest},
+		{body: `<LifecycleConfiguration><Rule><Filter><Prefix>a/</Prefix></Filter><Status>Paused</Status><Expiration><Days>1</Days></Expiration></Rule></LifecycleConfiguration>`, status: http.StatusBadRequest},
+		{body: `<LifecycleConfiguration></LifecycleConfiguration>`, status: http.StatusBadRequest},
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos?lifecycle", strings.NewReader(tc.body)))
+		if recorder.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.body, tc.status, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestControllerTranslatesBucketPolicy(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(received))
+		}
+	}))
+	defer server.Close()
+
+	// 策略中的资源需要从 COS 默认域名中解析 APPID，请求实际发往模拟 COS 的 httptest 服务
+	bucketURL, _ := url.Parse("https://photos-1250000000.cos.ap-guangzhou.myqcloud.com")
+	target, _ := url.Parse(server.URL)
+	client := cos.NewClient(&cos.BaseURL{BucketURL: bucketURL}, &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})})
+	registry := controllers.NewBucketRegistry()
+	if err := registry.Register("photos", "ap-guangzhou", client); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	controllers.NewS3Controller("", registry).RegisterRoutes(router)
+
+	policy := `{"Version":"2012-10-17","Statement":[{"Sid":"PublicRead","Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::photos/*","Condition":{"IpAddress":{"aws:SourceIp":"198.51.100.0/24"}}}]}`
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos?policy", strings.NewReader(policy)))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected policy to be stored, got %d: %s", recorder.Code, recorder.Body)
+	}
+	for _, want := range []string{"qcs::cos:ap-guangzhou:uid/1250000000:photos-1250000000/*", "name/cos:GetObject", "name/cos:HeadObject", "qcs::cam::anyone:anyone", "ip_equal", "qcs:ip", `"sid":"PublicRead"`} {
+		if !strings.Contains(received, want) {
+			t.Errorf("expected COS policy to contain %q, got %s", want, received)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos?policy", nil))
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusOK || !strings.Contains(body, `"arn:aws:s3:::photos/*"`) || !strings.Contains(body, `"s3:GetObject"`) || !strings.Contains(body, "aws:SourceIp") || !strings.Contains(body, `"Sid":"PublicRead"`) {
+		t.Fatalf("expected policy to be translated back to S3, got %d: %s", recorder.Code, body)
+	}
+
+	for _, policy := range []string{
+		`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::other/*"}]}`,
+		`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::photos/*"}]}`,
+		`{"Statement":[{"Effect":"Allow","Principal":"*","NotAction":"s3:GetObject","Resource":"arn:aws:s3:::photos/*"}]}`,
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos?policy", strings.NewReader(policy)))
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "<Code>MalformedPolicy</Code>") {
+			t.Errorf("%s: expected MalformedPolicy, got %d: %s", policy, recorder.Code, recorder.Body)
+		}
+	}
+
+	// 无法从 COS 地址解析 APPID 时不能生成 COS 资源
+	recorder = httptest.NewRecorder()
+	newTestControllerWithCOS(t, server.URL).ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos?policy", strings.NewReader(policy)))
+	if recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("expected NotImplemented without a COS default domain, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestControllerTranslatesBucketWebsite(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<WebsiteConfiguration><IndexDocument><Suffix>index.html</Suffix></IndexDocument><ErrorDocument><Key>404.html</Key></ErrorDocument></WebsiteConfiguration>`))
+		}
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos?website", strings.NewReader(`<WebsiteConfiguration><IndexDocument><Suffix>index.html</Suffix></IndexDocument><RoutingRules><RoutingRule><Condition><KeyPrefixEquals>docs/</KeyPrefixEquals></Condition><Redirect><ReplaceKeyPrefixWith>documents/</ReplaceKeyPrefixWith></Redirect></RoutingRule></RoutingRules></WebsiteConfiguration>`)))
+	if recorder.Code != http.StatusOK || !strings.Contains(received, "<Suffix>index.html</Suffix>") || !strings.Contains(received, "documents/") {
+		t.Fatalf("expected website configuration to be forwarded, got %d: %s, COS received %s", recorder.Code, recorder.Body, received)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://s3.example.com/photos?website", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "<Key>404.html</Key>") {
+		t.Fatalf("expected website configuration, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "http://s3.example.com/photos?website", strings.NewReader(`<WebsiteConfiguration><RedirectAllRequestsTo><HostName>example.com</HostName></RedirectAllRequestsTo></WebsiteConfiguration>`)))
+	if recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("expected host redirects to be rejected, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestControllerHeadObject(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Method+" "+r.URL.Path)
+		if r.URL.Path != "/a.txt" {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "5")
+		w.Header().Set("ETag", `"e1"`)
+		w.Header().Set("Last-Modified", "Sat, 01 Jan 2000 00:00:00 GMT")
+		w.Header().Set("x-cos-meta-owner", "alice")
+		w.Header().Set("x-cos-storage-class", "STANDARD_IA")
+		w.Header().Set("x-cos-version-id", "v1")
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "http://s3.example.com/photos/a.txt", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected HeadObject to succeed, got %d: %s", recorder.Code, recorder.Body)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":        "text/plain",
+		"Content-Length":      "5",
+		"ETag":                `"e1"`,
+		"Last-Modified":       "Sat, 01 Jan 2000 00:00:00 GMT",
+		"x-amz-meta-owner":    "alice",
+		"x-amz-storage-class": "STANDARD_IA",
+		"x-amz-version-id":    "v1",
+	} {
+		if got := recorder.Header().Get(name); got != want {
+			t.Errorf("expected %s %q, got %q", name, want, got)
+		}
+	}
+	if recorder.Header().Get("x-cos-meta-owner") != "" {
+		t.Errorf("expected COS metadata headers not to leak, got %v", recorder.Header())
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "http://s3.example.com/photos/missing.txt", nil))
+	if recorder.Code != http.StatusNotFound || recorder.Body.Len() != 0 {
+		t.Fatalf("expected 404 without a body, got %d: %q", recorder.Code, recorder.Body)
+	}
+
+	if got := strings.Join(requested, ","); got != "HEAD /a.txt,HEAD /missing.txt" {
+		t.Fatalf("expected HEAD requests to reach COS as HeadObject, got %s", got)
+	}
+}
+
+func TestControllerEncodesCopySources(t *testing.T) {
+	var copySource string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		copySource = r.Header.Get("x-cos-copy-source")
+		if r.URL.Query().Has("uploadId") {
+			w.Write([]byte(`<CopyPartResult><ETag>"e1"</ETag><LastModified>2024-01-01T00:00:00.000Z</LastModified></CopyPartResult>`))
+			return
+		}
+		w.Write([]byte(`<CopyObjectResult><ETag>"e1"</ETag><LastModified>2024-01-01T00:00:00.000Z</LastModified></CopyObjectResult>`))
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	for _, tc := range []struct {
+		target string
+		source string
+		status int
+		want   string
+	}{
+		{target: "/photos/b.txt", source: "photos/a%20b%E7%85%A7.txt", status: http.StatusOK, want: host + "/a%20b%E7%85%A7.txt"},
+		{target: "/photos/b.txt?partNumber=1&uploadId=u1", source: "photos/a%20b%E7%85%A7.txt", status: http.StatusOK, want: host + "/a%20b%E7%85%A7.txt"},
+		{target: "/photos/b.txt?partNumber=1&uploadId=u1", source: "photos/dir/a%20b.txt?versionId=v1", status: http.StatusOK, want: host + "/dir/a%20b.txt?versionId=v1"},
+		{target: "/photos/b.txt", source: "photos/a%3Fb.txt?versionId=v1", status: http.StatusOK, want: host + "/a%3Fb.txt?versionId=v1"},
+		{target: "/photos/b.txt", source: "photos/a%3Fb.txt", status: http.StatusBadRequest},
+		{target: "/photos/b.txt?partNumber=1&uploadId=u1", source: "photos/a%3Fb.txt", status: http.StatusBadRequest},
+	} {
+		copySource = ""
+		req := httptest.NewRequest(http.MethodPut, "http://s3.example.com"+tc.target, nil)
+		req.Header.Set("x-amz-copy-source", tc.source)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != tc.status || copySource != tc.want {
+			t.Errorf("PUT %s from %s: expected %d with copy source %q, got %d with %q: %s", tc.target, tc.source, tc.status, tc.want, recorder.Code, copySource, recorder.Body)
+		}
+	}
+}
+
+func TestControllerDeletesMultipleObjects(t *testing.T) {
+	var forwarded string
+	var deletes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deletes++
+		body, _ := io.ReadAll(r.Body)
+		forwarded = string(body)
+		// 模拟 COS 对 denied.txt 返回单个对象的错误，其余对象删除成功
+		result := "<DeleteResult>"
+		for _, key := range []string{"a.txt", "denied.txt"} {
+			if !strings.Contains(forwarded, "<Key>"+key+"</Key>") {
+				continue
+			}
+			if key == "denied.txt" {
+				result += "<Error><Key>denied.txt</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"
+				continue
+			}
+			result += "<Deleted><Key>" + key + "</Key></Deleted>"
+		}
+		if strings.Contains(forwarded, "<VersionId>v1</VersionId>") {
+			result += "<Deleted><Key>b.txt</Key><VersionId>v1</VersionId></Deleted>"
+		}
+		w.Write([]byte(result + "</DeleteResult>"))
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	deleteBody := func(quiet bool, keys ...string) string {
+		body := "<Delete>"
+		if quiet {
+			body += "<Quiet>true</Quiet>"
+		}
+		for _, key := range keys {
+			body += "<Object><Key>" + key + "</Key></Object>"
+		}
+		return body + "</Delete>"
+	}
+	contentMD5 := func(body string) map[string]string {
+		sum := md5.Sum([]byte(body))
+		return map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(sum[:])}
+	}
+	sha256Checksum := func(body string) map[string]string {
+		sum := sha256.Sum256([]byte(body))
+		return map[string]string{"x-amz-checksum-sha256": base64.StdEncoding.EncodeToString(sum[:])}
+	}
+	versioned := "<Delete><Object><Key>a.txt</Key></Object><Object><Key>b.txt</Key><VersionId>v1</VersionId></Object><Object><Key>denied.txt</Key></Object></Delete>"
+	tooMany := make([]string, 1001)
+	for i := range tooMany {
+		tooMany[i] = "a.txt"
+	}
+
+	for _, tc := range []struct {
+		name      string
+		body      string
+		headers   map[string]string
+		status    int
+		want      []string
+		notWant   []string
+		forwarded string
+	}{
+		{
+			name:      "deleted objects and per-key errors",
+			body:      versioned,
+			headers:   contentMD5(versioned),
+			status:    http.StatusOK,
+			want:      []string{"<Deleted>\n    <Key>a.txt</Key>", "<Key>b.txt</Key>\n    <VersionId>v1</VersionId>", "<Error>\n    <Key>denied.txt</Key>\n    <Code>AccessDenied</Code>\n    <Message>Access Denied</Message>"},
+			forwarded: "<VersionId>v1</VersionId>",
+		},
+		{
+			name:    "quiet mode only returns errors",
+			body:    deleteBody(true, "a.txt", "denied.txt"),
+			headers: contentMD5(deleteBody(true, "a.txt", "denied.txt")),
+			status:  http.StatusOK,
+			want:    []string{"<Key>denied.txt</Key>"},
+			notWant: []string{"<Deleted>"},
+		},
+		{name: "sha256 checksum", body: deleteBody(false, "a.txt"), headers: sha256Checksum(deleteBody(false, "a.txt")), status: http.StatusOK, want: []string{"<Key>a.txt</Key>"}},
+		{name: "missing checksum", body: deleteBody(false, "a.txt"), status: http.StatusBadRequest, want: []string{"<Code>InvalidRequest</Code>"}},
+		{name: "mismatched Content-MD5", body: deleteBody(false, "a.txt"), headers: contentMD5(deleteBody(false, "b.txt")), status: http.StatusBadRequest, want: []string{"<Code>BadDigest</Code>"}},
+		{name: "mismatched checksum", body: deleteBody(false, "a.txt"), headers: sha256Checksum(deleteBody(false, "b.txt")), status: http.StatusBadRequest, want: []string{"<Code>BadDigest</Code>"}},
+		{name: "malformed XML", body: "<Delete><Object>", headers: contentMD5("<Delete><Object>"), status: http.StatusBadRequest, want: []string{"<Code>MalformedXML</Code>"}},
+		{name: "no objects", body: deleteBody(false), headers: contentMD5(deleteBody(false)), status: http.StatusBadRequest, want: []string{"<Code>MalformedXML</Code>"}},
+		{name: "more than 1000 objects", body: deleteBody(false, tooMany...), headers: contentMD5(deleteBody(false, tooMany...)), status: http.StatusBadRequest, want: []string{"<Code>MalformedXML</Code>"}},
+	} {
+		deletes, forwarded = 0, ""
+		req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos?delete", strings.NewReader(tc.body))
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.status, recorder.Code, recorder.Body)
+			continue
+		}
+		if tc.status != http.StatusOK && deletes != 0 {
+			t.Errorf("%s: expected the request to be rejected before reaching COS", tc.name)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(recorder.Body.String(), want) {
+				t.Errorf("%s: expected response to contain %q, got %s", tc.name, want, recorder.Body)
+			}
+		}
+		for _, notWant := range tc.notWant {
+			if strings.Contains(recorder.Body.String(), notWant) {
+				t.Errorf("%s: expected response not to contain %q, got %s", tc.name, notWant, recorder.Body)
+			}
+		}
+		if !strings.Contains(forwarded, tc.forwarded) {
+			t.Errorf("%s: expected COS request to contain %q, got %s", tc.name, tc.forwarded, forwarded)
+		}
+	}
+}
+
+func TestControllerVerifiesCompleteMultipartUploadBody(t *testing.T) {
+	var completed int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		completed++
+		w.Write([]byte(`<CompleteMultipartUploadResult><Bucket>photos</Bucket><Key>a.txt</Key><ETag>"e1"</ETag></CompleteMultipartUploadResult>`))
+	}))
+	defer server.Close()
+	router := newTestControllerWithCOS(t, server.URL)
+
+	// 根元素之后的内容也在签名范围内，流式解析 XML 读到根元素结束就会停止，不会读到这部分数据
+	body := `<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>"e1"</ETag></Part></CompleteMultipartUpload>` + strings.Repeat("\n", 8192)
+	for _, tc := range []struct {
+		name        string
+		payloadHash string
+		status      int
+		completed   int
+	}{
+		{name: "matching payload hash", payloadHash: hexSHA256(body), status: http.StatusOK, completed: 1},
+		{name: "mismatched payload hash", payloadHash: hexSHA256(strings.TrimSpace(body)), status: http.StatusBadRequest},
+	} {
+		completed = 0
+		req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/photos/a.txt?uploadId=u1", strings.NewReader(body))
+		if err := installPayloadHashReader(req, tc.payloadHash); err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != tc.status || completed != tc.completed {
+			t.Errorf("%s: expected %d with %d COS calls, got %d with %d: %s", tc.name, tc.status, tc.completed, recorder.Code, completed, recorder.Body)
+		}
+	}
+}
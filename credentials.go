@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	controllers "cos-proxy/controller"
+)
+
+type credentialAction string
+
+const (
+	actionRead      credentialAction = "read"
+	actionWrite     credentialAction = "write"
+	actionDelete    credentialAction = "delete"
+	actionList      credentialAction = "list"
+	actionMultipart credentialAction = "multipart"
+	actionAdmin     credentialAction = "admin"
+	actionAll       credentialAction = "*"
+)
+
+const maxPolicyInspectBodySize = 2 << 20
+
+var errCredentialForbidden = errors.New("access key is not allowed to perform this request")
+
+// proxyCredential 是一组代理访问密钥及其权限，Actions 为空表示没有任何权限，Prefixes 为空表示不限制 key 前缀。
+// AllowSigV2 为 true 时该密钥也接受旧版 SigV2 签名，默认只接受 SigV4。
+// parent 和 sessionPolicy 只在临时凭证上设置，分别是签发它的长期密钥和可选的会话策略。
+type proxyCredential struct {
+	AccessKey  string   `json:"access_key"`
+	SecretKey  string   `json:"secret_key"`
+	Enabled    *bool    `json:"enabled,omitempty"`
+	Actions    []string `json:"actions"`
+	Prefixes   []string `json:"prefixes,omitempty"`
+	AllowSigV2 bool     `json:"allow_sigv2,omitempty"`
+
+	parent        string
+	sessionPolicy *bucketPolicy
+}
+
+type credentialsFile struct {
+	Credentials []*proxyCredential `json:"credentials"`
+}
+
+// loadProxyCredentials 从 JSON 配置文件中读取代理访问密钥列表。
+func loadProxyCredentials(path string) ([]*proxyCredential, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	var file credentialsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for i, credential := range file.Credentials {
+		if credential == nil || credential.AccessKey == "" || credential.SecretKey == "" {
+			return nil, fmt.Errorf("credential #%d: access_key and secret_key are required", i+1)
+		}
+		if seen[credential.AccessKey] {
+			return nil, fmt.Errorf("credential #%d: duplicate access_key %s", i+1, credential.AccessKey)
+		}
+		seen[credential.AccessKey] = true
+		for _, action := range credential.Actions {
+			switch credentialAction(action) {
+			case actionRead, actionWrite, actionDelete, actionList, actionMultipart, actionAdmin, actionAll:
+			default:
+				return nil, fmt.Errorf("credential %s: unknown action %q", credential.AccessKey, action)
+			}
+		}
+	}
+	return file.Credentials, nil
+}
+
+func (c *proxyCredential) isEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// principal 返回存储桶策略中用于匹配 Principal 的访问密钥，临时凭证以签发它的长期密钥身份评估。
+func (c *proxyCredential) principal() string {
+	if c.parent != "" {
+		return c.parent
+	}
+	return c.AccessKey
+}
+
+// hasAction 判断密钥是否拥有指定权限，"*" 代表全部对象操作，但不包括 admin。
+func (c *proxyCredential) hasAction(action credentialAction) bool {
+	for _, candidate := range c.Actions {
+		if credentialAction(candidate) == action || (credentialAction(candidate) == actionAll && action != actionAdmin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *proxyCredential) allows(action credentialAction, key string) bool {
+	if !c.hasAction(action) {
+		return false
+	}
+
+	return len(c.Prefixes) == 0 || hasAnyPrefix(key, c.Prefixes)
+}
+
+func (c *proxyCredential) signature(amzDate, scope, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		awsSigV4Algorithm,
+		amzDate,
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	signingKey := c.signingKey(scope)
+	if signingKey == nil {
+		return ""
+	}
+	return hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+func (c *proxyCredential) signingKey(scope string) []byte {
+	parts := strings.Split(scope, "/")
+	if len(parts) != 4 {
+		return nil
+	}
+	date, region, service := parts[0], parts[1], parts[2]
+	signingKey := hmacSHA256([]byte("AWS4"+c.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	return hmacSHA256(signingKey, awsSigV4Request)
+}
+
+// s3Operation 描述请求实际执行的一个 S3 操作。action 是 IAM 风格的操作名，grant 是访问密钥策略中对应的权限，
+// key 对列举类操作而言是列举前缀。
+type s3Operation struct {
+	action string
+	grant  credentialAction
+	bucket string
+	key    string
+}
+
+// resource 返回操作对应的资源 ARN，存储桶级别的操作使用存储桶 ARN。
+func (o s3Operation) resource() string {
+	switch o.action {
+	case "s3:ListAllMyBuckets":
+		return s3ARNPrefix + "*"
+	case "s3:ListBucket", "s3:ListBucketMultipartUploads", "s3:GetBucketLocation", "s3:GetBucketAcl", "s3:PutBucketAcl",
+		"s3:ListBucketVersions", "s3:GetBucketVersioning", "s3:PutBucketVersioning",
+		"s3:GetBucketObjectLockConfiguration", "s3:PutBucketObjectLockConfiguration",
+		"s3:GetBucketCORS", "s3:PutBucketCORS", "s3:GetLifecycleConfiguration", "s3:PutLifecycleConfiguration",
+		"s3:GetBucketPolicy", "s3:PutBucketPolicy", "s3:DeleteBucketPolicy",
+		"s3:GetBucketWebsite", "s3:PutBucketWebsite", "s3:DeleteBucketWebsite":
+		return s3ARNPrefix + o.bucket
+	}
+	return s3ARNPrefix + o.bucket + "/" + o.key
+}
+
+// authorizeCredential 检查通过签名认证的访问密钥是否允许执行请求涉及的全部操作。
+func authorizeCredential(credential *proxyCredential, operations []s3Operation) error {
+	for _, operation := range operations {
+		if !credential.allows(operation.grant, operation.key) {
+			return fmt.Errorf("%w: %s on %q", errCredentialForbidden, operation.grant, operation.key)
+		}
+	}
+	return nil
+}
+
+// requiresPrivilegedCredential 判断请求是否包含 admin 操作，这些操作只能由拥有 admin 权限的访问密钥签名执行。
+func requiresPrivilegedCredential(operations []s3Operation) bool {
+	for _, operation := range operations {
+		if operation.grant == actionAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// bucketConfigurations 是存储桶配置子资源在 GET/PUT/DELETE 时对应的 S3 操作，顺序与控制器的分发顺序一致。
+var bucketConfigurations = []struct {
+	subResource      string
+	get, put, remove string
+}{
+	{subResource: "cors", get: "s3:GetBucketCORS", put: "s3:PutBucketCORS", remove: "s3:PutBucketCORS"},
+	{subResource: "lifecycle", get: "s3:GetLifecycleConfiguration", put: "s3:PutLifecycleConfiguration", remove: "s3:PutLifecycleConfiguration"},
+	{subResource: "policy", get: "s3:GetBucketPolicy", put: "s3:PutBucketPolicy", remove: "s3:DeleteBucketPolicy"},
+	{subResource: "website", get: "s3:GetBucketWebsite", put: "s3:PutBucketWebsite", remove: "s3:DeleteBucketWebsite"},
+}
+
+// requestOperations 按照 S3 控制器的分发规则，推导出请求涉及的 S3 操作以及对应的对象 key。
+func requestOperations(r *http.Request, bucket, key string) ([]s3Operation, error) {
+	query := r.URL.Query()
+	var operations []s3Operation
+
+	if bucket == "" && r.Method == http.MethodGet {
+		return []s3Operation{{action: "s3:ListAllMyBuckets", grant: actionList}}, nil
+	}
+
+	if source := r.Header.Get("x-amz-copy-source"); source != "" && r.Method == http.MethodPut {
+		sourceBucket, sourceKey, _, err := controllers.ParseCopySource(source)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, s3Operation{action: "s3:GetObject", grant: actionRead, bucket: sourceBucket, key: sourceKey})
+	}
+
+	// 上传时通过 x-amz-tagging 附带标签、通过 x-amz-acl/x-amz-grant-* 设置 ACL 时，同时需要对应的权限
+	if r.Method == http.MethodPut || (r.Method == http.MethodPost && query.Has("uploads")) {
+		if r.Header.Get("x-amz-tagging") != "" {
+			operations = append(operations, s3Operation{action: "s3:PutObjectTagging", grant: actionWrite, bucket: bucket, key: key})
+		}
+		aclHeaders := r.Header.Get("x-amz-acl") != "" || r.Header.Get("x-amz-grant-read") != "" || r.Header.Get("x-amz-grant-write") != "" || r.Header.Get("x-amz-grant-full-control") != ""
+		if aclHeaders && !query.Has("acl") {
+			operations = append(operations, s3Operation{action: "s3:PutObjectAcl", grant: actionWrite, bucket: bucket, key: key})
+		}
+		if r.Header.Get("x-amz-object-lock-mode") != "" || r.Header.Get("x-amz-object-lock-retain-until-date") != "" {
+			operations = append(operations, s3Operation{action: "s3:PutObjectRetention", grant: actionWrite, bucket: bucket, key: key})
+		}
+		if r.Header.Get("x-amz-object-lock-legal-hold") != "" {
+			operations = append(operations, s3Operation{action: "s3:PutObjectLegalHold", grant: actionWrite, bucket: bucket, key: key})
+		}
+	}
+	// 绕过 GOVERNANCE 模式的保留期限只允许管理员执行
+	if strings.EqualFold(r.Header.Get("x-amz-bypass-governance-retention"), "true") {
+		operations = append(operations, s3Operation{action: "s3:BypassGovernanceRetention", grant: actionAdmin, bucket: bucket, key: key})
+	}
+
+	if _, ok := query["versions"]; ok && r.Method == http.MethodGet {
+		return append(operations, s3Operation{action: "s3:ListBucketVersions", grant: actionList, bucket: bucket, key: query.Get("prefix")}), nil
+	}
+	if _, ok := query["versioning"]; ok {
+		if r.Method == http.MethodGet {
+			return append(operations, s3Operation{action: "s3:GetBucketVersioning", grant: actionList, bucket: bucket}), nil
+		}
+		return append(operations, s3Operation{action: "s3:PutBucketVersioning", grant: actionAdmin, bucket: bucket}), nil
+	}
+
+	if _, ok := query["acl"]; ok {
+		switch {
+		case key == "" && r.Method == http.MethodPut:
+			return append(operations, s3Operation{action: "s3:PutBucketAcl", grant: actionAdmin, bucket: bucket}), nil
+		case key == "":
+			return append(operations, s3Operation{action: "s3:GetBucketAcl", grant: actionList, bucket: bucket}), nil
+		case r.Method == http.MethodPut:
+			return append(operations, s3Operation{action: "s3:PutObjectAcl", grant: actionWrite, bucket: bucket, key: key}), nil
+		default:
+			return append(operations, s3Operation{action: "s3:GetObjectAcl", grant: actionRead, bucket: bucket, key: key}), nil
+		}
+	}
+
+	if _, ok := query["tagging"]; ok {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			return append(operations, s3Operation{action: "s3:GetObjectTagging", grant: actionRead, bucket: bucket, key: key}), nil
+		case http.MethodPut:
+			return append(operations, s3Operation{action: "s3:PutObjectTagging", grant: actionWrite, bucket: bucket, key: key}), nil
+		case http.MethodDelete:
+			return append(operations, s3Operation{action: "s3:DeleteObjectTagging", grant: actionWrite, bucket: bucket, key: key}), nil
+		}
+	}
+	if _, ok := query["restore"]; ok && r.Method == http.MethodPost {
+		return append(operations, s3Operation{action: "s3:RestoreObject", grant: actionWrite, bucket: bucket, key: key}), nil
+	}
+	// 存储桶配置会影响所有对象的访问和保存方式，读取和修改都只允许管理员执行
+	for _, configuration := range bucketConfigurations {
+		if _, ok := query[configuration.subResource]; !ok {
+			continue
+		}
+		action := configuration.put
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			action = configuration.get
+		case http.MethodDelete:
+			action = configuration.remove
+		}
+		return append(operations, s3Operation{action: action, grant: actionAdmin, bucket: bucket}), nil
+	}
+	if _, ok := query["object-lock"]; ok {
+		if r.Method == http.MethodGet {
+			return append(operations, s3Operation{action: "s3:GetBucketObjectLockConfiguration", grant: actionList, bucket: bucket}), nil
+		}
+		return append(operations, s3Operation{action: "s3:PutBucketObjectLockConfiguration", grant: actionAdmin, bucket: bucket}), nil
+	}
+	if _, ok := query["retention"]; ok {
+		if r.Method == http.MethodPut {
+			return append(operations, s3Operation{action: "s3:PutObjectRetention", grant: actionWrite, bucket: bucket, key: key}), nil
+		}
+		return append(operations, s3Operation{action: "s3:GetObjectRetention", grant: actionRead, bucket: bucket, key: key}), nil
+	}
+	if _, ok := query["legal-hold"]; ok {
+		if r.Method == http.MethodPut {
+			return append(operations, s3Operation{action: "s3:PutObjectLegalHold", grant: actionWrite, bucket: bucket, key: key}), nil
+		}
+		return append(operations, s3Operation{action: "s3:GetObjectLegalHold", grant: actionRead, bucket: bucket, key: key}), nil
+	}
+	if _, ok := query["uploads"]; ok {
+		if r.Method == http.MethodGet {
+			return append(operations, s3Operation{action: "s3:ListBucketMultipartUploads", grant: actionList, bucket: bucket, key: query.Get("prefix")}), nil
+		}
+		return append(operations, s3Operation{action: "s3:PutObject", grant: actionMultipart, bucket: bucket, key: key}), nil
+	}
+	if _, ok := query["uploadId"]; ok {
+		if r.Method == http.MethodGet {
+			return append(operations, s3Operation{action: "s3:ListMultipartUploadParts", grant: actionList, bucket: bucket, key: key}), nil
+		}
+		action := "s3:PutObject"
+		switch r.Method {
+		case http.MethodDelete:
+			action = "s3:AbortMultipartUpload"
+		}
+		return append(operations, s3Operation{action: action, grant: actionMultipart, bucket: bucket, key: key}), nil
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if _, ok := query["location"]; ok && key == "" && r.Method == http.MethodGet {
+			return append(operations, s3Operation{action: "s3:GetBucketLocation", grant: actionList, bucket: bucket}), nil
+		}
+		if key == "" {
+			return append(operations, s3Operation{action: "s3:ListBucket", grant: actionList, bucket: bucket, key: query.Get("prefix")}), nil
+		}
+		// 读取或删除历史版本在 S3 中是独立的操作，默认的公开读策略不会放行历史版本
+		if query.Get("versionId") != "" {
+			return append(operations, s3Operation{action: "s3:GetObjectVersion", grant: actionRead, bucket: bucket, key: key}), nil
+		}
+		return append(operations, s3Operation{action: "s3:GetObject", grant: actionRead, bucket: bucket, key: key}), nil
+	case http.MethodPut:
+		return append(operations, s3Operation{action: "s3:PutObject", grant: actionWrite, bucket: bucket, key: key}), nil
+	case http.MethodDelete:
+		if query.Get("versionId") != "" {
+			return append(operations, s3Operation{action: "s3:DeleteObjectVersion", grant: actionDelete, bucket: bucket, key: key}), nil
+		}
+		return append(operations, s3Operation{action: "s3:DeleteObject", grant: actionDelete, bucket: bucket, key: key}), nil
+	case http.MethodPost:
+		if _, ok := query["delete"]; ok {
+			objects, err := deleteRequestObjects(r)
+			if err != nil {
+				return nil, err
+			}
+			for _, object := range objects {
+				// 与单个 DELETE 相同，指定 VersionId 的条目会永久删除历史版本
+				action := "s3:DeleteObject"
+				if object.VersionID != "" {
+					action = "s3:DeleteObjectVersion"
+				}
+				operations = append(operations, s3Operation{action: action, grant: actionDelete, bucket: bucket, key: object.Key})
+			}
+			return operations, nil
+		}
+		formKey, err := postFormKey(r)
+		if err != nil {
+			return nil, err
+		}
+		return append(operations, s3Operation{action: "s3:PutObject", grant: actionWrite, bucket: bucket, key: formKey}), nil
+	}
+	return nil, fmt.Errorf("unsupported method %s", r.Method)
+}
+
+// deleteRequestObject 是批量删除请求体中的一个条目。
+type deleteRequestObject struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId"`
+}
+
+// deleteRequestObjects 读取批量删除请求体中的 key 和版本列表，并把请求体恢复原样供控制器继续使用。
+func deleteRequestObjects(r *http.Request) ([]deleteRequestObject, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPolicyInspectBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxPolicyInspectBodySize {
+		return nil, errors.New("delete request body is too large")
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var deleteRequest struct {
+		Objects []deleteRequestObject `xml:"Object"`
+	}
+	if err := xml.Unmarshal(body, &deleteRequest); err != nil {
+		return nil, err
+	}
+	return deleteRequest.Objects, nil
+}
+
+// postFormKey 解析表单上传的目标 key。表单已被完整解析时直接使用解析结果，
+// 否则只读取 file 之前的字段，匿名请求在授权通过之前不会接收文件内容。
+func postFormKey(r *http.Request) (string, error) {
+	var key, filename string
+	if r.MultipartForm != nil {
+		keys := r.MultipartForm.Value["key"]
+		files := r.MultipartForm.File["file"]
+		if len(keys) == 0 || len(files) == 0 {
+			return "", errors.New("'key' and 'file' fields are required")
+		}
+		key, filename = keys[0], files[0].Filename
+	} else {
+		head, err := readPostFormHead(r)
+		if err != nil {
+			return "", err
+		}
+		if head.fields["key"] == "" || head.filename == "" {
+			return "", errors.New("'key' and 'file' fields are required")
+		}
+		key, filename = head.fields["key"], head.filename
+	}
+	return strings.ReplaceAll(key, "${filename}", filename), nil
+}
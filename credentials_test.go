@@ -0,0 +1,381 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadProxyCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	content := `{"credentials": [
+		{"access_key": "uploader", "secret_key": "s1", "actions": ["write", "multipart"], "prefixes": ["uploads/"]},
+		{"access_key": "retired", "secret_key": "s2", "enabled": false, "actions": ["*"]}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	credentials, err := loadProxyCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credentials) != 2 {
+		t.Fatalf("expected 2 credentials, got %d", len(credentials))
+	}
+	if !credentials[0].isEnabled() || credentials[1].isEnabled() {
+		t.Fatal("expected enabled flag to default to true and honour false")
+	}
+}
+
+func TestLoadProxyCredentialsRejectsInvalidEntries(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing secret": `{"credentials": [{"access_key": "a", "actions": ["read"]}]}`,
+		"duplicate key":  `{"credentials": [{"access_key": "a", "secret_key": "s"}, {"access_key": "a", "secret_key": "s"}]}`,
+		"unknown action": `{"credentials": [{"access_key": "a", "secret_key": "s", "actions": ["superuser"]}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "credentials.json")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadProxyCredentials(path); err == nil {
+				t.Fatal("expected invalid credentials file to be rejected")
+			}
+		})
+	}
+}
+
+func TestAuthenticatorRejectsDisabledCredential(t *testing.T) {
+	disabled := false
+	auth := restrictedAuthenticator(&proxyCredential{Enabled: &disabled, Actions: []string{"*"}})
+	req := newSignedRequest(t, auth, "PUT", "http://s3.example.com/bucket/path/file.txt", "hello")
+
+	if err := auth.Verify(req); !errors.Is(err, errInvalidSignature) {
+		t.Fatalf("expected disabled key to be rejected, got %v", err)
+	}
+}
+
+func TestWriteAccessMiddlewareEnforcesCredentialPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		body   string
+		status int
+	}{
+		{name: "write inside prefix", method: "PUT", target: "http://s3.example.com/bucket/uploads/a.txt", status: http.StatusOK},
+		{name: "write outside prefix", method: "PUT", target: "http://s3.example.com/bucket/private/a.txt", status: http.StatusForbidden},
+		{name: "delete not granted", method: "DELETE", target: "http://s3.example.com/bucket/uploads/a.txt", status: http.StatusForbidden},
+		{name: "multipart inside prefix", method: "POST", target: "http://s3.example.com/bucket/uploads/a.txt?uploads", status: http.StatusOK},
+		{name: "multipart listing not granted", method: "GET", target: "http://s3.example.com/bucket?uploads&prefix=uploads/", status: http.StatusForbidden},
+		{
+			name:   "copy from unreadable source",
+			method: "PUT",
+			target: "http://s3.example.com/bucket/uploads/a.txt",
+			header: map[string]string{"X-Amz-Copy-Source": "/bucket/private/a.txt"},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "bypass governance retention without admin",
+			method: "PUT",
+			target: "http://s3.example.com/bucket/uploads/a.txt",
+			header: map[string]string{"X-Amz-Bypass-Governance-Retention": "true"},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "multi-object delete",
+			method: "POST",
+			target: "http://s3.example.com/bucket?delete",
+			body:   "<Delete><Object><Key>uploads/a.txt</Key></Object></Delete>",
+			status: http.StatusForbidden,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := restrictedAuthenticator(&proxyCredential{
+				Actions:  []string{"write", "multipart"},
+				Prefixes: []string{"uploads/"},
+			})
+			req := newSignedRequest(t, auth, tc.method, tc.target, tc.body)
+			for name, value := range tc.header {
+				req.Header.Set(name, value)
+			}
+			req.Header.Set("X-Real-IP", "203.0.113.10")
+			recorder := httptest.NewRecorder()
+
+			writeAccessMiddleware(defaultBucketPolicy(nil, []string{"proxy-access"}), auth, nil, "", nil)(newTestContext(recorder, req))
+
+			if recorder.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestRequestOperationsPreservesDeleteBody(t *testing.T) {
+	body := "<Delete><Object><Key>a.txt</Key></Object><Object><Key>b.txt</Key></Object></Delete>"
+	req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/bucket?delete", strings.NewReader(body))
+
+	operations, err := requestOperations(req, "bucket", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 2 || operations[0] != (s3Operation{action: "s3:DeleteObject", grant: actionDelete, bucket: "bucket", key: "a.txt"}) || operations[1].key != "b.txt" {
+		t.Fatalf("unexpected operations %+v", operations)
+	}
+	restored, err := io.ReadAll(req.Body)
+	if err != nil || string(restored) != body {
+		t.Fatalf("expected request body to be restored, got %q, %v", restored, err)
+	}
+}
+
+func TestRequestOperationsForVersionedDelete(t *testing.T) {
+	body := "<Delete><Object><Key>a.txt</Key></Object><Object><Key>a.txt</Key><VersionId>v1</VersionId></Object></Delete>"
+	req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/bucket?delete", strings.NewReader(body))
+
+	operations, err := requestOperations(req, "bucket", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []s3Operation{
+		{action: "s3:DeleteObject", grant: actionDelete, bucket: "bucket", key: "a.txt"},
+		{action: "s3:DeleteObjectVersion", grant: actionDelete, bucket: "bucket", key: "a.txt"},
+	}
+	if len(operations) != len(want) || operations[0] != want[0] || operations[1] != want[1] {
+		t.Fatalf("expected %+v, got %+v", want, operations)
+	}
+}
+
+func TestRequestOperationsForTagging(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		target string
+		header string
+		want   []s3Operation
+	}{
+		{method: http.MethodGet, target: "http://s3.example.com/bucket/a.txt?tagging", want: []s3Operation{{action: "s3:GetObjectTagging", grant: actionRead, bucket: "bucket", key: "a.txt"}}},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket/a.txt?tagging", want: []s3Operation{{action: "s3:PutObjectTagging", grant: actionWrite, bucket: "bucket", key: "a.txt"}}},
+		{method: http.MethodDelete, target: "http://s3.example.com/bucket/a.txt?tagging", want: []s3Operation{{action: "s3:DeleteObjectTagging", grant: actionWrite, bucket: "bucket", key: "a.txt"}}},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket/a.txt", header: "team=a", want: []s3Operation{
+			{action: "s3:PutObjectTagging", grant: actionWrite, bucket: "bucket", key: "a.txt"},
+			{action: "s3:PutObject", grant: actionWrite, bucket: "bucket", key: "a.txt"},
+		}},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		if tc.header != "" {
+			req.Header.Set("x-amz-tagging", tc.header)
+		}
+		operations, err := requestOperations(req, "bucket", "a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(operations, tc.want) {
+			t.Errorf("%s %s: expected %+v, got %+v", tc.method, tc.target, tc.want, operations)
+		}
+	}
+}
+
+func TestRequestOperationsForACLs(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		target string
+		key    string
+		header string
+		want   []s3Operation
+	}{
+		{method: http.MethodGet, target: "http://s3.example.com/bucket?acl", want: []s3Operation{{action: "s3:GetBucketAcl", grant: actionList, bucket: "bucket"}}},
+		{method: http.MethodGet, target: "http://s3.example.com/bucket/a.txt?acl", key: "a.txt", want: []s3Operation{{action: "s3:GetObjectAcl", grant: actionRead, bucket: "bucket", key: "a.txt"}}},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket/a.txt?acl", key: "a.txt", header: "public-read", want: []s3Operation{{action: "s3:PutObjectAcl", grant: actionWrite, bucket: "bucket", key: "a.txt"}}},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket/a.txt", key: "a.txt", header: "public-read", want: []s3Operation{
+			{action: "s3:PutObjectAcl", grant: actionWrite, bucket: "bucket", key: "a.txt"},
+			{action: "s3:PutObject", grant: actionWrite, bucket: "bucket", key: "a.txt"},
+		}},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		if tc.header != "" {
+			req.Header.Set("x-amz-acl", tc.header)
+		}
+		operations, err := requestOperations(req, "bucket", tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(operations, tc.want) {
+			t.Errorf("%s %s: expected %+v, got %+v", tc.method, tc.target, tc.want, operations)
+		}
+	}
+}
+
+func TestRequestOperationsForVersions(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		target string
+		key    string
+		want   s3Operation
+	}{
+		{method: http.MethodGet, target: "http://s3.example.com/bucket?versions&prefix=docs/", want: s3Operation{action: "s3:ListBucketVersions", grant: actionList, bucket: "bucket", key: "docs/"}},
+		{method: http.MethodGet, target: "http://s3.example.com/bucket?versioning", want: s3Operation{action: "s3:GetBucketVersioning", grant: actionList, bucket: "bucket"}},
+		{method: http.MethodGet, target: "http://s3.example.com/bucket/a.txt?versionId=v1", key: "a.txt", want: s3Operation{action: "s3:GetObjectVersion", grant: actionRead, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodHead, target: "http://s3.example.com/bucket/a.txt?versionId=v1", key: "a.txt", want: s3Operation{action: "s3:GetObjectVersion", grant: actionRead, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodDelete, target: "http://s3.example.com/bucket/a.txt?versionId=v1", key: "a.txt", want: s3Operation{action: "s3:DeleteObjectVersion", grant: actionDelete, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodPost, target: "http://s3.example.com/bucket/logs/a.gz?restore", key: "logs/a.gz", want: s3Operation{action: "s3:RestoreObject", grant: actionWrite, bucket: "bucket", key: "logs/a.gz"}},
+	} {
+		operations, err := requestOperations(httptest.NewRequest(tc.method, tc.target, nil), "bucket", tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(operations) != 1 || operations[0] != tc.want {
+			t.Errorf("%s %s: expected %+v, got %+v", tc.method, tc.target, tc.want, operations)
+		}
+	}
+}
+
+func TestRequestOperationsForObjectLock(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		target string
+		key    string
+		want   s3Operation
+	}{
+		{method: http.MethodGet, target: "http://s3.example.com/bucket/a.txt?retention", key: "a.txt", want: s3Operation{action: "s3:GetObjectRetention", grant: actionRead, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket/a.txt?retention", key: "a.txt", want: s3Operation{action: "s3:PutObjectRetention", grant: actionWrite, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodGet, target: "http://s3.example.com/bucket/a.txt?legal-hold", key: "a.txt", want: s3Operation{action: "s3:GetObjectLegalHold", grant: actionRead, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket/a.txt?legal-hold", key: "a.txt", want: s3Operation{action: "s3:PutObjectLegalHold", grant: actionWrite, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodGet, target: "http://s3.example.com/bucket?object-lock", want: s3Operation{action: "s3:GetBucketObjectLockConfiguration", grant: actionList, bucket: "bucket"}},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket?object-lock", want: s3Operation{action: "s3:PutBucketObjectLockConfiguration", grant: actionAdmin, bucket: "bucket"}},
+	} {
+		operations, err := requestOperations(httptest.NewRequest(tc.method, tc.target, nil), "bucket", tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(operations) != 1 || operations[0] != tc.want {
+			t.Errorf("%s %s: expected %+v, got %+v", tc.method, tc.target, tc.want, operations)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/bucket/a.txt", nil)
+	req.Header.Set("x-amz-object-lock-mode", "GOVERNANCE")
+	req.Header.Set("x-amz-object-lock-retain-until-date", "2030-01-01T00:00:00Z")
+	req.Header.Set("x-amz-object-lock-legal-hold", "ON")
+	req.Header.Set("x-amz-bypass-governance-retention", "true")
+	operations, err := requestOperations(req, "bucket", "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, operation := range operations {
+		actions = append(actions, operation.action)
+	}
+	if got := strings.Join(actions, ","); got != "s3:PutObjectRetention,s3:PutObjectLegalHold,s3:BypassGovernanceRetention,s3:PutObject" {
+		t.Errorf("unexpected operations for a locked upload: %s", got)
+	}
+}
+
+func TestWriteAccessMiddlewareRejectsAnonymousGovernanceBypass(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "http://s3.example.com/bucket/records/a.txt", nil)
+	req.Header.Set("X-Real-IP", "198.51.100.7")
+	req.Header.Set("x-amz-bypass-governance-retention", "true")
+	recorder := httptest.NewRecorder()
+
+	writeAccessMiddleware(defaultBucketPolicy([]string{"198.51.100.7"}, nil), nil, nil, "", nil)(newTestContext(recorder, req))
+
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected anonymous governance bypass to be rejected, got status %d", recorder.Code)
+	}
+}
+
+func TestRequestOperationsForBucketConfiguration(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		target string
+		action string
+	}{
+		{method: http.MethodGet, target: "http://s3.example.com/bucket?cors", action: "s3:GetBucketCORS"},
+		{method: http.MethodDelete, target: "http://s3.example.com/bucket?cors", action: "s3:PutBucketCORS"},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket?lifecycle", action: "s3:PutLifecycleConfiguration"},
+		{method: http.MethodGet, target: "http://s3.example.com/bucket?policy", action: "s3:GetBucketPolicy"},
+		{method: http.MethodDelete, target: "http://s3.example.com/bucket?policy", action: "s3:DeleteBucketPolicy"},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket?website", action: "s3:PutBucketWebsite"},
+	} {
+		operations, err := requestOperations(httptest.NewRequest(tc.method, tc.target, nil), "bucket", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := s3Operation{action: tc.action, grant: actionAdmin, bucket: "bucket"}
+		if len(operations) != 1 || operations[0] != want {
+			t.Errorf("%s %s: expected %+v, got %+v", tc.method, tc.target, want, operations)
+		}
+		if resource := operations[0].resource(); resource != "arn:aws:s3:::bucket" {
+			t.Errorf("%s %s: expected bucket resource, got %s", tc.method, tc.target, resource)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "http://s3.example.com/bucket?policy", nil)
+	req.Header.Set("X-Real-IP", "198.51.100.7")
+	recorder := httptest.NewRecorder()
+
+	writeAccessMiddleware(defaultBucketPolicy([]string{"198.51.100.7"}, nil), nil, nil, "", nil)(newTestContext(recorder, req))
+
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected anonymous bucket policy change to be rejected, got status %d", recorder.Code)
+	}
+}
+
+func TestRequestOperationsForMultipart(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		target string
+		key    string
+		want   s3Operation
+	}{
+		{method: http.MethodGet, target: "http://s3.example.com/bucket?uploads&prefix=docs/", want: s3Operation{action: "s3:ListBucketMultipartUploads", grant: actionList, bucket: "bucket", key: "docs/"}},
+		{method: http.MethodGet, target: "http://s3.example.com/bucket/a.txt?uploadId=u1", key: "a.txt", want: s3Operation{action: "s3:ListMultipartUploadParts", grant: actionList, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodPost, target: "http://s3.example.com/bucket/a.txt?uploads", key: "a.txt", want: s3Operation{action: "s3:PutObject", grant: actionMultipart, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket/a.txt?partNumber=1&uploadId=u1", key: "a.txt", want: s3Operation{action: "s3:PutObject", grant: actionMultipart, bucket: "bucket", key: "a.txt"}},
+		{method: http.MethodDelete, target: "http://s3.example.com/bucket/a.txt?uploadId=u1", key: "a.txt", want: s3Operation{action: "s3:AbortMultipartUpload", grant: actionMultipart, bucket: "bucket", key: "a.txt"}},
+	} {
+		operations, err := requestOperations(httptest.NewRequest(tc.method, tc.target, nil), "bucket", tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(operations) != 1 || operations[0] != tc.want {
+			t.Errorf("%s %s: expected %+v, got %+v", tc.method, tc.target, tc.want, operations)
+		}
+	}
+}
+
+func TestWriteAccessMiddlewareRejectsAnonymousMultipartListing(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		status int
+	}{
+		{target: "http://s3.example.com/bucket/a.txt", status: http.StatusOK},
+		{target: "http://s3.example.com/bucket?uploads", status: http.StatusForbidden},
+		{target: "http://s3.example.com/bucket/a.txt?uploadId=u1", status: http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		req.Header.Set("X-Real-IP", "203.0.113.10")
+		recorder := httptest.NewRecorder()
+
+		writeAccessMiddleware(defaultBucketPolicy([]string{"198.51.100.7"}, nil), nil, nil, "", nil)(newTestContext(recorder, req))
+
+		if recorder.Code != tc.status {
+			t.Errorf("GET %s: expected status %d, got %d", tc.target, tc.status, recorder.Code)
+		}
+	}
+}
+
+func restrictedAuthenticator(credential *proxyCredential) *s3SignatureAuthenticator {
+	credential.AccessKey = "proxy-access"
+	credential.SecretKey = "proxy-secret"
+	auth := newCredentialAuthenticator([]*proxyCredential{credential})
+	auth.now = func() time.Time { return time.Date(2026, 5, 17, 16, 30, 0, 0, time.UTC) }
+	return auth
+}
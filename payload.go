@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+)
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+var errPayloadHashMismatch = &s3RequestError{
+	status:  http.StatusBadRequest,
+	code:    "XAmzContentSHA256Mismatch",
+	message: "The provided 'x-amz-content-sha256' header does not match what was computed.",
+}
+
+func isHexSHA256(value string) bool {
+	if len(value) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+// installPayloadHashReader 让请求体在流式转发给 COS 的同时计算 SHA-256，并与客户端签名的
+// x-amz-content-sha256 比较，整个过程不会把对象缓存在内存中。
+func installPayloadHashReader(r *http.Request, payloadHash string) error {
+	if payloadHash == unsignedPayload {
+		return nil
+	}
+	if !isHexSHA256(payloadHash) {
+		return errInvalidSignature
+	}
+
+	reader := &payloadHashReader{
+		body:      r.Body,
+		hash:      sha256.New(),
+		expected:  payloadHash,
+		remaining: r.ContentLength,
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		reader.body = http.NoBody
+	}
+	if reader.remaining == 0 {
+		if err := reader.verify(); err != nil {
+			return err
+		}
+	}
+	r.Body = reader
+	return nil
+}
+
+// payloadHashReader 在已知 Content-Length 时会扣留最后一段数据，直到确认摘要一致后才交给下游，
+// 这样摘要不匹配时 COS 收到的请求体是不完整的，上传会失败而不会落盘。
+type payloadHashReader struct {
+	body      io.ReadCloser
+	hash      hash.Hash
+	expected  string
+	remaining int64
+
+	verified bool
+	err      error
+}
+
+func (r *payloadHashReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.remaining >= 0 && int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	if len(p) == 0 && r.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if r.remaining < 0 {
+		if err == io.EOF {
+			if verifyErr := r.verify(); verifyErr != nil {
+				return n, verifyErr
+			}
+		}
+		return n, err
+	}
+
+	r.remaining -= int64(n)
+	if r.remaining > 0 {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+	if verifyErr := r.verify(); verifyErr != nil {
+		return 0, verifyErr
+	}
+	return n, nil
+}
+
+func (r *payloadHashReader) verify() error {
+	if hex.EncodeToString(r.hash.Sum(nil)) != r.expected {
+		r.err = errPayloadHashMismatch
+		return r.err
+	}
+	r.verified = true
+	return nil
+}
+
+// VerifyBody 在请求体读取结束后报告摘要是否校验通过，未读取完毕的请求体视为未通过。
+func (r *payloadHashReader) VerifyBody() error {
+	if r.err != nil {
+		return r.err
+	}
+	if !r.verified {
+		return errPayloadHashMismatch
+	}
+	return nil
+}
+
+func (r *payloadHashReader) Close() error {
+	return r.body.Close()
+}
+
+// bufferedPayloadHash 计算请求体的 SHA-256 并把请求体恢复原样。STS 等非 S3 服务的 SigV4 签名总是覆盖实际请求体，
+// 但客户端不会发送 x-amz-content-sha256 头部，这类请求体都很小。
+func bufferedPayloadHash(r *http.Request) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return hexSHA256(""), nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPolicyInspectBodySize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxPolicyInspectBodySize {
+		return "", errors.New("request body is too large")
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return hexSHA256(string(body)), nil
+}
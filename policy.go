@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	policyEffectAllow = "Allow"
+	policyEffectDeny  = "Deny"
+	s3ARNPrefix       = "arn:aws:s3:::"
+)
+
+// policyValues 兼容 IAM 策略中既可以写成单个字符串也可以写成字符串数组的字段。
+type policyValues []string
+
+func (v *policyValues) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*v = policyValues{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return errors.New("expected a string or an array of strings")
+	}
+	*v = multiple
+	return nil
+}
+
+// policyPrincipal 支持 "*" 以及 {"AWS": ["access-key", ...]} 两种写法，AWS 字段中填写代理访问密钥。
+type policyPrincipal struct {
+	AWS policyValues
+}
+
+func (p *policyPrincipal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return fmt.Errorf("unsupported principal %q", wildcard)
+		}
+		p.AWS = policyValues{"*"}
+		return nil
+	}
+	var principal struct {
+		AWS policyValues `json:"AWS"`
+	}
+	if err := json.Unmarshal(data, &principal); err != nil {
+		return err
+	}
+	p.AWS = principal.AWS
+	return nil
+}
+
+func (p policyPrincipal) matches(accessKey string) bool {
+	for _, candidate := range p.AWS {
+		if candidate == "*" || (accessKey != "" && candidate == accessKey) {
+			return true
+		}
+	}
+	return false
+}
+
+type policyStatement struct {
+	Sid       string                             `json:"Sid,omitempty"`
+	Effect    string                             `json:"Effect"`
+	Principal *policyPrincipal                   `json:"Principal"`
+	Action    policyValues                       `json:"Action"`
+	Resource  policyValues                       `json:"Resource"`
+	Condition map[string]map[string]policyValues `json:"Condition,omitempty"`
+}
+
+type policyDocument struct {
+	Version   string            `json:"Version,omitempty"`
+	Statement []policyStatement `json:"Statement"`
+}
+
+// bucketPolicy 按照 IAM 的规则评估请求：显式 Deny 优先，其次需要至少一条 Allow，否则隐式拒绝。
+// dryRun 为 true 时只记录评估结果，不拦截请求。
+type bucketPolicy struct {
+	document *policyDocument
+	dryRun   bool
+	now      func() time.Time
+}
+
+// policyRequest 是一次请求的评估上下文，conditions 中保存可供 Condition 引用的键值，键名为小写。
+type policyRequest struct {
+	accessKey  string
+	operations []s3Operation
+	conditions map[string]string
+}
+
+type policyDecision struct {
+	allowed   bool
+	explicit  bool
+	operation s3Operation
+	reason    string
+}
+
+func newBucketPolicy(document *policyDocument, dryRun bool) (*bucketPolicy, error) {
+	if err := document.validate(); err != nil {
+		return nil, err
+	}
+	return &bucketPolicy{document: document, dryRun: dryRun, now: time.Now}, nil
+}
+
+// loadBucketPolicy 从 JSON 文件中读取策略文档。
+func loadBucketPolicy(path string, dryRun bool) (*bucketPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	var document policyDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	return newBucketPolicy(&document, dryRun)
+}
+
+// defaultBucketPolicy 生成与未配置策略文件时的内置规则等价的策略：
+// 任何人都可以读取和列举对象 (不包括未完成的分片上传)，白名单 IP 和代理访问密钥可以执行所有操作。
+func defaultBucketPolicy(allowedIPs, accessKeys []string) *bucketPolicy {
+	document := &policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{{
+			Sid:       "PublicRead",
+			Effect:    policyEffectAllow,
+			Principal: &policyPrincipal{AWS: policyValues{"*"}},
+			Action:    policyValues{"s3:GetObject", "s3:ListBucket", "s3:GetBucketLocation"},
+			Resource:  policyValues{s3ARNPrefix + "*"},
+		}},
+	}
+	if len(allowedIPs) > 0 {
+		document.Statement = append(document.Statement, policyStatement{
+			Sid:       "WhitelistedIPs",
+			Effect:    policyEffectAllow,
+			Principal: &policyPrincipal{AWS: policyValues{"*"}},
+			Action:    policyValues{"s3:*"},
+			Resource:  policyValues{s3ARNPrefix + "*"},
+			Condition: map[string]map[string]policyValues{
+				"IpAddress": {"aws:SourceIp": allowedIPs},
+			},
+		})
+	}
+	if len(accessKeys) > 0 {
+		document.Statement = append(document.Statement, policyStatement{
+			Sid:       "ProxyAccessKeys",
+			Effect:    policyEffectAllow,
+			Principal: &policyPrincipal{AWS: accessKeys},
+			Action:    policyValues{"s3:*"},
+			Resource:  policyValues{s3ARNPrefix + "*"},
+		})
+	}
+	return &bucketPolicy{document: document, now: time.Now}
+}
+
+func (d *policyDocument) validate() error {
+	if d.Version != "" && d.Version != "2012-10-17" && d.Version != "2008-10-17" {
+		return fmt.Errorf("unsupported policy version %q", d.Version)
+	}
+	if len(d.Statement) == 0 {
+		return errors.New("policy must contain at least one statement")
+	}
+	for i, statement := range d.Statement {
+		name := statement.Sid
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		if statement.Effect != policyEffectAllow && statement.Effect != policyEffectDeny {
+			return fmt.Errorf("statement %s: Effect must be Allow or Deny", name)
+		}
+		if statement.Principal == nil || len(statement.Principal.AWS) == 0 {
+			return fmt.Errorf("statement %s: Principal is required", name)
+		}
+		if len(statement.Action) == 0 || len(statement.Resource) == 0 {
+			return fmt.Errorf("statement %s: Action and Resource are required", name)
+		}
+		for operator, conditions := range statement.Condition {
+			if _, ok := policyConditionOperators[operator]; !ok {
+				return fmt.Errorf("statement %s: unsupported condition operator %s", name, operator)
+			}
+			for key, values := range conditions {
+				if err := validateConditionValues(operator, values); err != nil {
+					return fmt.Errorf("statement %s: condition %s on %s: %w", name, operator, key, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// evaluate 逐个评估请求涉及的操作，任何一个操作被拒绝时整个请求都被拒绝，显式拒绝优先于隐式拒绝报告。
+func (p *bucketPolicy) evaluate(request *policyRequest) policyDecision {
+	if request.conditions == nil {
+		request.conditions = map[string]string{}
+	}
+	if _, ok := request.conditions["aws:currenttime"]; !ok {
+		request.conditions["aws:currenttime"] = p.now().UTC().Format(time.RFC3339)
+	}
+
+	decision := policyDecision{allowed: true, reason: "no operations"}
+	for _, operation := range request.operations {
+		operationDecision := p.evaluateOperation(request, operation)
+		if operationDecision.explicit && !operationDecision.allowed {
+			return operationDecision
+		}
+		if decision.allowed {
+			decision = operationDecision
+		}
+	}
+	return decision
+}
+
+func (p *bucketPolicy) evaluateOperation(request *policyRequest, operation s3Operation) policyDecision {
+	resource := operation.resource()
+	var allowedBy string
+	for i, statement := range p.document.Statement {
+		if !statement.Principal.matches(request.accessKey) ||
+			!matchesAnyPattern(statement.Action, operation.action, true) ||
+			!matchesAnyPattern(statement.Resource, resource, false) ||
+			!statement.conditionsMatch(request.conditions) {
+			continue
+		}
+
+		name := statement.Sid
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		if statement.Effect == policyEffectDeny {
+			return policyDecision{explicit: true, operation: operation, reason: "explicit deny by statement " + name}
+		}
+		if allowedBy == "" {
+			allowedBy = name
+		}
+	}
+	if allowedBy == "" {
+		return policyDecision{operation: operation, reason: "implicit deny"}
+	}
+	return policyDecision{allowed: true, operation: operation, reason: "allowed by statement " + allowedBy}
+}
+
+func matchesAnyPattern(patterns []string, value string, ignoreCase bool) bool {
+	for _, pattern := range patterns {
+		if ignoreCase {
+			if wildcardMatch(strings.ToLower(pattern), strings.ToLower(value)) {
+				return true
+			}
+		} else if wildcardMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch 实现 IAM 的通配符语义：* 匹配任意字符序列 (包括 "/")，? 匹配单个字符。
+func wildcardMatch(pattern, value string) bool {
+	px, vx := 0, 0
+	starPattern, starValue := -1, 0
+	for vx < len(value) {
+		switch {
+		case px < len(pattern) && (pattern[px] == '?' || pattern[px] == value[vx]):
+			px++
+			vx++
+		case px < len(pattern) && pattern[px] == '*':
+			starPattern, starValue = px, vx
+			px++
+		case starPattern >= 0:
+			starValue++
+			px, vx = starPattern+1, starValue
+		default:
+			return false
+		}
+	}
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+	return px == len(pattern)
+}
+
+type policyConditionOperator struct {
+	negated bool
+	match   func(pattern, value string) bool
+}
+
+var policyConditionOperators = map[string]policyConditionOperator{
+	"StringEquals":              {match: func(pattern, value string) bool { return pattern == value }},
+	"StringNotEquals":           {negated: true, match: func(pattern, value string) bool { return pattern == value }},
+	"StringEqualsIgnoreCase":    {match: strings.EqualFold},
+	"StringNotEqualsIgnoreCase": {negated: true, match: strings.EqualFold},
+	"StringLike":                {match: wildcardMatch},
+	"StringNotLike":             {negated: true, match: wildcardMatch},
+	"IpAddress":                 {match: ipConditionMatch},
+	"NotIpAddress":              {negated: true, match: ipConditionMatch},
+	"DateEquals":                {match: dateConditionMatch(func(c int) bool { return c == 0 })},
+	"DateNotEquals":             {negated: true, match: dateConditionMatch(func(c int) bool { return c == 0 })},
+	"DateLessThan":              {match: dateConditionMatch(func(c int) bool { return c < 0 })},
+	"DateLessThanEquals":        {match: dateConditionMatch(func(c int) bool { return c <= 0 })},
+	"DateGreaterThan":           {match: dateConditionMatch(func(c int) bool { return c > 0 })},
+	"DateGreaterThanEquals":     {match: dateConditionMatch(func(c int) bool { return c >= 0 })},
+	"Bool":                      {match: strings.EqualFold},
+}
+
+// conditionsMatch 要求所有条件运算符和条件键都满足，同一条件键的多个取值之间是"或"的关系。
+// 请求中不存在的条件键对肯定运算符视为不满足，对否定运算符视为满足。
+func (s policyStatement) conditionsMatch(conditions map[string]string) bool {
+	for operatorName, keys := range s.Condition {
+		operator := policyConditionOperators[operatorName]
+		for key, patterns := range keys {
+			value, ok := conditions[strings.ToLower(key)]
+			if !ok {
+				if operator.negated {
+					continue
+				}
+				return false
+			}
+			matched := false
+			for _, pattern := range patterns {
+				if operator.match(pattern, value) {
+					matched = true
+					break
+				}
+			}
+			if matched == operator.negated {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validateConditionValues(operator string, values policyValues) error {
+	for _, value := range values {
+		switch {
+		case strings.HasSuffix(operator, "IpAddress"):
+			if parsePolicyNetwork(value) == nil {
+				return fmt.Errorf("invalid IP address or CIDR %q", value)
+			}
+		case strings.HasPrefix(operator, "Date"):
+			if _, err := parsePolicyDate(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func ipConditionMatch(pattern, value string) bool {
+	network := parsePolicyNetwork(pattern)
+	ip := net.ParseIP(value)
+	return network != nil && ip != nil && network.Contains(ip)
+}
+
+func parsePolicyNetwork(value string) *net.IPNet {
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return network
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func dateConditionMatch(compare func(int) bool) func(pattern, value string) bool {
+	return func(pattern, value string) bool {
+		limit, err := parsePolicyDate(pattern)
+		if err != nil {
+			return false
+		}
+		current, err := parsePolicyDate(value)
+		if err != nil {
+			return false
+		}
+		return compare(current.Compare(limit))
+	}
+}
+
+// parsePolicyDate 支持 RFC 3339 时间、纯日期以及 Unix 时间戳 (秒)。
+func parsePolicyDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
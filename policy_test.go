@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testPolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [
+		{"Sid": "PublicRead", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/public/*"},
+		{"Sid": "OfficeUpload", "Effect": "Allow", "Principal": "*", "Action": ["s3:PutObject"], "Resource": "arn:aws:s3:::bucket/*",
+			"Condition": {"IpAddress": {"aws:SourceIp": ["10.0.0.0/8"]}, "DateLessThan": {"aws:CurrentTime": "2027-01-01T00:00:00Z"}}},
+		{"Sid": "TeamList", "Effect": "Allow", "Principal": {"AWS": "team-a"}, "Action": "s3:ListBucket", "Resource": "arn:aws:s3:::bucket",
+			"Condition": {"StringLike": {"s3:prefix": ["team-a/*"]}}},
+		{"Sid": "TeamWrite", "Effect": "Allow", "Principal": {"AWS": ["team-a"]}, "Action": "s3:*", "Resource": "arn:aws:s3:::bucket/team-a/*"},
+		{"Sid": "ProtectArchive", "Effect": "Deny", "Principal": "*", "Action": ["s3:PutObject", "s3:DeleteObject"], "Resource": "arn:aws:s3:::bucket/team-a/archive/*"}
+	]
+}`
+
+func TestBucketPolicyEvaluate(t *testing.T) {
+	policy := testBucketPolicy(t)
+
+	for _, tc := range []struct {
+		name       string
+		accessKey  string
+		operation  s3Operation
+		conditions map[string]string
+		allowed    bool
+		explicit   bool
+	}{
+		{name: "anonymous public read", operation: s3Operation{action: "s3:GetObject", bucket: "bucket", key: "public/a.png"}, allowed: true},
+		{name: "anonymous private read", operation: s3Operation{action: "s3:GetObject", bucket: "bucket", key: "private/a.png"}},
+		{name: "office upload", operation: s3Operation{action: "s3:PutObject", bucket: "bucket", key: "x"}, conditions: map[string]string{"aws:sourceip": "10.1.2.3"}, allowed: true},
+		{name: "upload outside office", operation: s3Operation{action: "s3:PutObject", bucket: "bucket", key: "x"}, conditions: map[string]string{"aws:sourceip": "203.0.113.10"}},
+		{name: "upload after expiry", operation: s3Operation{action: "s3:PutObject", bucket: "bucket", key: "x"}, conditions: map[string]string{"aws:sourceip": "10.1.2.3", "aws:currenttime": "2027-02-01T00:00:00Z"}},
+		{name: "team list own prefix", accessKey: "team-a", operation: s3Operation{action: "s3:ListBucket", bucket: "bucket"}, conditions: map[string]string{"s3:prefix": "team-a/reports"}, allowed: true},
+		{name: "team list other prefix", accessKey: "team-a", operation: s3Operation{action: "s3:ListBucket", bucket: "bucket"}, conditions: map[string]string{"s3:prefix": "team-b/"}},
+		{name: "team delete", accessKey: "team-a", operation: s3Operation{action: "s3:DeleteObject", bucket: "bucket", key: "team-a/tmp.txt"}, allowed: true},
+		{name: "explicit deny wins", accessKey: "team-a", operation: s3Operation{action: "s3:PutObject", bucket: "bucket", key: "team-a/archive/2025.tar"}, explicit: true},
+		{name: "anonymous team write", operation: s3Operation{action: "s3:PutObject", bucket: "bucket", key: "team-a/x"}, conditions: map[string]string{"aws:sourceip": "203.0.113.10"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			decision := policy.evaluate(&policyRequest{
+				accessKey:  tc.accessKey,
+				operations: []s3Operation{tc.operation},
+				conditions: tc.conditions,
+			})
+			if decision.allowed != tc.allowed || decision.explicit != tc.explicit {
+				t.Fatalf("expected allowed=%t explicit=%t, got %+v", tc.allowed, tc.explicit, decision)
+			}
+		})
+	}
+}
+
+func TestBucketPolicyExplicitDenyAcrossOperations(t *testing.T) {
+	policy := testBucketPolicy(t)
+
+	decision := policy.evaluate(&policyRequest{
+		accessKey: "team-a",
+		operations: []s3Operation{
+			{action: "s3:DeleteObject", bucket: "bucket", key: "private/a.txt"},
+			{action: "s3:DeleteObject", bucket: "bucket", key: "team-a/archive/a.txt"},
+		},
+	})
+	if decision.allowed || !decision.explicit {
+		t.Fatalf("expected explicit deny to be reported, got %+v", decision)
+	}
+}
+
+func TestPolicyDocumentValidate(t *testing.T) {
+	for name, content := range map[string]string{
+		"bad effect":         `{"Statement": [{"Effect": "Maybe", "Principal": "*", "Action": "s3:*", "Resource": "*"}]}`,
+		"missing principal":  `{"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "*"}]}`,
+		"unknown operator":   `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "*", "Condition": {"NumericLessThan": {"s3:max-keys": "10"}}}]}`,
+		"invalid ip address": `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "*", "Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/33"}}}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var document policyDocument
+			if err := json.Unmarshal([]byte(content), &document); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := newBucketPolicy(&document, false); err == nil {
+				t.Fatal("expected invalid policy to be rejected")
+			}
+		})
+	}
+}
+
+func TestWriteAccessMiddlewarePolicyDryRun(t *testing.T) {
+	policy := testBucketPolicy(t)
+	policy.dryRun = true
+	req := httptest.NewRequest(http.MethodDelete, "http://s3.example.com/bucket/private/a.txt", nil)
+	req.Header.Set("X-Real-IP", "203.0.113.10")
+	recorder := httptest.NewRecorder()
+
+	writeAccessMiddleware(policy, testAuthenticator(), nil, "", nil)(newTestContext(recorder, req))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected dry-run to let the request through, got status %d", recorder.Code)
+	}
+}
+
+func TestWriteAccessMiddlewareAllowsWhitelistedIPByDefault(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "http://s3.example.com/bucket/private/a.txt", nil)
+	req.Header.Set("X-Real-IP", "198.51.100.7")
+	recorder := httptest.NewRecorder()
+
+	writeAccessMiddleware(defaultBucketPolicy([]string{"198.51.100.7"}, nil), nil, nil, "", nil)(newTestContext(recorder, req))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected whitelisted IP to be allowed, got status %d", recorder.Code)
+	}
+}
+
+func testBucketPolicy(t *testing.T) *bucketPolicy {
+	t.Helper()
+
+	var document policyDocument
+	if err := json.Unmarshal([]byte(testPolicy), &document); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := newBucketPolicy(&document, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.now = func() time.Time { return time.Date(2026, 5, 17, 16, 30, 0, 0, time.UTC) }
+	return policy
+}
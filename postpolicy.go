@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxPostFormMemory = 32 << 20
+
+// defaultMaxPostFormSize 是表单上传请求体的默认大小上限，与 S3 POST Object 允许的最大对象一致。
+const defaultMaxPostFormSize = 5 << 30
+
+// maxPostFormFieldsSize 限制 file 字段之前的普通字段的总大小，S3 的 POST policy 文档最大只有 20KB。
+const maxPostFormFieldsSize = 1 << 20
+
+var (
+	errPostPolicyExpired    = errors.New("invalid according to policy: policy expired")
+	errPostPolicyMalformed  = errors.New("invalid POST policy document")
+	errPostPolicyFileAbsent = errors.New("POST policy upload requires exactly one 'file' field")
+	errPostFormFieldsLarge  = errors.New("form fields before the 'file' field are too large")
+)
+
+// postPolicy 是浏览器表单上传中 base64 编码的策略文档。
+type postPolicy struct {
+	expiration time.Time
+	conditions []postPolicyCondition
+}
+
+// postPolicyCondition 对应策略中的一条条件：eq、starts-with 作用于表单字段，
+// content-length-range 作用于上传文件的大小。
+type postPolicyCondition struct {
+	operator string
+	field    string
+	value    string
+	min, max int64
+}
+
+func isPostPolicyUpload(r *http.Request) bool {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return false
+	}
+	query := r.URL.Query()
+	return !query.Has("delete") && !query.Has("uploads") && !query.Has("uploadId")
+}
+
+// AuthenticatePostPolicy 校验表单上传中的 policy、x-amz-credential 和 x-amz-signature 字段，
+// 并检查策略的过期时间和全部条件。表单中没有策略字段时返回 errMissingSignature。
+// 签名只依赖 file 之前的字段，校验通过后才会接收文件内容并检查 content-length-range 等条件。
+func (a *s3SignatureAuthenticator) AuthenticatePostPolicy(r *http.Request, bucket string) (*proxyCredential, error) {
+	if a == nil {
+		return nil, errMissingSignature
+	}
+	head, err := readPostFormHead(r)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPolicy, signature := head.fields["policy"], head.fields["x-amz-signature"]
+	if encodedPolicy == "" || signature == "" {
+		return nil, errMissingSignature
+	}
+	if head.fields["x-amz-algorithm"] != awsSigV4Algorithm {
+		return nil, errInvalidSignature
+	}
+	credentialValue, err := parseCredential(head.fields["x-amz-credential"])
+	if err != nil {
+		return nil, err
+	}
+	credential, err := a.resolve(credentialValue.accessKey, head.fields["x-amz-security-token"])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseAmzDate(head.fields["x-amz-date"]); err != nil {
+		return nil, err
+	}
+	expected := hex.EncodeToString(hmacSHA256(credential.signingKey(credentialValue.scope), encodedPolicy))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		return nil, errInvalidSignature
+	}
+
+	policy, err := parsePostPolicy(encodedPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if !a.now().Before(policy.expiration) {
+		return nil, errPostPolicyExpired
+	}
+
+	if err := r.ParseMultipartForm(maxPostFormMemory); err != nil {
+		return nil, err
+	}
+	fields := postPolicyFields(r.MultipartForm)
+	files := r.MultipartForm.File["file"]
+	if len(files) != 1 {
+		return nil, errPostPolicyFileAbsent
+	}
+	// 条件针对的是最终生效的值：替换 ${filename} 后的 key、请求路径中的存储桶以及实际使用的 Content-Type
+	effective := make(map[string]string, len(fields)+2)
+	for name, value := range fields {
+		effective[name] = value
+	}
+	effective["key"] = strings.ReplaceAll(fields["key"], "${filename}", files[0].Filename)
+	effective["bucket"] = bucket
+	if effective["content-type"] == "" {
+		effective["content-type"] = files[0].Header.Get("Content-Type")
+	}
+	if err := policy.check(fields, effective, files[0].Size); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// postFormHead 是表单上传中位于 file 字段之前的普通字段 (字段名小写) 和上传文件名。
+type postFormHead struct {
+	fields   map[string]string
+	filename string
+}
+
+// readPostFormHead 读取 file 字段之前的表单字段，不读取文件内容。S3 要求 file 是表单中的最后一个字段，
+// 准入中间件因此可以在接收文件之前完成签名校验和授权。读取过的数据会放回请求体，控制器仍可解析完整的表单。
+func readPostFormHead(r *http.Request) (*postFormHead, error) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, http.ErrNotMultipart
+	}
+
+	body := r.Body
+	var consumed bytes.Buffer
+	reader := multipart.NewReader(io.TeeReader(io.LimitReader(body, maxPostFormFieldsSize), &consumed), params["boundary"])
+	defer func() { r.Body = &replayedBody{Reader: io.MultiReader(&consumed, body), body: body} }()
+
+	head := &postFormHead{fields: map[string]string{}}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return head, nil
+		}
+		if err != nil {
+			if consumed.Len() >= maxPostFormFieldsSize {
+				return nil, errPostFormFieldsLarge
+			}
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			head.filename = part.FileName()
+			return head, nil
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			if consumed.Len() >= maxPostFormFieldsSize {
+				return nil, errPostFormFieldsLarge
+			}
+			return nil, err
+		}
+		name := strings.ToLower(part.FormName())
+		if _, ok := head.fields[name]; !ok {
+			head.fields[name] = string(value)
+		}
+	}
+}
+
+// replayedBody 先返回预读的数据，再继续读取原始请求体，原始请求体的摘要校验 (VerifyBody) 保持可用。
+type replayedBody struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+func (b *replayedBody) Close() error {
+	return b.body.Close()
+}
+
+func (b *replayedBody) VerifyBody() error {
+	if verifier, ok := b.body.(interface{ VerifyBody() error }); ok {
+		return verifier.VerifyBody()
+	}
+	return nil
+}
+
+// postFormSizeMiddleware 限制表单上传请求体的大小，未签名的请求同样会在授权之前解析表单字段，
+// 不加限制时任何人都可以让代理缓存大量数据并写满临时文件所在的磁盘。
+func postFormSizeMiddleware(maxSize int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isPostPolicyUpload(c.Request) {
+			if c.Request.ContentLength > maxSize {
+				log.Printf("Rejected: form upload of %d bytes from IP %s exceeds the %d-byte limit.", c.Request.ContentLength, c.ClientIP(), maxSize)
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "EntityTooLarge: your proposed upload exceeds the maximum allowed size"})
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+		}
+		c.Next()
+	}
+}
+
+// postPolicyFields 返回字段名小写后的表单字段，S3 的表单字段名不区分大小写。
+func postPolicyFields(form *multipart.Form) map[string]string {
+	fields := make(map[string]string, len(form.Value))
+	for name, values := range form.Value {
+		if len(values) > 0 {
+			fields[strings.ToLower(name)] = values[0]
+		}
+	}
+	return fields
+}
+
+func parsePostPolicy(encoded string) (*postPolicy, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errPostPolicyMalformed
+	}
+	var document struct {
+		Expiration string            `json:"expiration"`
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, errPostPolicyMalformed
+	}
+	expiration, err := time.Parse(time.RFC3339, document.Expiration)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid expiration", errPostPolicyMalformed)
+	}
+
+	policy := &postPolicy{expiration: expiration}
+	for _, raw := range document.Conditions {
+		var exact map[string]string
+		if err := json.Unmarshal(raw, &exact); err == nil {
+			for field, value := range exact {
+				policy.conditions = append(policy.conditions, postPolicyCondition{operator: "eq", field: strings.ToLower(field), value: value})
+			}
+			continue
+		}
+
+		var tuple []json.RawMessage
+		if err := json.Unmarshal(raw, &tuple); err != nil || len(tuple) != 3 {
+			return nil, errPostPolicyMalformed
+		}
+		var operator string
+		if err := json.Unmarshal(tuple[0], &operator); err != nil {
+			return nil, errPostPolicyMalformed
+		}
+		condition := postPolicyCondition{operator: strings.ToLower(operator)}
+		switch condition.operator {
+		case "eq", "starts-with":
+			var field string
+			if json.Unmarshal(tuple[1], &field) != nil || json.Unmarshal(tuple[2], &condition.value) != nil || !strings.HasPrefix(field, "$") {
+				return nil, errPostPolicyMalformed
+			}
+			condition.field = strings.ToLower(strings.TrimPrefix(field, "$"))
+		case "content-length-range":
+			if json.Unmarshal(tuple[1], &condition.min) != nil || json.Unmarshal(tuple[2], &condition.max) != nil || condition.min > condition.max {
+				return nil, errPostPolicyMalformed
+			}
+		default:
+			return nil, fmt.Errorf("%w: unsupported condition %q", errPostPolicyMalformed, operator)
+		}
+		policy.conditions = append(policy.conditions, condition)
+	}
+	return policy, nil
+}
+
+// check 使用 effective 中的值检查全部条件。与 S3 一致，除签名、文件、策略本身以及
+// x-ignore- 前缀的字段外，submitted 中的每个表单字段都必须出现在条件中。
+func (p *postPolicy) check(submitted, effective map[string]string, size int64) error {
+	covered := map[string]bool{}
+	for _, condition := range p.conditions {
+		switch condition.operator {
+		case "eq":
+			if effective[condition.field] != condition.value {
+				return fmt.Errorf("invalid according to policy: condition failed: [\"eq\", \"$%s\", %q]", condition.field, condition.value)
+			}
+		case "starts-with":
+			if !strings.HasPrefix(effective[condition.field], condition.value) {
+				return fmt.Errorf("invalid according to policy: condition failed: [\"starts-with\", \"$%s\", %q]", condition.field, condition.value)
+			}
+		case "content-length-range":
+			if size < condition.min || size > condition.max {
+				return fmt.Errorf("invalid according to policy: content length %d is outside [%d, %d]", size, condition.min, condition.max)
+			}
+		}
+		covered[condition.field] = true
+	}
+
+	for field := range submitted {
+		if covered[field] || field == "policy" || field == "x-amz-signature" || strings.HasPrefix(field, "x-ignore-") {
+			continue
+		}
+		return fmt.Errorf("invalid according to policy: extra input field: %s", field)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthenticatePostPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		expiration string
+		key        string
+		content    string
+		extra      map[string]string
+		wantErr    bool
+	}{
+		{name: "valid", expiration: "2026-05-17T17:00:00Z", key: "uploads/${filename}", content: "hello"},
+		{name: "expired", expiration: "2026-05-17T16:00:00Z", key: "uploads/${filename}", content: "hello", wantErr: true},
+		{name: "key outside prefix", expiration: "2026-05-17T17:00:00Z", key: "private/${filename}", content: "hello", wantErr: true},
+		{name: "file too large", expiration: "2026-05-17T17:00:00Z", key: "uploads/${filename}", content: strings.Repeat("x", 1025), wantErr: true},
+		{name: "extra field", expiration: "2026-05-17T17:00:00Z", key: "uploads/${filename}", content: "hello", extra: map[string]string{"x-amz-meta-owner": "eve"}, wantErr: true},
+		{name: "ignored field", expiration: "2026-05-17T17:00:00Z", key: "uploads/${filename}", content: "hello", extra: map[string]string{"x-ignore-tracking": "1"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := testAuthenticator()
+			req := newPostPolicyRequest(t, auth, tc.expiration, tc.key, tc.content, tc.extra, false)
+
+			credential, err := auth.AuthenticatePostPolicy(req, "bucket")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected POST policy to be rejected")
+				}
+				return
+			}
+			if err != nil || credential.AccessKey != "proxy-access" {
+				t.Fatalf("expected valid POST policy, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticatePostPolicyRejectsTamperedSignature(t *testing.T) {
+	auth := testAuthenticator()
+	req := newPostPolicyRequest(t, auth, "2026-05-17T17:00:00Z", "uploads/${filename}", "hello", nil, true)
+
+	if _, err := auth.AuthenticatePostPolicy(req, "bucket"); err != errInvalidSignature {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+}
+
+func TestWriteAccessMiddlewareAllowsPostPolicyUpload(t *testing.T) {
+	auth := testAuthenticator()
+	req := newPostPolicyRequest(t, auth, "2026-05-17T17:00:00Z", "uploads/${filename}", "hello", nil, false)
+	req.Header.Set("X-Real-IP", "203.0.113.10")
+	recorder := httptest.NewRecorder()
+
+	writeAccessMiddleware(defaultBucketPolicy(nil, []string{"proxy-access"}), auth, nil, "", nil)(newTestContext(recorder, req))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected signed form upload to be allowed, got status %d", recorder.Code)
+	}
+}
+
+func TestWriteAccessMiddlewareAuthorizesFormUploadBeforeReadingFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		name   string
+		ip     string
+		status int
+	}{
+		{name: "anonymous outside whitelist", ip: "203.0.113.10", status: http.StatusForbidden},
+		{name: "whitelisted", ip: "198.51.100.7", status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var fileContent string
+			router := gin.New()
+			router.Use(postFormSizeMiddleware(defaultMaxPostFormSize))
+			router.Use(writeAccessMiddleware(defaultBucketPolicy([]string{"198.51.100.7"}, nil), testAuthenticator(), nil, "", nil))
+			router.POST("/*path", func(c *gin.Context) {
+				form, err := c.MultipartForm()
+				if err != nil {
+					t.Fatal(err)
+				}
+				file, _ := form.File["file"][0].Open()
+				content, _ := io.ReadAll(file)
+				fileContent = string(content)
+				c.Status(http.StatusOK)
+			})
+
+			file := &countingReader{Reader: strings.NewReader(strings.Repeat("x", 4<<20))}
+			req := newStreamingFormRequest(t, map[string]string{"key": "uploads/${filename}"}, file)
+			req.Header.Set("X-Real-IP", tc.ip)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, recorder.Code)
+			}
+			switch {
+			case tc.status == http.StatusForbidden && file.n > 64<<10:
+				t.Fatalf("expected the file to stay unread before authorization, read %d bytes", file.n)
+			case tc.status == http.StatusOK && fileContent != strings.Repeat("x", 4<<20):
+				t.Fatalf("expected the full file to reach the controller, got %d bytes", len(fileContent))
+			}
+		})
+	}
+}
+
+func TestPostFormSizeMiddlewareLimitsBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		name          string
+		contentLength bool
+		status        int
+	}{
+		{name: "declared length", contentLength: true, status: http.StatusRequestEntityTooLarge},
+		{name: "unknown length", status: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(postFormSizeMiddleware(1024))
+			router.POST("/*path", func(c *gin.Context) {
+				if _, err := c.MultipartForm(); err != nil {
+					c.Status(http.StatusBadRequest)
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := newStreamingFormRequest(t, map[string]string{"key": "a.txt"}, strings.NewReader(strings.Repeat("x", 4096)))
+			if tc.contentLength {
+				body, _ := io.ReadAll(req.Body)
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				req.ContentLength = int64(len(body))
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, recorder.Code)
+			}
+		})
+	}
+}
+
+// countingReader 记录已经被读取的字节数。
+type countingReader struct {
+	io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+// newStreamingFormRequest 构造长度未知的表单上传请求，file 字段的内容从 file 中按需读取。
+func newStreamingFormRequest(t *testing.T, fields map[string]string, file io.Reader) *http.Request {
+	t.Helper()
+
+	var head bytes.Buffer
+	writer := multipart.NewWriter(&head)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := writer.CreateFormFile("file", "photo.png"); err != nil {
+		t.Fatal(err)
+	}
+	tail := "\r\n--" + writer.Boundary() + "--\r\n"
+
+	req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/bucket", io.MultiReader(&head, file, strings.NewReader(tail)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func newPostPolicyRequest(t *testing.T, auth *s3SignatureAuthenticator, expiration, key, content string, extra map[string]string, tamper bool) *http.Request {
+	t.Helper()
+
+	credential := "proxy-access/20260517/us-east-1/s3/aws4_request"
+	policy := base64.StdEncoding.EncodeToString([]byte(`{
+		"expiration": "` + expiration + `",
+		"conditions": [
+			{"bucket": "bucket"},
+			["starts-with", "$key", "uploads/"],
+			["content-length-range", 1, 1024],
+			{"success_action_status": "201"},
+			{"x-amz-algorithm": "AWS4-HMAC-SHA256"},
+			{"x-amz-credential": "` + credential + `"},
+			{"x-amz-date": "20260517T163000Z"}
+		]
+	}`))
+	signingKey := auth.credentials["proxy-access"].signingKey("20260517/us-east-1/s3/aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, policy))
+	if tamper {
+		signature = strings.Repeat("0", len(signature))
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"key":                   key,
+		"policy":                policy,
+		"success_action_status": "201",
+		"X-Amz-Algorithm":       "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":      credential,
+		"X-Amz-Date":            "20260517T163000Z",
+		"X-Amz-Signature":       signature,
+	}
+	for name, value := range extra {
+		fields[name] = value
+	}
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file, err := writer.CreateFormFile("file", "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/bucket", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
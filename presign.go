@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	presignRegion     = "us-east-1"
+	presignService    = "s3"
+	presignDateFormat = "20060102T150405Z"
+)
+
+var errInvalidPresignRequest = errors.New("invalid presign request")
+
+// presignOptions 描述需要生成的预签名 URL。UploadID 和 PartNumber 同时设置时生成 UploadPart 的 URL。
+type presignOptions struct {
+	Method        string `json:"method"`
+	Bucket        string `json:"bucket"`
+	Key           string `json:"key"`
+	ExpiresIn     int64  `json:"expires_in"`
+	ContentType   string `json:"content_type,omitempty"`
+	ContentMD5    string `json:"content_md5,omitempty"`
+	UploadID      string `json:"upload_id,omitempty"`
+	PartNumber    int    `json:"part_number,omitempty"`
+	VirtualHosted bool   `json:"virtual_hosted,omitempty"`
+	AccessKey     string `json:"access_key,omitempty"`
+}
+
+// presignedURL 是生成结果，Headers 是客户端发送请求时必须携带的已签名头部。
+type presignedURL struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+func (o *presignOptions) validate() error {
+	o.Method = strings.ToUpper(o.Method)
+	switch o.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return fmt.Errorf("%w: unsupported method %q", errInvalidPresignRequest, o.Method)
+	}
+	if o.Bucket == "" || o.Key == "" {
+		return fmt.Errorf("%w: bucket and key are required", errInvalidPresignRequest)
+	}
+	expires := time.Duration(o.ExpiresIn) * time.Second
+	if expires <= 0 || expires > maxPresignExpiry {
+		return fmt.Errorf("%w: expires_in must be between 1 and %d seconds", errInvalidPresignRequest, int64(maxPresignExpiry/time.Second))
+	}
+	if (o.UploadID == "") != (o.PartNumber == 0) {
+		return fmt.Errorf("%w: upload_id and part_number must be set together", errInvalidPresignRequest)
+	}
+	if o.UploadID != "" && (o.Method != http.MethodPut || o.PartNumber < 1 || o.PartNumber > 10000) {
+		return fmt.Errorf("%w: UploadPart requires method PUT and a part_number between 1 and 10000", errInvalidPresignRequest)
+	}
+	return nil
+}
+
+// presign 使用与 verifyPresignedURL 相同的规范化代码生成预签名 URL，保证生成的 URL 一定能通过校验。
+func (c *proxyCredential) presign(endpoint *url.URL, opts presignOptions, now time.Time) (*presignedURL, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	target := &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host}
+	basePath := strings.TrimSuffix(endpoint.Path, "/")
+	if opts.VirtualHosted {
+		target.Host = opts.Bucket + "." + endpoint.Host
+		target.Path = basePath + "/" + opts.Key
+	} else {
+		target.Path = basePath + "/" + opts.Bucket + "/" + opts.Key
+	}
+
+	headers := map[string]string{}
+	if opts.ContentType != "" {
+		headers["Content-Type"] = opts.ContentType
+	}
+	if opts.ContentMD5 != "" {
+		headers["Content-Md5"] = opts.ContentMD5
+	}
+	signedHeaders := []string{"host"}
+	for name := range headers {
+		signedHeaders = append(signedHeaders, strings.ToLower(name))
+	}
+	sort.Strings(signedHeaders)
+
+	amzDate := now.UTC().Format(presignDateFormat)
+	scope := strings.Join([]string{amzDate[:8], presignRegion, presignService, awsSigV4Request}, "/")
+	query := url.Values{}
+	if opts.UploadID != "" {
+		query.Set("partNumber", strconv.Itoa(opts.PartNumber))
+		query.Set("uploadId", opts.UploadID)
+	}
+	query.Set("X-Amz-Algorithm", awsSigV4Algorithm)
+	query.Set("X-Amz-Credential", c.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.FormatInt(opts.ExpiresIn, 10))
+	query.Set("X-Amz-SignedHeaders", strings.Join(signedHeaders, ";"))
+	target.RawQuery = query.Encode()
+
+	r, err := http.NewRequest(opts.Method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	canonicalRequest, err := buildCanonicalRequest(r, signedHeaders, "X-Amz-Signature", unsignedPayload)
+	if err != nil {
+		return nil, err
+	}
+	query.Set("X-Amz-Signature", c.signature(amzDate, scope, canonicalRequest))
+	target.RawQuery = query.Encode()
+
+	result := &presignedURL{
+		URL:       target.String(),
+		Method:    opts.Method,
+		ExpiresAt: now.UTC().Add(time.Duration(opts.ExpiresIn) * time.Second),
+	}
+	if len(headers) > 0 {
+		result.Headers = headers
+	}
+	return result, nil
+}
+
+// runPresignCommand 实现 `cos-proxy presign` 子命令，密钥从 PROXY_ACCESS_KEY/PROXY_SECRET_KEY 环境变量读取，
+// 避免在命令行参数中暴露 Secret Key。
+func runPresignCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("presign", flag.ContinueOnError)
+	endpoint := flags.String("endpoint", os.Getenv("PUBLIC_ENDPOINT"), "proxy endpoint clients use, e.g. https://proxy.example.com")
+	opts := presignOptions{}
+	flags.StringVar(&opts.Method, "method", http.MethodGet, "HTTP method: GET, HEAD, PUT or DELETE")
+	flags.StringVar(&opts.Bucket, "bucket", "", "bucket name")
+	flags.StringVar(&opts.Key, "key", "", "object key")
+	expires := flags.Duration("expires", time.Hour, "validity period, at most 168h")
+	flags.StringVar(&opts.ContentType, "content-type", "", "require this Content-Type header")
+	flags.StringVar(&opts.ContentMD5, "content-md5", "", "require this Content-MD5 header")
+	flags.StringVar(&opts.UploadID, "upload-id", "", "multipart upload ID (UploadPart)")
+	flags.IntVar(&opts.PartNumber, "part-number", 0, "part number (UploadPart)")
+	flags.BoolVar(&opts.VirtualHosted, "virtual-hosted", false, "use bucket.endpoint-host instead of endpoint/bucket")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	opts.ExpiresIn = int64(*expires / time.Second)
+
+	accessKey, secretKey := os.Getenv("PROXY_ACCESS_KEY"), os.Getenv("PROXY_SECRET_KEY")
+	if accessKey == "" || secretKey == "" {
+		return errors.New("PROXY_ACCESS_KEY and PROXY_SECRET_KEY must be set")
+	}
+	endpointURL, err := url.Parse(*endpoint)
+	if err != nil || endpointURL.Scheme == "" || endpointURL.Host == "" {
+		return fmt.Errorf("invalid -endpoint %q", *endpoint)
+	}
+
+	credential := &proxyCredential{AccessKey: accessKey, SecretKey: secretKey}
+	result, err := credential.presign(endpointURL, opts, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, result.URL)
+	for name, value := range result.Headers {
+		fmt.Fprintf(stdout, "%s: %s\n", name, value)
+	}
+	return nil
+}
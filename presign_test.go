@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresignedURLVerifies(t *testing.T) {
+	endpoint, _ := url.Parse("https://proxy.example.com")
+	for _, tc := range []struct {
+		name string
+		opts presignOptions
+	}{
+		{name: "get", opts: presignOptions{Method: "get", Bucket: "bucket", Key: "dir/a b.txt", ExpiresIn: 3600}},
+		{name: "put with content constraints", opts: presignOptions{Method: "PUT", Bucket: "bucket", Key: "a.txt", ExpiresIn: 600, ContentType: "text/plain", ContentMD5: "XUFAKrxLKna5cZ2REBfFkg=="}},
+		{name: "delete virtual hosted", opts: presignOptions{Method: "DELETE", Bucket: "bucket", Key: "a.txt", ExpiresIn: 60, VirtualHosted: true}},
+		{name: "upload part", opts: presignOptions{Method: "PUT", Bucket: "bucket", Key: "big.bin", ExpiresIn: 600, UploadID: "upload-1", PartNumber: 3}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := testAuthenticator()
+			result, err := auth.credentials["proxy-access"].presign(endpoint, tc.opts, auth.now())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(result.Method, result.URL, nil)
+			for name, value := range result.Headers {
+				req.Header.Set(name, value)
+			}
+			if err := auth.Verify(req); err != nil {
+				t.Fatalf("expected presigned URL %s to verify, got %v", result.URL, err)
+			}
+
+			if tc.opts.ContentType != "" {
+				req.Header.Set("Content-Type", "application/octet-stream")
+				if err := auth.Verify(req); err == nil {
+					t.Fatal("expected a different Content-Type to be rejected")
+				}
+			}
+		})
+	}
+}
+
+func TestPresignRejectsInvalidOptions(t *testing.T) {
+	endpoint, _ := url.Parse("https://proxy.example.com")
+	credential := testAuthenticator().credentials["proxy-access"]
+	for name, opts := range map[string]presignOptions{
+		"expiry too long":     {Method: "GET", Bucket: "bucket", Key: "a.txt", ExpiresIn: int64((maxPresignExpiry + time.Second) / time.Second)},
+		"zero expiry":         {Method: "GET", Bucket: "bucket", Key: "a.txt"},
+		"unsupported method":  {Method: "POST", Bucket: "bucket", Key: "a.txt", ExpiresIn: 60},
+		"missing key":         {Method: "GET", Bucket: "bucket", ExpiresIn: 60},
+		"part without upload": {Method: "PUT", Bucket: "bucket", Key: "a.txt", ExpiresIn: 60, PartNumber: 1},
+		"upload part via GET": {Method: "GET", Bucket: "bucket", Key: "a.txt", ExpiresIn: 60, UploadID: "u", PartNumber: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := credential.presign(endpoint, opts, time.Now()); err == nil {
+				t.Fatal("expected presign options to be rejected")
+			}
+		})
+	}
+}
+
+func TestAdminPresignEndpoint(t *testing.T) {
+	endpoint, _ := url.Parse("https://proxy.example.com")
+	body := `{"method": "GET", "bucket": "bucket", "key": "a.txt", "expires_in": 300}`
+
+	t.Run("admin key", func(t *testing.T) {
+		auth := testAuthenticator()
+		req := newSignedRequest(t, auth, http.MethodPost, "http://s3.example.com/-/presign", body)
+		recorder := httptest.NewRecorder()
+		adminMiddleware(auth, endpoint)(newTestContext(recorder, req))
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected presign to succeed, got status %d: %s", recorder.Code, recorder.Body)
+		}
+		var result presignedURL
+		if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(result.URL, "https://proxy.example.com/bucket/a.txt?") {
+			t.Fatalf("expected URL on the public endpoint, got %s", result.URL)
+		}
+		if err := auth.Verify(httptest.NewRequest(http.MethodGet, result.URL, nil)); err != nil {
+			t.Fatalf("expected issued URL to verify, got %v", err)
+		}
+	})
+
+	t.Run("non-admin key", func(t *testing.T) {
+		auth := restrictedAuthenticator(&proxyCredential{Actions: []string{"*"}})
+		req := newSignedRequest(t, auth, http.MethodPost, "http://s3.example.com/-/presign", body)
+		recorder := httptest.NewRecorder()
+		adminMiddleware(auth, endpoint)(newTestContext(recorder, req))
+
+		if recorder.Code != http.StatusForbidden {
+			t.Fatalf("expected non-admin key to be rejected, got status %d", recorder.Code)
+		}
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/-/presign", bytes.NewBufferString(body))
+		recorder := httptest.NewRecorder()
+		adminMiddleware(testAuthenticator(), endpoint)(newTestContext(recorder, req))
+
+		if recorder.Code != http.StatusForbidden {
+			t.Fatalf("expected anonymous request to be rejected, got status %d", recorder.Code)
+		}
+	})
+}
@@ -2,20 +2,21 @@ package main
 
 import (
 	"cos-proxy/controller"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/tencentyun/cos-go-sdk-v5"
 )
 
-// getLocalIPv4s 会检测并返回本机所有的非环回 IPv4 地址
-func getLocalIPv4s() ([]string, error) {
+// getLocalIPs 会检测并返回本机所有的非环回 IPv4 和 IPv6 地址 (不包括 IPv6 链路本地地址)
+func getLocalIPs() ([]string, error) {
 	var ips []string
 	interfaces, err := net.Interfaces()
 	if err != nil {
@@ -36,9 +37,10 @@ func getLocalIPv4s() ([]string, error) {
 			} else {
 				continue
 			}
-			if ip.To4() != nil && !ip.IsLoopback() {
-				ips = append(ips, ip.String())
+			if ip.IsLoopback() || (ip.To4() == nil && ip.IsLinkLocalUnicast()) {
+				continue
 			}
+			ips = append(ips, ip.String())
 		}
 	}
 	return ips, nil
@@ -53,43 +55,123 @@ func requestLoggingMiddleware() gin.HandlerFunc {
 	}
 }
 
-// writeAccessMiddleware 是一个 Gin 中间件，用于检查写操作准入。
-func writeAccessMiddleware(allowedIPs map[string]bool, s3Auth *s3SignatureAuthenticator) gin.HandlerFunc {
+// writeAccessMiddleware 是一个 Gin 中间件，用于检查请求准入。
+// 携带有效签名的请求以对应的访问密钥身份评估，需同时满足访问密钥自身的权限和存储桶策略；
+// 未签名或签名无效的请求以匿名身份评估存储桶策略，readAuth 要求签名的读操作会直接拒绝匿名请求。
+// trustedProxies 与 Gin 的可信代理一致，只有来自这些地址的 X-Forwarded-Proto 才会被采信。
+func writeAccessMiddleware(policy *bucketPolicy, s3Auth *s3SignatureAuthenticator, readAuth *readAuthConfig, baseDomain string, trustedProxies ipAllowList) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 对于 GET 和 HEAD 请求，所有IP都允许访问
-		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
-			stripClientS3Auth(c.Request)
-			c.Next()
+		// 只有当 TCP 对端是可信代理时，Gin 才会采用 X-Real-IP/X-Forwarded-For 中的地址
+		clientIP := c.ClientIP()
+
+		bucket, key := controllers.ParseBucketAndKey(c.Request.Host, c.Request.URL.Path, baseDomain)
+		credential, err := s3Auth.Authenticate(c.Request)
+		if errors.Is(err, errMissingSignature) && isPostPolicyUpload(c.Request) {
+			// 浏览器表单上传通过 POST policy 字段签名，而不是 Authorization 头部
+			credential, err = s3Auth.AuthenticatePostPolicy(c.Request, bucket)
+		}
+		if err != nil {
+			if !errors.Is(err, errMissingSignature) {
+				log.Printf("S3 signature from IP %s is invalid for method %s, evaluating as anonymous: %v.", clientIP, c.Request.Method, err)
+			}
+			// 匿名请求不校验签名，但 aws-chunked 请求体仍需去除分块格式后再转发给 COS
+			if err := installAWSChunkedReader(c.Request, nil); err != nil {
+				log.Printf("Rejected: invalid aws-chunked request from IP %s: %v.", clientIP, err)
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		operations, err := requestOperations(c.Request, bucket, key)
+		if err != nil {
+			log.Printf("Rejected: cannot determine S3 operations of %s %s from IP %s: %v.", c.Request.Method, c.Request.URL.Path, clientIP, err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		// 优先从 X-Real-IP 获取 IP，这是常见的反向代理头部
-		clientIP := c.GetHeader("X-Real-IP")
-		if clientIP == "" {
-			// 如果 X-Real-IP 不存在，则回退到 Gin 的默认 IP 获取方式 (通常是 RemoteAddr)
-			clientIP = c.ClientIP()
+		if credential == nil {
+			if operation, required := readAuth.requiresSignature(operations, clientIP); required {
+				log.Printf("Forbidden: anonymous %s on %s from IP %s requires a valid S3 signature.", operation.action, operation.resource(), clientIP)
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: read access requires a valid S3 signature"})
+				return
+			}
+			// admin 操作 (存储桶配置、绕过 GOVERNANCE 保留期限等) 必须由拥有 admin 权限的访问密钥签名，存储桶策略不能向匿名请求授予这些权限
+			if requiresPrivilegedCredential(operations) {
+				log.Printf("Forbidden: anonymous %s %s from IP %s requires an admin credential.", c.Request.Method, c.Request.URL.Path, clientIP)
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: this request requires a valid S3 signature from an admin credential"})
+				return
+			}
 		}
-		if !allowedIPs[clientIP] {
-			if err := s3Auth.Verify(c.Request); err != nil {
-				log.Printf("Forbidden: IP %s is not in the whitelist and S3 signature is invalid for method %s: %v.", clientIP, c.Request.Method, err)
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: write access denied"})
+
+		principal := "anonymous"
+		request := &policyRequest{operations: operations, conditions: policyConditions(c.Request, clientIP, trustedProxies)}
+		if credential != nil {
+			principal = credential.AccessKey
+			request.accessKey = credential.principal()
+			request.conditions["aws:username"] = credential.principal()
+			if err := authorizeCredential(credential, operations); err != nil {
+				log.Printf("Forbidden: access key %s from IP %s is not allowed to %s %s: %v.", credential.AccessKey, clientIP, c.Request.Method, c.Request.URL.Path, err)
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: access key policy denies this request"})
 				return
 			}
-			log.Printf("Allowed: S3 signature is valid for IP %s and method %s.", clientIP, c.Request.Method)
-			stripClientS3Auth(c.Request)
-		} else {
-			log.Printf("Allowed: IP %s is in the whitelist for method %s.", clientIP, c.Request.Method)
-			stripClientS3Auth(c.Request)
+			// 临时凭证携带的会话策略只能收窄权限，必须显式允许请求涉及的全部操作
+			if credential.sessionPolicy != nil {
+				if decision := credential.sessionPolicy.evaluate(request); !decision.allowed {
+					log.Printf("Forbidden: session %s of %s from IP %s is denied %s on %s by its session policy (%s).", credential.AccessKey, credential.parent, clientIP, decision.operation.action, decision.operation.resource(), decision.reason)
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: session policy denies this request"})
+					return
+				}
+			}
 		}
+
+		decision := policy.evaluate(request)
+		switch {
+		case policy.dryRun:
+			log.Printf("Policy dry-run: %s from IP %s would be allowed=%t for %s on %s (%s).", principal, clientIP, decision.allowed, decision.operation.action, decision.operation.resource(), decision.reason)
+		case !decision.allowed:
+			log.Printf("Forbidden: %s from IP %s is denied %s on %s (%s).", principal, clientIP, decision.operation.action, decision.operation.resource(), decision.reason)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: access denied by bucket policy"})
+			return
+		case c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead:
+			log.Printf("Allowed: %s from IP %s for method %s (%s).", principal, clientIP, c.Request.Method, decision.reason)
+		}
+		if credential != nil {
+			c.Set(controllers.AuthenticatedContextKey, true)
+		}
+		stripClientS3Auth(c.Request)
 		c.Next()
 	}
 }
 
+// policyConditions 收集存储桶策略 Condition 中可以引用的请求上下文。
+func policyConditions(r *http.Request, clientIP string, trustedProxies ipAllowList) map[string]string {
+	query := r.URL.Query()
+	conditions := map[string]string{
+		"aws:sourceip":        clientIP,
+		"aws:securetransport": strconv.FormatBool(secureTransport(r, trustedProxies)),
+		"aws:useragent":       r.UserAgent(),
+		"aws:referer":         r.Referer(),
+	}
+	if query.Has("prefix") {
+		conditions["s3:prefix"] = query.Get("prefix")
+	}
+	if query.Has("delimiter") {
+		conditions["s3:delimiter"] = query.Get("delimiter")
+	}
+	if query.Has("max-keys") {
+		conditions["s3:max-keys"] = query.Get("max-keys")
+	}
+	return conditions
+}
+
 func stripClientS3Auth(r *http.Request) {
 	r.Header.Del("Authorization")
 	r.Header.Del("X-Amz-Security-Token")
 
 	query := r.URL.Query()
+	query.Del("AWSAccessKeyId")
+	query.Del("Signature")
+	query.Del("Expires")
 	for key := range query {
 		if strings.HasPrefix(strings.ToLower(key), "x-amz-") {
 			query.Del(key)
@@ -99,6 +181,14 @@ func stripClientS3Auth(r *http.Request) {
 }
 
 func main() {
+	// --- 子命令 ---
+	if len(os.Args) > 1 && os.Args[1] == "presign" {
+		if err := runPresignCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("presign: %v", err)
+		}
+		return
+	}
+
 	// --- 配置信息 ---
 	// 从环境变量中读取基础域名，例如 "proxy.example.com"
 	baseDomain := os.Getenv("BASE_DOMAIN")
@@ -106,82 +196,219 @@ func main() {
 		log.Println("Warning: BASE_DOMAIN environment variable is not set. Virtual-hosted style requests may not work correctly.")
 	}
 	whitelistStr := os.Getenv("WHITELIST_IPS")
+	trustedProxiesStr := os.Getenv("TRUSTED_PROXIES")
+	publicEndpointStr := os.Getenv("PUBLIC_ENDPOINT")
+	sessionTokenKey := os.Getenv("SESSION_TOKEN_KEY")
 	listenAddr := ":8080"
 	bucketURL := os.Getenv("COS_BUCKET_URL_INTERNAL")
+	bucketName := os.Getenv("COS_BUCKET_NAME")
+	bucketsFile := os.Getenv("BUCKETS_FILE")
+	objectLockStoreFile := os.Getenv("OBJECT_LOCK_STORE_FILE")
 	secretID := os.Getenv("TENCENTCLOUD_SECRET_ID")
 	secretKey := os.Getenv("TENCENTCLOUD_SECRET_KEY")
 	proxyAccessKey := os.Getenv("PROXY_ACCESS_KEY")
 	proxySecretKey := os.Getenv("PROXY_SECRET_KEY")
+	proxyAllowSigV2 := os.Getenv("PROXY_ALLOW_SIGV2") == "true"
+	credentialsFile := os.Getenv("PROXY_CREDENTIALS_FILE")
+	policyFile := os.Getenv("BUCKET_POLICY_FILE")
+	policyDryRun := strings.EqualFold(os.Getenv("BUCKET_POLICY_DRY_RUN"), "true")
+	readAuthModeStr := os.Getenv("READ_AUTH_MODE")
+	readAuthPrivatePrefixes := splitList(os.Getenv("READ_AUTH_PRIVATE_PREFIXES"))
+	readAuthPublicPrefixes := splitList(os.Getenv("READ_AUTH_PUBLIC_PREFIXES"))
+	maxPostFormSizeStr := os.Getenv("MAX_POST_FORM_SIZE")
 
-	if bucketURL == "" || secretID == "" || secretKey == "" {
-		log.Fatal("Missing required environment variables: COS_BUCKET_URL_INTERNAL, TENCENTCLOUD_SECRET_ID, TENCENTCLOUD_SECRET_KEY")
+	if bucketURL == "" && bucketsFile == "" {
+		log.Fatal("Missing required environment variables: COS_BUCKET_URL_INTERNAL or BUCKETS_FILE")
 	}
 
 	// --- IP 白名单处理 ---
-	allowedIPs := make(map[string]bool)
-	if whitelistStr != "" {
-		ips := strings.Split(whitelistStr, ",")
-		for _, ip := range ips {
-			trimmedIP := strings.TrimSpace(ip)
-			if trimmedIP != "" {
-				allowedIPs[trimmedIP] = true
-			}
-		}
-	}
-	log.Printf("Loaded %d IP(s) from WHITELIST_IPS env var.", len(allowedIPs))
+	// 支持单个 IPv4/IPv6 地址和 CIDR 网段
+	whitelistEntries := splitList(whitelistStr)
+	log.Printf("Loaded %d entr(ies) from WHITELIST_IPS env var.", len(whitelistEntries))
 
-	localIPs, err := getLocalIPv4s()
+	localIPs, err := getLocalIPs()
 	if err != nil {
 		log.Printf("Warning: Failed to get local IPs, will only use IPs from env var. Error: %v", err)
 	} else {
-		for _, ip := range localIPs {
-			if !allowedIPs[ip] {
-				allowedIPs[ip] = true
-			}
-		}
+		whitelistEntries = append(whitelistEntries, localIPs...)
 		log.Printf("Automatically added %d local IP(s) to the whitelist: %v", len(localIPs), localIPs)
 	}
 
-	finalAllowedList := []string{}
-	for ip := range allowedIPs {
-		finalAllowedList = append(finalAllowedList, ip)
+	allowedIPs, err := parseIPAllowList(whitelistEntries)
+	if err != nil {
+		log.Fatalf("Invalid WHITELIST_IPS: %v", err)
+	}
+	log.Printf("Total %d IP(s)/network(s) are whitelisted for write operations: %v", len(allowedIPs), allowedIPs.strings())
+
+	// --- 可信代理处理 ---
+	// 只有来自可信代理的连接才会采用 X-Real-IP/X-Forwarded-For 头部和 PROXY protocol 中的客户端地址
+	trustedProxies, err := parseIPAllowList(splitList(trustedProxiesStr))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	if len(trustedProxies) == 0 {
+		log.Println("TRUSTED_PROXIES is not set. X-Real-IP/X-Forwarded-For headers are ignored and the TCP peer address is used as the client IP.")
+	} else {
+		log.Printf("Trusting client IP headers and PROXY protocol from: %v", trustedProxies.strings())
+	}
+
+	// --- 代理访问密钥处理 ---
+	// PROXY_CREDENTIALS_FILE 中的密钥按各自的策略授权，PROXY_ACCESS_KEY/PROXY_SECRET_KEY 保持为不受限的密钥 (包括 admin)
+	var credentials []*proxyCredential
+	if credentialsFile != "" {
+		credentials, err = loadProxyCredentials(credentialsFile)
+		if err != nil {
+			log.Fatalf("Invalid PROXY_CREDENTIALS_FILE: %v", err)
+		}
+		log.Printf("Loaded %d access key(s) from PROXY_CREDENTIALS_FILE.", len(credentials))
+	}
+	if proxyAccessKey != "" && proxySecretKey != "" {
+		for _, credential := range credentials {
+			if credential.AccessKey == proxyAccessKey {
+				log.Fatalf("PROXY_ACCESS_KEY %s is also defined in PROXY_CREDENTIALS_FILE", proxyAccessKey)
+			}
+		}
+		credentials = append(credentials, &proxyCredential{
+			AccessKey:  proxyAccessKey,
+			SecretKey:  proxySecretKey,
+			Actions:    []string{string(actionAll), string(actionAdmin)},
+			AllowSigV2: proxyAllowSigV2,
+		})
 	}
-	log.Printf("Total %d unique IPs are whitelisted for write operations: %v", len(finalAllowedList), finalAllowedList)
-	s3Auth := newS3SignatureAuthenticator(proxyAccessKey, proxySecretKey)
+	s3Auth := newCredentialAuthenticator(credentials)
 	if s3Auth == nil {
-		log.Println("Warning: PROXY_ACCESS_KEY/PROXY_SECRET_KEY are not fully configured. Write operations require IP whitelist only.")
+		log.Println("Warning: No proxy access keys are configured (PROXY_CREDENTIALS_FILE or PROXY_ACCESS_KEY/PROXY_SECRET_KEY). Write operations require IP whitelist only.")
 	} else {
-		log.Printf("S3 signature authentication enabled for access key: %s", proxyAccessKey)
+		// SigV2 的规范资源需要根据 BASE_DOMAIN 识别虚拟托管类型请求中的存储桶
+		s3Auth.baseDomain = baseDomain
+		if sessionTokenKey != "" {
+			s3Auth.sessions, err = newSessionSealer(sessionTokenKey)
+			if err != nil {
+				log.Fatalf("Invalid SESSION_TOKEN_KEY: %v", err)
+			}
+			log.Println("Temporary session credentials enabled via " + adminPathPrefix + "sts.")
+		}
+		for _, credential := range credentials {
+			log.Printf("S3 signature authentication enabled for access key: %s (enabled: %t, actions: %v, prefixes: %v, sigv2: %t)", credential.AccessKey, credential.isEnabled(), credential.Actions, credential.Prefixes, credential.AllowSigV2)
+		}
+	}
+
+	// --- 存储桶策略处理 ---
+	// 未配置 BUCKET_POLICY_FILE 时使用内置策略：所有人可读，白名单 IP 和代理访问密钥可写
+	var policy *bucketPolicy
+	if policyFile != "" {
+		policy, err = loadBucketPolicy(policyFile, policyDryRun)
+		if err != nil {
+			log.Fatalf("Invalid BUCKET_POLICY_FILE: %v", err)
+		}
+		log.Printf("Loaded %d statement(s) from BUCKET_POLICY_FILE.", len(policy.document.Statement))
+	} else {
+		accessKeys := make([]string, 0, len(credentials))
+		for _, credential := range credentials {
+			accessKeys = append(accessKeys, credential.AccessKey)
+		}
+		policy = defaultBucketPolicy(allowedIPs.strings(), accessKeys)
+		policy.dryRun = policyDryRun
+	}
+	if policy.dryRun {
+		log.Println("Warning: BUCKET_POLICY_DRY_RUN is enabled. Policy decisions are logged but not enforced.")
+	}
+
+	// --- 读操作认证处理 ---
+	readAuth, err := newReadAuthConfig(readAuthModeStr, readAuthPrivatePrefixes, readAuthPublicPrefixes, allowedIPs)
+	if err != nil {
+		log.Fatalf("Invalid READ_AUTH_MODE: %v", err)
+	}
+	log.Printf("Read authentication mode: %s (private prefixes: %v, public prefixes: %v)", readAuth.mode, readAuth.privatePrefixes, readAuth.publicPrefixes)
+	if readAuth.mode != readAuthOff && s3Auth == nil {
+		log.Println("Warning: READ_AUTH_MODE is enabled but no proxy access keys are configured. Protected reads are only possible from whitelisted IPs.")
+	}
+
+	// --- 表单上传大小限制 ---
+	maxPostFormSize := int64(defaultMaxPostFormSize)
+	if maxPostFormSizeStr != "" {
+		maxPostFormSize, err = strconv.ParseInt(maxPostFormSizeStr, 10, 64)
+		if err != nil || maxPostFormSize <= 0 {
+			log.Fatalf("Invalid MAX_POST_FORM_SIZE: %q", maxPostFormSizeStr)
+		}
+	}
+	log.Printf("Form uploads are limited to %d bytes.", maxPostFormSize)
+
+	// --- 管理接口处理 ---
+	var publicEndpoint *url.URL
+	if publicEndpointStr != "" {
+		publicEndpoint, err = url.Parse(publicEndpointStr)
+		if err != nil || publicEndpoint.Scheme == "" || publicEndpoint.Host == "" {
+			log.Fatalf("Invalid PUBLIC_ENDPOINT: %q", publicEndpointStr)
+		}
 	}
 
 	// --- COS 客户端初始化 ---
-	u, err := url.Parse(bucketURL)
+	// BUCKETS_FILE 中的每个存储桶使用独立的 COS 客户端，COS_BUCKET_URL_INTERNAL 以 COS_BUCKET_NAME
+	// (默认为 COS 存储桶名称) 注册为其中一个存储桶，请求未知的存储桶名称时返回 NoSuchBucket
+	var bucketConfigs []*bucketConfig
+	if bucketsFile != "" {
+		bucketConfigs, err = loadBucketConfigs(bucketsFile)
+		if err != nil {
+			log.Fatalf("Invalid BUCKETS_FILE: %v", err)
+		}
+	}
+	if bucketURL != "" {
+		if bucketName == "" {
+			bucketName = defaultBucketName(bucketURL)
+		}
+		bucketConfigs = append(bucketConfigs, &bucketConfig{Name: bucketName, URL: bucketURL})
+	}
+	buckets, err := newBucketRegistry(bucketConfigs, secretID, secretKey)
 	if err != nil {
-		log.Fatalf("Invalid COS_BUCKET_URL_INTERNAL: %v", err)
+		log.Fatalf("Invalid bucket configuration: %v", err)
+	}
+	for _, bucket := range bucketConfigs {
+		log.Printf("Proxying bucket %s to COS bucket: %s", bucket.Name, bucket.URL)
+	}
+
+	// 对象锁定的保留状态保存在 OBJECT_LOCK_STORE_FILE 中，启用对象锁定的存储桶必须配置该文件
+	var objectLocks *controllers.ObjectLockStore
+	if objectLockStoreFile != "" {
+		objectLocks, err = controllers.OpenObjectLockStore(objectLockStoreFile)
+		if err != nil {
+			log.Fatalf("Invalid OBJECT_LOCK_STORE_FILE: %v", err)
+		}
+	}
+	for _, bucket := range bucketConfigs {
+		if bucket.ObjectLock != nil && objectLocks == nil {
+			log.Fatalf("Bucket %s enables object_lock but OBJECT_LOCK_STORE_FILE is not set", bucket.Name)
+		}
 	}
-	baseURL := &cos.BaseURL{BucketURL: u}
-	cosClient := cos.NewClient(baseURL, &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:  secretID,
-			SecretKey: secretKey,
-		},
-	})
-	log.Printf("Proxying requests to COS bucket: %s", u.Host)
 
 	// --- Gin 服务器初始化 ---
 	router := gin.Default()
+	router.RemoteIPHeaders = []string{"X-Real-IP", "X-Forwarded-For"}
+	if err := router.SetTrustedProxies(trustedProxies.strings()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// --- 中间件设置 ---
 	router.Use(requestLoggingMiddleware())
-	router.Use(writeAccessMiddleware(allowedIPs, s3Auth))
+	router.Use(adminMiddleware(s3Auth, publicEndpoint))
+	router.Use(postFormSizeMiddleware(maxPostFormSize))
+	router.Use(writeAccessMiddleware(policy, s3Auth, readAuth, baseDomain, trustedProxies))
 
 	// --- 路由和控制器设置 ---
-	s3Controller := controllers.NewS3Controller(baseDomain, cosClient)
+	s3Controller := controllers.NewS3Controller(baseDomain, buckets)
+	s3Controller.ObjectLocks = objectLocks
 	s3Controller.RegisterRoutes(router)
 
 	// --- 启动服务器 ---
 	log.Printf("Starting S3 compatible proxy server on %s", listenAddr)
-	if err := router.Run(listenAddr); err != nil {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", listenAddr, err)
+	}
+	if len(trustedProxies) > 0 {
+		listener = &proxyProtocolListener{Listener: listener, trusted: trustedProxies}
+	}
+	if err := router.RunListener(listener); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
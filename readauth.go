@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type readAuthMode string
+
+const (
+	readAuthOff      readAuthMode = "off"
+	readAuthListOnly readAuthMode = "list-only"
+	readAuthAll      readAuthMode = "all"
+	readAuthPrefix   readAuthMode = "prefix"
+)
+
+// readAuthConfig 决定哪些读操作必须携带有效签名。publicPrefixes 下的对象始终允许匿名读取，
+// privatePrefixes 只在 prefix 模式下生效，trustedIPs 中的来源 (IP 白名单) 不受限制。
+type readAuthConfig struct {
+	mode            readAuthMode
+	privatePrefixes []string
+	publicPrefixes  []string
+	trustedIPs      ipAllowList
+}
+
+func newReadAuthConfig(mode string, privatePrefixes, publicPrefixes []string, trustedIPs ipAllowList) (*readAuthConfig, error) {
+	config := &readAuthConfig{
+		mode:            readAuthMode(strings.ToLower(strings.TrimSpace(mode))),
+		privatePrefixes: privatePrefixes,
+		publicPrefixes:  publicPrefixes,
+		trustedIPs:      trustedIPs,
+	}
+	switch config.mode {
+	case "":
+		config.mode = readAuthOff
+	case readAuthOff, readAuthListOnly, readAuthAll:
+	case readAuthPrefix:
+		if len(privatePrefixes) == 0 {
+			return nil, fmt.Errorf("read auth mode %q requires at least one private prefix", config.mode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown read auth mode %q", mode)
+	}
+	return config, nil
+}
+
+// requiresSignature 返回匿名请求中第一个需要签名才能执行的读操作。
+func (c *readAuthConfig) requiresSignature(operations []s3Operation, clientIP string) (s3Operation, bool) {
+	if c == nil || c.mode == readAuthOff || c.trustedIPs.contains(clientIP) {
+		return s3Operation{}, false
+	}
+	for _, operation := range operations {
+		if c.operationRequiresSignature(operation) {
+			return operation, true
+		}
+	}
+	return s3Operation{}, false
+}
+
+func (c *readAuthConfig) operationRequiresSignature(operation s3Operation) bool {
+	listing := operation.grant == actionList
+	if !listing && operation.grant != actionRead {
+		return false
+	}
+	if hasAnyPrefix(operation.key, c.publicPrefixes) {
+		return false
+	}
+
+	switch c.mode {
+	case readAuthListOnly:
+		return listing
+	case readAuthAll:
+		return true
+	case readAuthPrefix:
+		for _, prefix := range c.privatePrefixes {
+			// 列举的前缀只要可能包含私有前缀下的对象，就需要签名
+			if strings.HasPrefix(operation.key, prefix) || (listing && strings.HasPrefix(prefix, operation.key)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList 解析以逗号分隔的环境变量，忽略空白项。
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
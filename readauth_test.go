@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadAuthConfigRequiresSignature(t *testing.T) {
+	getObject := func(key string) s3Operation {
+		return s3Operation{action: "s3:GetObject", grant: actionRead, bucket: "bucket", key: key}
+	}
+	listBucket := func(prefix string) s3Operation {
+		return s3Operation{action: "s3:ListBucket", grant: actionList, bucket: "bucket", key: prefix}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		mode      string
+		private   []string
+		operation s3Operation
+		required  bool
+	}{
+		{name: "off", mode: "off", operation: listBucket(""), required: false},
+		{name: "list-only list", mode: "list-only", operation: listBucket("docs/"), required: true},
+		{name: "list-only object", mode: "list-only", operation: getObject("docs/a.txt"), required: false},
+		{name: "list-only multipart uploads", mode: "list-only", operation: s3Operation{action: "s3:ListBucketMultipartUploads", grant: actionList, bucket: "bucket"}, required: true},
+		{name: "all object", mode: "all", operation: getObject("docs/a.txt"), required: true},
+		{name: "all public prefix", mode: "all", operation: getObject("public/a.txt"), required: false},
+		{name: "all public listing", mode: "all", operation: listBucket("public/img/"), required: false},
+		{name: "all object version", mode: "all", operation: s3Operation{action: "s3:GetObjectVersion", grant: actionRead, bucket: "bucket", key: "docs/a.txt"}, required: true},
+		{name: "all object tagging", mode: "all", operation: s3Operation{action: "s3:GetObjectTagging", grant: actionRead, bucket: "bucket", key: "docs/a.txt"}, required: true},
+		{name: "all write is not a read", mode: "all", operation: s3Operation{action: "s3:PutObject", grant: actionWrite, key: "a"}, required: false},
+		{name: "prefix private object", mode: "prefix", private: []string{"private/"}, operation: getObject("private/a.txt"), required: true},
+		{name: "prefix private object version", mode: "prefix", private: []string{"private/"}, operation: s3Operation{action: "s3:GetObjectVersion", grant: actionRead, bucket: "bucket", key: "private/a.txt"}, required: true},
+		{name: "prefix other object", mode: "prefix", private: []string{"private/"}, operation: getObject("docs/a.txt"), required: false},
+		{name: "prefix root listing", mode: "prefix", private: []string{"private/"}, operation: listBucket(""), required: true},
+		{name: "prefix sibling listing", mode: "prefix", private: []string{"private/"}, operation: listBucket("docs/"), required: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := newReadAuthConfig(tc.mode, tc.private, []string{"public/"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, required := config.requiresSignature([]s3Operation{tc.operation}, "203.0.113.10"); required != tc.required {
+				t.Fatalf("expected required=%t, got %t", tc.required, required)
+			}
+		})
+	}
+}
+
+func TestNewReadAuthConfigRejectsInvalidMode(t *testing.T) {
+	if _, err := newReadAuthConfig("sometimes", nil, nil, nil); err == nil {
+		t.Fatal("expected unknown mode to be rejected")
+	}
+	if _, err := newReadAuthConfig("prefix", nil, nil, nil); err == nil {
+		t.Fatal("expected prefix mode without private prefixes to be rejected")
+	}
+}
+
+func TestWriteAccessMiddlewareReadAuth(t *testing.T) {
+	readAuth, err := newReadAuthConfig("all", nil, nil, ipAllowList{parsePolicyNetwork("198.51.100.0/24")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := testAuthenticator()
+	policy := defaultBucketPolicy(nil, []string{"proxy-access"})
+
+	for _, tc := range []struct {
+		name   string
+		req    *http.Request
+		ip     string
+		status int
+	}{
+		{name: "anonymous", req: httptest.NewRequest(http.MethodGet, "http://s3.example.com/bucket/a.txt", nil), ip: "203.0.113.10", status: http.StatusForbidden},
+		{name: "whitelisted", req: httptest.NewRequest(http.MethodGet, "http://s3.example.com/bucket/a.txt", nil), ip: "198.51.100.7", status: http.StatusOK},
+		{name: "signed", req: newSignedRequest(t, auth, "GET", "http://s3.example.com/bucket/a.txt", ""), ip: "203.0.113.10", status: http.StatusOK},
+		{name: "presigned", req: newPresignedRequest(t, auth, "GET", "http://s3.example.com/bucket/a.txt", time.Hour), ip: "203.0.113.10", status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.Header.Set("X-Real-IP", tc.ip)
+			recorder := httptest.NewRecorder()
+
+			writeAccessMiddleware(policy, auth, readAuth, "", nil)(newTestContext(recorder, tc.req))
+
+			if recorder.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, recorder.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionAccessKeyPrefix = "ASIA"
+	sessionTokenVersion    = "cos-proxy-session-v1"
+	minSessionDuration     = 15 * time.Minute
+	maxSessionDuration     = 12 * time.Hour
+	defaultSessionDuration = time.Hour
+	maxSessionPolicySize   = 2048
+	minSessionTokenKeySize = 16
+	stsXMLNamespace        = "https://sts.amazonaws.com/doc/2011-06-15/"
+)
+
+var (
+	errInvalidSessionToken = errors.New("invalid or expired session token")
+	sessionNamePattern     = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+)
+
+// sessionSealer 使用 SESSION_TOKEN_KEY 派生的密钥加密临时凭证，令牌本身携带全部会话信息，
+// 多个副本只要配置相同的密钥即可校验彼此签发的令牌，无需共享存储。
+type sessionSealer struct {
+	aead cipher.AEAD
+}
+
+// sessionClaims 是密封在会话令牌中的内容。
+type sessionClaims struct {
+	Parent    string `json:"p"`
+	AccessKey string `json:"a"`
+	SecretKey string `json:"s"`
+	Expires   int64  `json:"e"`
+	Name      string `json:"n,omitempty"`
+	Policy    string `json:"pol,omitempty"`
+}
+
+func newSessionSealer(key string) (*sessionSealer, error) {
+	if len(key) < minSessionTokenKeySize {
+		return nil, fmt.Errorf("session token key must be at least %d characters", minSessionTokenKeySize)
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionSealer{aead: aead}, nil
+}
+
+func (s *sessionSealer) seal(claims *sessionClaims) (string, error) {
+	plaintext, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(sessionTokenVersion))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (s *sessionSealer) open(token string) (*sessionClaims, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return nil, errInvalidSessionToken
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(sessionTokenVersion))
+	if err != nil {
+		return nil, errInvalidSessionToken
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(plaintext, &claims); err != nil {
+		return nil, errInvalidSessionToken
+	}
+	return &claims, nil
+}
+
+// resolve 返回签名中访问密钥对应的凭证，携带会话令牌时解析并校验临时凭证。
+func (a *s3SignatureAuthenticator) resolve(accessKey, sessionToken string) (*proxyCredential, error) {
+	if sessionToken == "" {
+		return a.lookup(accessKey)
+	}
+	if a.sessions == nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidSignature, errInvalidSessionToken)
+	}
+	claims, err := a.sessions.open(sessionToken)
+	if err != nil || claims.AccessKey != accessKey || !a.now().Before(time.Unix(claims.Expires, 0)) {
+		return nil, fmt.Errorf("%w: %w", errInvalidSignature, errInvalidSessionToken)
+	}
+	// 临时凭证的权限始终以签发它的长期密钥的当前配置为上限，长期密钥被停用后其会话也随之失效
+	parent, err := a.lookup(claims.Parent)
+	if err != nil {
+		return nil, err
+	}
+	credential := &proxyCredential{
+		AccessKey: claims.AccessKey,
+		SecretKey: claims.SecretKey,
+		Prefixes:  parent.Prefixes,
+		parent:    parent.AccessKey,
+	}
+	for _, action := range parent.Actions {
+		if credentialAction(action) != actionAdmin {
+			credential.Actions = append(credential.Actions, action)
+		}
+	}
+	if claims.Policy != "" {
+		document, err := parseSessionPolicy(claims.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidSignature, errInvalidSessionToken)
+		}
+		credential.sessionPolicy = &bucketPolicy{document: document, now: a.now}
+	}
+	return credential, nil
+}
+
+// issueSession 为长期密钥 parent 签发临时凭证，policy 是可选的会话策略，只能进一步收窄权限。
+func (a *s3SignatureAuthenticator) issueSession(parent *proxyCredential, name string, duration time.Duration, policy string) (*sessionClaims, string, error) {
+	if a.sessions == nil {
+		return nil, "", errors.New("temporary credentials are disabled: SESSION_TOKEN_KEY is not configured")
+	}
+	if policy != "" {
+		if len(policy) > maxSessionPolicySize {
+			return nil, "", fmt.Errorf("session policy must not exceed %d characters", maxSessionPolicySize)
+		}
+		if _, err := parseSessionPolicy(policy); err != nil {
+			return nil, "", fmt.Errorf("invalid session policy: %w", err)
+		}
+	}
+
+	claims := &sessionClaims{
+		Parent:    parent.AccessKey,
+		AccessKey: sessionAccessKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes(10)),
+		SecretKey: base64.RawStdEncoding.EncodeToString(randomBytes(30)),
+		Expires:   a.now().Add(duration).Unix(),
+		Name:      name,
+		Policy:    policy,
+	}
+	token, err := a.sessions.seal(claims)
+	if err != nil {
+		return nil, "", err
+	}
+	return claims, token, nil
+}
+
+// parseSessionPolicy 解析 IAM 风格的会话策略。会话策略作用于临时凭证本身，因此 Principal 可以省略。
+func parseSessionPolicy(policy string) (*policyDocument, error) {
+	var document policyDocument
+	if err := json.Unmarshal([]byte(policy), &document); err != nil {
+		return nil, err
+	}
+	for i := range document.Statement {
+		if document.Statement[i].Principal == nil {
+			document.Statement[i].Principal = &policyPrincipal{AWS: policyValues{"*"}}
+		}
+	}
+	if err := document.validate(); err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+func randomBytes(size int) []byte {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+type assumeRoleResponse struct {
+	XMLName xml.Name         `xml:"AssumeRoleResponse"`
+	XMLNS   string           `xml:"xmlns,attr"`
+	Result  assumeRoleResult `xml:"AssumeRoleResult"`
+}
+
+type assumeRoleResult struct {
+	Credentials     stsCredentials     `xml:"Credentials"`
+	AssumedRoleUser stsAssumedRoleUser `xml:"AssumedRoleUser"`
+}
+
+type stsCredentials struct {
+	AccessKeyID     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	SessionToken    string `xml:"SessionToken"`
+	Expiration      string `xml:"Expiration"`
+}
+
+type stsAssumedRoleUser struct {
+	AssumedRoleID string `xml:"AssumedRoleId"`
+	Arn           string `xml:"Arn"`
+}
+
+type stsErrorResponse struct {
+	XMLName xml.Name `xml:"ErrorResponse"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Error   stsError `xml:"Error"`
+}
+
+type stsError struct {
+	Type    string `xml:"Type"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// handleAssumeRole 实现与 STS AssumeRole 形式兼容的接口，参数既可以放在查询字符串中也可以放在
+// application/x-www-form-urlencoded 请求体中，AWS SDK 的 STS 客户端可以直接指向该地址使用。
+func handleAssumeRole(c *gin.Context, s3Auth *s3SignatureAuthenticator, caller *proxyCredential) {
+	if err := c.Request.ParseForm(); err != nil {
+		writeSTSError(c, http.StatusBadRequest, "MalformedInput", err.Error())
+		return
+	}
+	form := c.Request.Form
+	if form.Get("Action") != "AssumeRole" {
+		writeSTSError(c, http.StatusBadRequest, "InvalidAction", "Only the AssumeRole action is supported")
+		return
+	}
+	name := form.Get("RoleSessionName")
+	if name == "" {
+		name = caller.AccessKey
+	}
+	if !sessionNamePattern.MatchString(name) {
+		writeSTSError(c, http.StatusBadRequest, "ValidationError", "RoleSessionName must be 2-64 characters of [\\w+=,.@-]")
+		return
+	}
+
+	duration := defaultSessionDuration
+	if value := form.Get("DurationSeconds"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || time.Duration(seconds)*time.Second < minSessionDuration || time.Duration(seconds)*time.Second > maxSessionDuration {
+			writeSTSError(c, http.StatusBadRequest, "ValidationError", fmt.Sprintf("DurationSeconds must be between %d and %d", int(minSessionDuration/time.Second), int(maxSessionDuration/time.Second)))
+			return
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	claims, token, err := s3Auth.issueSession(caller, name, duration, form.Get("Policy"))
+	if err != nil {
+		writeSTSError(c, http.StatusBadRequest, "ValidationError", err.Error())
+		return
+	}
+	log.Printf("Access key %s issued temporary credentials %s (session %q) expiring at %s.", caller.AccessKey, claims.AccessKey, name, time.Unix(claims.Expires, 0).UTC().Format(time.RFC3339))
+
+	payload := assumeRoleResponse{
+		XMLNS: stsXMLNamespace,
+		Result: assumeRoleResult{
+			Credentials: stsCredentials{
+				AccessKeyID:     claims.AccessKey,
+				SecretAccessKey: claims.SecretKey,
+				SessionToken:    token,
+				Expiration:      time.Unix(claims.Expires, 0).UTC().Format(time.RFC3339),
+			},
+			AssumedRoleUser: stsAssumedRoleUser{
+				AssumedRoleID: claims.AccessKey + ":" + name,
+				Arn:           "arn:aws:sts::cos-proxy:assumed-role/" + caller.AccessKey + "/" + name,
+			},
+		},
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		writeSTSError(c, http.StatusInternalServerError, "InternalFailure", err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", []byte(xml.Header+string(encoded)))
+}
+
+func writeSTSError(c *gin.Context, status int, code, message string) {
+	payload := stsErrorResponse{
+		XMLNS: stsXMLNamespace,
+		Error: stsError{Type: "Sender", Code: code, Message: message},
+	}
+	if status >= http.StatusInternalServerError {
+		payload.Error.Type = "Receiver"
+	}
+	encoded, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		c.Status(status)
+		return
+	}
+	c.Data(status, "application/xml", []byte(xml.Header+string(encoded)))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sessionAuthenticator(t *testing.T) *s3SignatureAuthenticator {
+	t.Helper()
+	auth := testAuthenticator()
+	sealer, err := newSessionSealer("0123456789abcdef-session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.sessions = sealer
+	return auth
+}
+
+func assumeRole(t *testing.T, auth *s3SignatureAuthenticator, form url.Values) (*httptest.ResponseRecorder, stsCredentials) {
+	t.Helper()
+	req := newSignedRequest(t, auth, http.MethodPost, "http://s3.example.com/-/sts", form.Encode())
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	adminMiddleware(auth, nil)(newTestContext(recorder, req))
+
+	var response assumeRoleResponse
+	if recorder.Code == http.StatusOK {
+		if err := xml.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder, response.Result.Credentials
+}
+
+func newSessionSignedRequest(t *testing.T, credentials stsCredentials, method, target, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	req.Host = req.URL.Host
+	req.Header.Set("X-Amz-Date", "20260517T163000Z")
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+
+	scope := "20260517/us-east-1/s3/aws4_request"
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date", "x-amz-security-token"}
+	canonicalRequest, err := buildCanonicalRequest(req, signedHeaders, "", unsignedPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &proxyCredential{AccessKey: credentials.AccessKeyID, SecretKey: credentials.SecretAccessKey}
+	signature := signer.signature("20260517T163000Z", scope, canonicalRequest)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+credentials.AccessKeyID+"/"+scope+", SignedHeaders="+strings.Join(signedHeaders, ";")+", Signature="+signature)
+	return req
+}
+
+func TestAssumeRoleIssuesVerifiableSession(t *testing.T) {
+	auth := sessionAuthenticator(t)
+	recorder, credentials := assumeRole(t, auth, url.Values{"Action": {"AssumeRole"}, "RoleSessionName": {"ci-runner"}, "DurationSeconds": {"900"}})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected AssumeRole to succeed, got status %d: %s", recorder.Code, recorder.Body)
+	}
+	if !strings.HasPrefix(credentials.AccessKeyID, sessionAccessKeyPrefix) || credentials.SessionToken == "" {
+		t.Fatalf("unexpected temporary credentials: %+v", credentials)
+	}
+
+	credential, err := auth.Authenticate(newSessionSignedRequest(t, credentials, http.MethodPut, "http://s3.example.com/bucket/a.txt", "hello"))
+	if err != nil {
+		t.Fatalf("expected session credentials to verify, got %v", err)
+	}
+	if credential.principal() != "proxy-access" || credential.hasAction(actionAdmin) {
+		t.Fatalf("expected session to act as proxy-access without admin, got %+v", credential)
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		expired := sessionAuthenticator(t)
+		expired.now = func() time.Time { return auth.now().Add(16 * time.Minute) }
+		expired.maxSkew = time.Hour
+		if err := expired.Verify(newSessionSignedRequest(t, credentials, http.MethodGet, "http://s3.example.com/bucket/a.txt", "")); !errors.Is(err, errInvalidSessionToken) {
+			t.Fatalf("expected expired session to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("other replica key", func(t *testing.T) {
+		other := testAuthenticator()
+		other.sessions, _ = newSessionSealer("another-replica-session-key")
+		if err := other.Verify(newSessionSignedRequest(t, credentials, http.MethodGet, "http://s3.example.com/bucket/a.txt", "")); err == nil {
+			t.Fatal("expected token sealed with a different key to be rejected")
+		}
+	})
+
+	t.Run("parent disabled", func(t *testing.T) {
+		disabled := false
+		auth.credentials["proxy-access"].Enabled = &disabled
+		defer func() { auth.credentials["proxy-access"].Enabled = nil }()
+		if err := auth.Verify(newSessionSignedRequest(t, credentials, http.MethodGet, "http://s3.example.com/bucket/a.txt", "")); err == nil {
+			t.Fatal("expected session of a disabled key to be rejected")
+		}
+	})
+
+	t.Run("session cannot assume role", func(t *testing.T) {
+		req := newSessionSignedRequest(t, credentials, http.MethodPost, "http://s3.example.com/-/sts?Action=AssumeRole", "")
+		recorder := httptest.NewRecorder()
+		adminMiddleware(auth, nil)(newTestContext(recorder, req))
+		if recorder.Code != http.StatusForbidden {
+			t.Fatalf("expected session to be refused, got status %d", recorder.Code)
+		}
+	})
+}
+
+func TestAssumeRoleValidatesParameters(t *testing.T) {
+	for name, form := range map[string]url.Values{
+		"unknown action":   {"Action": {"GetSessionToken"}},
+		"too short":        {"Action": {"AssumeRole"}, "DurationSeconds": {"60"}},
+		"too long":         {"Action": {"AssumeRole"}, "DurationSeconds": {"86400"}},
+		"bad session name": {"Action": {"AssumeRole"}, "RoleSessionName": {"has spaces"}},
+		"bad policy":       {"Action": {"AssumeRole"}, "Policy": {`{"Statement": [{"Effect": "Maybe", "Action": "s3:*", "Resource": "*"}]}`}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if recorder, _ := assumeRole(t, sessionAuthenticator(t), form); recorder.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", recorder.Code)
+			}
+		})
+	}
+
+	t.Run("sessions disabled", func(t *testing.T) {
+		if recorder, _ := assumeRole(t, testAuthenticator(), url.Values{"Action": {"AssumeRole"}}); recorder.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400 without SESSION_TOKEN_KEY, got %d", recorder.Code)
+		}
+	})
+}
+
+func TestWriteAccessMiddlewareEnforcesSessionPolicy(t *testing.T) {
+	auth := sessionAuthenticator(t)
+	policy := `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:GetObject", "s3:PutObject"], "Resource": "arn:aws:s3:::bucket/ci/*"}]}`
+	recorder, credentials := assumeRole(t, auth, url.Values{"Action": {"AssumeRole"}, "Policy": {policy}})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected AssumeRole to succeed, got status %d: %s", recorder.Code, recorder.Body)
+	}
+
+	for _, tc := range []struct {
+		method string
+		target string
+		status int
+	}{
+		{method: http.MethodPut, target: "http://s3.example.com/bucket/ci/build.tar", status: http.StatusOK},
+		{method: http.MethodPut, target: "http://s3.example.com/bucket/release/build.tar", status: http.StatusForbidden},
+		{method: http.MethodDelete, target: "http://s3.example.com/bucket/ci/build.tar", status: http.StatusForbidden},
+	} {
+		req := newSessionSignedRequest(t, credentials, tc.method, tc.target, "")
+		req.Header.Set("X-Real-IP", "203.0.113.10")
+		recorder := httptest.NewRecorder()
+		writeAccessMiddleware(defaultBucketPolicy(nil, []string{"proxy-access"}), auth, nil, "", nil)(newTestContext(recorder, req))
+
+		if recorder.Code != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.target, tc.status, recorder.Code)
+		}
+	}
+}
+
+func TestAssumeRoleAcceptsSTSClientSignature(t *testing.T) {
+	auth := sessionAuthenticator(t)
+	body := url.Values{"Action": {"AssumeRole"}, "Version": {"2011-06-15"}, "RoleSessionName": {"sdk"}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "http://s3.example.com/-/sts/", strings.NewReader(body))
+	req.Host = req.URL.Host
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set("X-Amz-Date", "20260517T163000Z")
+
+	// STS 客户端对实际请求体签名，但不发送 x-amz-content-sha256
+	scope := "20260517/us-east-1/sts/aws4_request"
+	canonicalRequest, err := buildCanonicalRequest(req, []string{"content-type", "host", "x-amz-date"}, "", hexSHA256(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := auth.credentials["proxy-access"].signature("20260517T163000Z", scope, canonicalRequest)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=proxy-access/"+scope+", SignedHeaders=content-type;host;x-amz-date, Signature="+signature)
+	recorder := httptest.NewRecorder()
+	adminMiddleware(auth, nil)(newTestContext(recorder, req))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected STS client request to succeed, got status %d: %s", recorder.Code, recorder.Body)
+	}
+}